@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PairStatus is a snapshot of the strategy state of a pair, published by the loop on every iteration.
+type PairStatus struct {
+	// Pair is the traded pair (e.g., "WBTC/USDC").
+	Pair string `json:"pair"`
+
+	// Paused reports whether trading is paused for the pair.
+	Paused bool `json:"paused"`
+
+	// OrderType is the order type the price monitor is waiting to place.
+	OrderType string `json:"orderType"`
+
+	// Price is the last quoted price of the target token in the stable token.
+	Price float64 `json:"price"`
+
+	// TriggerPriceUp is the upper trigger price of the price monitor.
+	TriggerPriceUp float64 `json:"triggerPriceUp"`
+
+	// TriggerPriceDown is the lower trigger price of the price monitor.
+	TriggerPriceDown float64 `json:"triggerPriceDown"`
+
+	// LimitPercent is the limit percentage of the price monitor.
+	LimitPercent float64 `json:"limitPercent"`
+
+	// StopLossPercent is the stop-loss percentage of the price monitor.
+	StopLossPercent float64 `json:"stopLossPercent"`
+
+	// Balances maps token symbols to wallet balances, in base units.
+	Balances map[string]string `json:"balances"`
+
+	// OpenOrders are the journaled orders of the pair that are not final yet.
+	OpenOrders []*TradeRecord `json:"openOrders"`
+
+	// UpdatedAt is when the loop last published the status.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PairCommands are the admin commands for a pair, consumed by the loop on its next iteration.
+type PairCommands struct {
+	// ForceTrade requests a one-shot trade of the current position, regardless of the trigger prices.
+	ForceTrade bool
+
+	// Flatten requests an emergency swap of the target token to the stable token.
+	Flatten bool
+
+	// LimitPercent is the new limit percentage, or 0 to keep the current one.
+	LimitPercent float64
+
+	// StopLossPercent is the new stop-loss percentage, or 0 to keep the current one.
+	StopLossPercent float64
+}
+
+// PairController relays admin commands to the loop trading a pair, and the status of the loop back to the admin API.
+type PairController struct {
+	// mu guards the fields below.
+	mu sync.Mutex
+
+	// paused reports whether trading is paused.
+	paused bool
+
+	// commands are the pending commands.
+	commands PairCommands
+
+	// status is the last published status.
+	status PairStatus
+
+	// wake interrupts the sleep of the loop when a command is queued.
+	wake chan struct{}
+}
+
+// Pause stops the pair from placing orders on triggers. The price is still monitored.
+func (c *PairController) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = true
+}
+
+// Resume lets the pair place orders on triggers again.
+func (c *PairController) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = false
+}
+
+// IsPaused reports whether trading is paused for the pair.
+func (c *PairController) IsPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.paused
+}
+
+// ForceTrade queues a one-shot trade of the current position.
+func (c *PairController) ForceTrade() {
+	c.mu.Lock()
+	c.commands.ForceTrade = true
+	c.mu.Unlock()
+
+	c.notify()
+}
+
+// Flatten queues an emergency swap of the target token to the stable token, and pauses the pair so that it does not buy back.
+func (c *PairController) Flatten() {
+	c.mu.Lock()
+	c.commands.Flatten = true
+	c.paused = true
+	c.mu.Unlock()
+
+	c.notify()
+}
+
+// SetPercentages queues new limit and stop-loss percentages. A zero percentage keeps the current one.
+func (c *PairController) SetPercentages(limitPercent float64, stopLossPercent float64) error {
+	if limitPercent < 0 || limitPercent >= 100 {
+		return fmt.Errorf("invalid limit percentage: %f", limitPercent)
+	}
+	if stopLossPercent < 0 || stopLossPercent >= 100 {
+		return fmt.Errorf("invalid stop-loss percentage: %f", stopLossPercent)
+	}
+
+	c.mu.Lock()
+	if limitPercent > 0 {
+		c.commands.LimitPercent = limitPercent
+	}
+	if stopLossPercent > 0 {
+		c.commands.StopLossPercent = stopLossPercent
+	}
+	c.mu.Unlock()
+
+	c.notify()
+	return nil
+}
+
+// TakeCommands returns and clears the pending commands.
+func (c *PairController) TakeCommands() PairCommands {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	commands := c.commands
+	c.commands = PairCommands{}
+	return commands
+}
+
+// PublishStatus records the status of the pair.
+func (c *PairController) PublishStatus(status PairStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status.Paused = c.paused
+	status.UpdatedAt = time.Now()
+	c.status = status
+}
+
+// Status returns the last published status of the pair.
+func (c *PairController) Status() PairStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := c.status
+	status.Paused = c.paused
+	return status
+}
+
+// Wake returns a channel receiving when a command is queued, to interrupt the wait before the next poll.
+func (c *PairController) Wake() <-chan struct{} {
+	return c.wake
+}
+
+// notify wakes the loop up, if it is sleeping.
+func (c *PairController) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// NewPairController creates a new PairController for the pair.
+func NewPairController(pair string) *PairController {
+	return &PairController{
+		status: PairStatus{Pair: pair},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// percentagesRequest is the JSON body of the percentages endpoint.
+type percentagesRequest struct {
+	LimitPercent    float64 `json:"limitPercent"`
+	StopLossPercent float64 `json:"stopLossPercent"`
+}
+
+// errorResponse is the JSON body of failed admin requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// adminAPI serves the admin endpoints.
+type adminAPI struct {
+	// token is the bearer token required on every request.
+	token string
+
+	// journal is used to list the open orders of the pairs.
+	journal TradeJournal
+
+	// controllers are the pair controllers, keyed by pair.
+	controllers map[string]*PairController
+}
+
+// authorize wraps the handler, rejecting requests without the bearer token.
+func (a *adminAPI) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		next(w, req)
+	}
+}
+
+// controller returns the controller of the pair in the request path, writing a 404 response if there is none.
+func (a *adminAPI) controller(w http.ResponseWriter, req *http.Request) (*PairController, bool) {
+	pair := req.PathValue("target") + "/" + req.PathValue("stable")
+	c, ok := a.controllers[pair]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("unknown pair: %s", pair)})
+	}
+	return c, ok
+}
+
+// status returns the status of the pair controller with its open orders.
+func (a *adminAPI) status(c *PairController) (PairStatus, error) {
+	status := c.Status()
+	openOrders, err := a.journal.OpenTrades(status.Pair)
+	if err != nil {
+		return status, err
+	}
+	status.OpenOrders = openOrders
+	return status, nil
+}
+
+// handleStatus serves the status of every pair.
+func (a *adminAPI) handleStatus(w http.ResponseWriter, req *http.Request) {
+	statuses := make([]PairStatus, 0, len(a.controllers))
+	for _, c := range a.controllers {
+		status, err := a.status(c)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handlePairStatus serves the status of a pair.
+func (a *adminAPI) handlePairStatus(w http.ResponseWriter, req *http.Request) {
+	c, ok := a.controller(w, req)
+	if !ok {
+		return
+	}
+	status, err := a.status(c)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleCommand returns a handler that applies the command to the pair, and responds with its status.
+func (a *adminAPI) handleCommand(command func(c *PairController)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		c, ok := a.controller(w, req)
+		if !ok {
+			return
+		}
+		command(c)
+		writeJSON(w, http.StatusAccepted, c.Status())
+	}
+}
+
+// handlePercentages queues new limit and stop-loss percentages for the pair.
+func (a *adminAPI) handlePercentages(w http.ResponseWriter, req *http.Request) {
+	c, ok := a.controller(w, req)
+	if !ok {
+		return
+	}
+
+	var body percentagesRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if body.LimitPercent == 0 && body.StopLossPercent == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limitPercent or stopLossPercent is required"})
+		return
+	}
+	if err := c.SetPercentages(body.LimitPercent, body.StopLossPercent); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, c.Status())
+}
+
+// NewAdminHandler creates the handler of the admin API, authorizing requests with the bearer token.
+// Pairs are addressed by their target and stable token symbols (e.g., /admin/pairs/WBTC/USDC/pause).
+func NewAdminHandler(token string, journal TradeJournal, controllers map[string]*PairController) http.Handler {
+	a := &adminAPI{
+		token:       token,
+		journal:     journal,
+		controllers: controllers,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/status", a.authorize(a.handleStatus))
+	mux.HandleFunc("GET /admin/pairs/{target}/{stable}", a.authorize(a.handlePairStatus))
+	mux.HandleFunc("POST /admin/pairs/{target}/{stable}/pause", a.authorize(a.handleCommand((*PairController).Pause)))
+	mux.HandleFunc("POST /admin/pairs/{target}/{stable}/resume", a.authorize(a.handleCommand((*PairController).Resume)))
+	mux.HandleFunc("POST /admin/pairs/{target}/{stable}/trade", a.authorize(a.handleCommand((*PairController).ForceTrade)))
+	mux.HandleFunc("POST /admin/pairs/{target}/{stable}/flatten", a.authorize(a.handleCommand((*PairController).Flatten)))
+	mux.HandleFunc("POST /admin/pairs/{target}/{stable}/percentages", a.authorize(a.handlePercentages))
+	return mux
+}
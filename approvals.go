@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// allowanceTimeout bounds ensuring an allowance before trading, including waiting for the approval to be mined.
+const allowanceTimeout = 5 * time.Minute
+
+// ApprovalMode determines how much allowance is granted to the router when an approval is required.
+type ApprovalMode int
+
+const (
+	// ExactApproval approves exactly the amount that is about to be spent.
+	ExactApproval ApprovalMode = iota
+
+	// CappedApproval approves a configured per-token cap, so that several swaps can be made without re-approving.
+	CappedApproval
+)
+
+var approvalModes = map[ApprovalMode]string{
+	ExactApproval:  "exact",
+	CappedApproval: "capped",
+}
+
+func (am ApprovalMode) String() string {
+	return approvalModes[am]
+}
+
+// ParseApprovalMode parses an approval mode from its string representation. An empty string selects ExactApproval.
+func ParseApprovalMode(s string) (ApprovalMode, error) {
+	if s == "" {
+		return ExactApproval, nil
+	}
+	for mode, name := range approvalModes {
+		if strings.EqualFold(name, s) {
+			return mode, nil
+		}
+	}
+	return ExactApproval, errors.New("unknown approval mode: " + s)
+}
+
+// ApprovalManager manages ERC-20 allowances granted by the wallet to the router contract.
+type ApprovalManager interface {
+	// Allowance returns the current router allowance for the token.
+	Allowance(ctx context.Context, tokenAddress string) (*big.Int, error)
+
+	// Approve sets the router allowance for the token to the given amount and waits for the receipt.
+	// It returns a nil receipt if the allowance is already set to the amount.
+	Approve(ctx context.Context, tokenAddress string, amount *big.Int) (*types.Receipt, error)
+
+	// EnsureAllowance approves the router according to the approval mode if the current allowance is below the required amount.
+	// It returns a nil receipt if no approval was necessary.
+	EnsureAllowance(ctx context.Context, tokenAddress string, required *big.Int) (*types.Receipt, error)
+
+	// Revoke sets the router allowance for the token to zero and waits for the receipt.
+	Revoke(ctx context.Context, tokenAddress string) (*types.Receipt, error)
+
+	// SpenderAddress returns the address of the contract that is granted the allowances.
+	SpenderAddress() string
+}
+
+// approvalManager implements the ApprovalManager interface.
+type approvalManager struct {
+	// client is the Ethereum JSON-RPC client used to read allowances.
+	client EthereumClient
+
+	// transactor is used to sign and broadcast approve transactions.
+	transactor Transactor
+
+	// ownerAddress is the address of the wallet granting the allowances.
+	ownerAddress string
+
+	// spenderAddress is the address of the router contract being granted the allowances.
+	spenderAddress string
+
+	// mode determines how much allowance is granted when an approval is required.
+	mode ApprovalMode
+
+	// caps holds the maximum allowance per lower-cased token address, used in CappedApproval mode.
+	caps map[string]*big.Int
+
+	// resets holds the lower-cased addresses of the tokens whose non-zero allowance must be set to zero before it is changed.
+	resets map[string]bool
+}
+
+// Allowance returns the current router allowance for the token.
+func (am *approvalManager) Allowance(ctx context.Context, tokenAddress string) (*big.Int, error) {
+	return ERC20Allowance(ctx, am.client, tokenAddress, am.ownerAddress, am.spenderAddress)
+}
+
+// Approve sets the router allowance for the token to the given amount and waits for the receipt.
+func (am *approvalManager) Approve(ctx context.Context, tokenAddress string, amount *big.Int) (*types.Receipt, error) {
+	if amount == nil || amount.Sign() < 0 {
+		return nil, errors.New("invalid approval amount")
+	}
+
+	current, err := am.Allowance(ctx, tokenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Cmp(amount) == 0 {
+		return nil, nil
+	}
+
+	// Some tokens (e.g. USDT) revert when changing a non-zero allowance to another non-zero value.
+	if current.Sign() > 0 && amount.Sign() > 0 && am.resets[strings.ToLower(tokenAddress)] {
+		if _, err := am.sendApprove(ctx, tokenAddress, big.NewInt(0)); err != nil {
+			return nil, err
+		}
+	}
+
+	return am.sendApprove(ctx, tokenAddress, amount)
+}
+
+// EnsureAllowance approves the router according to the approval mode if the current allowance is below the required amount.
+func (am *approvalManager) EnsureAllowance(ctx context.Context, tokenAddress string, required *big.Int) (*types.Receipt, error) {
+	current, err := am.Allowance(ctx, tokenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Cmp(required) >= 0 {
+		return nil, nil
+	}
+
+	amount := required
+	if am.mode == CappedApproval {
+		approvalCap, ok := am.caps[strings.ToLower(tokenAddress)]
+		if !ok {
+			return nil, errors.New("no approval cap configured for token " + tokenAddress)
+		}
+		if approvalCap.Cmp(required) < 0 {
+			return nil, fmt.Errorf("required allowance %s exceeds approval cap %s for token %s", required, approvalCap, tokenAddress)
+		}
+		amount = approvalCap
+	}
+
+	log.Infof("Approving %s of token %s for spender %s (%s mode)...", amount, tokenAddress, am.spenderAddress, am.mode)
+	return am.Approve(ctx, tokenAddress, amount)
+}
+
+// Revoke sets the router allowance for the token to zero and waits for the receipt.
+func (am *approvalManager) Revoke(ctx context.Context, tokenAddress string) (*types.Receipt, error) {
+	return am.Approve(ctx, tokenAddress, big.NewInt(0))
+}
+
+// SpenderAddress returns the address of the contract that is granted the allowances.
+func (am *approvalManager) SpenderAddress() string {
+	return am.spenderAddress
+}
+
+// sendApprove broadcasts an approve(spender, amount) transaction for the token and waits for the receipt.
+func (am *approvalManager) sendApprove(ctx context.Context, tokenAddress string, amount *big.Int) (*types.Receipt, error) {
+	data, err := erc20ABI.Pack("approve", common.HexToAddress(am.spenderAddress), amount)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := am.transactor.SendTransaction(ctx, tokenAddress, data)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Approved %s of token %s for spender %s in transaction %s", amount, tokenAddress, am.spenderAddress, receipt.TxHash.Hex())
+	return receipt, nil
+}
+
+// NewApprovalManager creates a new ApprovalManager that grants allowances from the wallet to the spender contract.
+// The caps map is keyed by token address and only consulted in CappedApproval mode. The allowances of the reset tokens are
+// set to zero before being changed, as required by tokens like USDT.
+func NewApprovalManager(client EthereumClient, w Wallet, spenderAddress string, mode ApprovalMode, caps map[string]*big.Int, resetTokenAddresses []string) ApprovalManager {
+	normalizedCaps := make(map[string]*big.Int, len(caps))
+	for tokenAddress, approvalCap := range caps {
+		normalizedCaps[strings.ToLower(tokenAddress)] = approvalCap
+	}
+
+	resets := make(map[string]bool, len(resetTokenAddresses))
+	for _, tokenAddress := range resetTokenAddresses {
+		resets[strings.ToLower(tokenAddress)] = true
+	}
+
+	return &approvalManager{
+		client:         client,
+		transactor:     NewTransactor(client, w),
+		ownerAddress:   w.Address(),
+		spenderAddress: spenderAddress,
+		mode:           mode,
+		caps:           normalizedCaps,
+		resets:         resets,
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newSimulatedApprovalManager creates an approval manager for the test wallet on the stub chain.
+func newSimulatedApprovalManager(t *testing.T, chain *stubChain, mode ApprovalMode, caps map[string]*big.Int, resetTokenAddresses []string) ApprovalManager {
+	t.Helper()
+
+	chainId, err := chain.backend.Client().ChainID(context.Background())
+	if err != nil {
+		t.Fatalf("ChainID: %v", err)
+	}
+	w, err := NewWallet(testPrivateKeyHex, testAddress, chainId.String())
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+	return NewApprovalManager(chain, w, testRouterAddress.Hex(), mode, caps, resetTokenAddresses)
+}
+
+func TestApprovalManagerExact(t *testing.T) {
+	chain := newStubChain(t)
+	chain.addToken(testTokenAddress, 1_000, 0)
+	am := newSimulatedApprovalManager(t, chain, ExactApproval, nil, nil)
+
+	receipt, err := am.EnsureAllowance(context.Background(), testTokenAddress.Hex(), big.NewInt(500))
+	if err != nil {
+		t.Fatalf("EnsureAllowance: %v", err)
+	}
+	if receipt == nil || receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("receipt = %+v, want a successful approval", receipt)
+	}
+	if got := chain.allowance(testTokenAddress); got.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("allowance = %s, want 500", got)
+	}
+
+	receipt, err = am.EnsureAllowance(context.Background(), testTokenAddress.Hex(), big.NewInt(400))
+	if err != nil || receipt != nil {
+		t.Errorf("EnsureAllowance within the allowance = %v, %v, want no approval", receipt, err)
+	}
+	if sent := len(chain.transactions()); sent != 1 {
+		t.Errorf("sent %d transactions, want 1", sent)
+	}
+
+	if _, err := am.Revoke(context.Background(), testTokenAddress.Hex()); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if got := chain.allowance(testTokenAddress); got.Sign() != 0 {
+		t.Errorf("allowance after revoke = %s, want 0", got)
+	}
+}
+
+func TestApprovalManagerCapped(t *testing.T) {
+	chain := newStubChain(t)
+	chain.addToken(testTokenAddress, 1_000, 0)
+	chain.addToken(brokenTokenAddress, 1_000, 0)
+	caps := map[string]*big.Int{testTokenAddress.Hex(): big.NewInt(10_000)}
+	am := newSimulatedApprovalManager(t, chain, CappedApproval, caps, nil)
+
+	if _, err := am.EnsureAllowance(context.Background(), testTokenAddress.Hex(), big.NewInt(500)); err != nil {
+		t.Fatalf("EnsureAllowance: %v", err)
+	}
+	if got := chain.allowance(testTokenAddress); got.Cmp(big.NewInt(10_000)) != 0 {
+		t.Errorf("allowance = %s, want the cap 10000", got)
+	}
+
+	if _, err := am.EnsureAllowance(context.Background(), testTokenAddress.Hex(), big.NewInt(20_000)); err == nil {
+		t.Error("approving beyond the cap succeeded, want an error")
+	}
+	if _, err := am.EnsureAllowance(context.Background(), brokenTokenAddress.Hex(), big.NewInt(500)); err == nil {
+		t.Error("approving a token without a cap succeeded, want an error")
+	}
+	if sent := len(chain.transactions()); sent != 1 {
+		t.Errorf("sent %d transactions, want 1", sent)
+	}
+}
+
+func TestApprovalManagerResetRequired(t *testing.T) {
+	tests := []struct {
+		name      string
+		resets    []string
+		want      int64
+		approvals int
+		wantErr   bool
+	}{
+		{name: "reset configured", resets: []string{testTokenAddress.Hex()}, want: 500, approvals: 2},
+		{name: "reset not configured", want: 100, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := newStubChain(t)
+			chain.addToken(testTokenAddress, 1_000, 100).resetRequired = true
+			am := newSimulatedApprovalManager(t, chain, ExactApproval, nil, tt.resets)
+
+			_, err := am.EnsureAllowance(context.Background(), testTokenAddress.Hex(), big.NewInt(500))
+			if tt.wantErr {
+				if !errors.Is(err, errStubReverted) {
+					t.Errorf("EnsureAllowance = %v, want a revert", err)
+				}
+			} else if err != nil {
+				t.Fatalf("EnsureAllowance: %v", err)
+			}
+
+			if got := chain.allowance(testTokenAddress); got.Cmp(big.NewInt(tt.want)) != 0 {
+				t.Errorf("allowance = %s, want %d", got, tt.want)
+			}
+			if sent := len(chain.transactions()); sent != tt.approvals {
+				t.Errorf("sent %d transactions, want %d", sent, tt.approvals)
+			}
+		})
+	}
+}
+
+func TestTransactorDynamicFees(t *testing.T) {
+	chain := newStubChain(t)
+	chain.addToken(testTokenAddress, 1_000, 0)
+	am := newSimulatedApprovalManager(t, chain, ExactApproval, nil, nil)
+
+	receipt, err := am.Approve(context.Background(), testTokenAddress.Hex(), big.NewInt(500))
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+
+	sent := chain.transactions()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d transactions, want 1", len(sent))
+	}
+	tx := sent[0]
+	if tx.Type() != types.DynamicFeeTxType {
+		t.Errorf("transaction type = %d, want dynamic fee", tx.Type())
+	}
+
+	parent, err := chain.HeaderByNumber(context.Background(), new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1)))
+	if err != nil {
+		t.Fatalf("HeaderByNumber: %v", err)
+	}
+	wantFeeCap := new(big.Int).Add(tx.GasTipCap(), new(big.Int).Mul(parent.BaseFee, big.NewInt(2)))
+	if tx.GasFeeCap().Cmp(wantFeeCap) != 0 {
+		t.Errorf("fee cap = %s, want tip %s plus twice the base fee %s", tx.GasFeeCap(), tx.GasTipCap(), parent.BaseFee)
+	}
+
+	to := testTokenAddress
+	estimate, err := chain.EstimateGas(context.Background(), ethereum.CallMsg{From: common.HexToAddress(testAddress), To: &to, Data: tx.Data()})
+	if err != nil {
+		t.Fatalf("EstimateGas: %v", err)
+	}
+	if want := estimate * 120 / 100; tx.Gas() != want {
+		t.Errorf("gas limit = %d, want %d (estimate %d with a 20%% buffer)", tx.Gas(), want, estimate)
+	}
+
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil || from != common.HexToAddress(testAddress) {
+		t.Errorf("sender = %s, %v, want %s", from.Hex(), err, testAddress)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+// Multicall3ContractAddress is the address of the canonical Multicall3 contract, identical on all supported chains.
+const Multicall3ContractAddress = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// NativeTokenAddress is the pseudo address used by 1inch for the chain's native currency.
+const NativeTokenAddress = "0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE"
+
+// multicall3ABIJSON is the subset of the Multicall3 ABI used to batch reads.
+const multicall3ABIJSON = `[
+	{"type":"function","name":"aggregate3","stateMutability":"payable","inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]},
+	{"type":"function","name":"getEthBalance","stateMutability":"view","inputs":[{"name":"addr","type":"address"}],"outputs":[{"name":"balance","type":"uint256"}]}
+]`
+
+// multicall3ABI is the parsed Multicall3 ABI.
+var multicall3ABI = mustParseABI(multicall3ABIJSON)
+
+// multicall3Call mirrors the Multicall3 Call3 struct for ABI encoding.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// multicall3Result mirrors the Multicall3 Result struct for ABI decoding.
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// BalanceProvider retrieves the token balances of a wallet and the allowances it granted to the router.
+type BalanceProvider interface {
+	// BalancesAndAllowances returns the balances and router allowances of the given tokens, keyed by the token addresses as passed in.
+	BalancesAndAllowances(walletAddress string, tokenAddresses []string) (BalancesAndAllowancesResponse, error)
+
+	// Name returns a short human readable name of the provider, used in logs.
+	Name() string
+}
+
+// oneInchBalanceProvider implements the BalanceProvider interface on top of the 1inch balance API.
+type oneInchBalanceProvider struct {
+	// router is the 1inch router used to query balances and allowances.
+	router OneInchRouter
+}
+
+// BalancesAndAllowances returns the balances and router allowances of the given tokens, keyed by the token addresses as passed in.
+func (p *oneInchBalanceProvider) BalancesAndAllowances(walletAddress string, tokenAddresses []string) (BalancesAndAllowancesResponse, error) {
+	resp, err := p.router.GetWalletTokenBalancesAndRouterAllowances(walletAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	byAddress := make(map[string]TokenBalanceAndAllowance, len(resp))
+	for tokenAddress, balanceAndAllowance := range resp {
+		byAddress[strings.ToLower(tokenAddress)] = balanceAndAllowance
+	}
+
+	balancesAndAllowances := make(BalancesAndAllowancesResponse, len(tokenAddresses))
+	for _, tokenAddress := range tokenAddresses {
+		balanceAndAllowance, ok := byAddress[strings.ToLower(tokenAddress)]
+		if !ok {
+			// A token missing from the response is unknown to 1inch, not an empty balance.
+			return nil, fmt.Errorf("token %s is missing from the 1inch balances", tokenAddress)
+		}
+		balancesAndAllowances[tokenAddress] = balanceAndAllowance
+	}
+
+	return balancesAndAllowances, nil
+}
+
+// Name returns a short human readable name of the provider, used in logs.
+func (p *oneInchBalanceProvider) Name() string {
+	return "1inch"
+}
+
+// NewOneInchBalanceProvider creates a new BalanceProvider backed by the 1inch balance API.
+func NewOneInchBalanceProvider(router OneInchRouter) BalanceProvider {
+	return &oneInchBalanceProvider{
+		router: router,
+	}
+}
+
+// rpcBalanceProvider implements the BalanceProvider interface with ERC-20 reads batched through Multicall3.
+type rpcBalanceProvider struct {
+	// client is the Ethereum JSON-RPC client used to execute the batched reads.
+	client EthereumClient
+
+	// spenderAddress is the address of the router contract whose allowances are read.
+	spenderAddress string
+}
+
+// BalancesAndAllowances returns the balances and router allowances of the given tokens, keyed by the token addresses as passed in.
+func (p *rpcBalanceProvider) BalancesAndAllowances(walletAddress string, tokenAddresses []string) (BalancesAndAllowancesResponse, error) {
+	owner := common.HexToAddress(walletAddress)
+	spender := common.HexToAddress(p.spenderAddress)
+	multicall := common.HexToAddress(Multicall3ContractAddress)
+
+	calls := make([]multicall3Call, 0, 2*len(tokenAddresses))
+	for _, tokenAddress := range tokenAddresses {
+		// The native currency has no allowance, only its balance is read through Multicall3 itself.
+		if strings.EqualFold(tokenAddress, NativeTokenAddress) {
+			data, err := multicall3ABI.Pack("getEthBalance", owner)
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, multicall3Call{Target: multicall, AllowFailure: true, CallData: data})
+			continue
+		}
+
+		token := common.HexToAddress(tokenAddress)
+
+		data, err := erc20ABI.Pack("balanceOf", owner)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, multicall3Call{Target: token, AllowFailure: true, CallData: data})
+
+		data, err = erc20ABI.Pack("allowance", owner, spender)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, multicall3Call{Target: token, AllowFailure: true, CallData: data})
+	}
+
+	data, err := multicall3ABI.Pack("aggregate3", calls)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := p.client.CallContract(context.TODO(), ethereum.CallMsg{To: &multicall, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []multicall3Result
+	if err := multicall3ABI.UnpackIntoInterface(&results, "aggregate3", output); err != nil {
+		return nil, err
+	}
+
+	if len(results) != len(calls) {
+		return nil, errors.New("unexpected number of multicall results")
+	}
+
+	// Calls may fail individually, so that the failing token can be named. A failed or malformed read is never taken as zero.
+	for i, result := range results {
+		if !result.Success || len(result.ReturnData) != 32 {
+			return nil, fmt.Errorf("multicall read %d of token %s failed", i, calls[i].Target.Hex())
+		}
+	}
+
+	balancesAndAllowances := make(BalancesAndAllowancesResponse, len(tokenAddresses))
+	i := 0
+	for _, tokenAddress := range tokenAddresses {
+		if strings.EqualFold(tokenAddress, NativeTokenAddress) {
+			balance := new(big.Int).SetBytes(results[i].ReturnData)
+			balancesAndAllowances[tokenAddress] = TokenBalanceAndAllowance{
+				Balance:   balance.String(),
+				Allowance: math.MaxBig256.String(),
+			}
+			i++
+			continue
+		}
+
+		balance := new(big.Int).SetBytes(results[i].ReturnData)
+		allowance := new(big.Int).SetBytes(results[i+1].ReturnData)
+		balancesAndAllowances[tokenAddress] = TokenBalanceAndAllowance{
+			Balance:   balance.String(),
+			Allowance: allowance.String(),
+		}
+		i += 2
+	}
+
+	return balancesAndAllowances, nil
+}
+
+// Name returns a short human readable name of the provider, used in logs.
+func (p *rpcBalanceProvider) Name() string {
+	return "rpc"
+}
+
+// NewRPCBalanceProvider creates a new BalanceProvider that reads balances and allowances on-chain through Multicall3.
+func NewRPCBalanceProvider(client EthereumClient, spenderAddress string) BalanceProvider {
+	return &rpcBalanceProvider{
+		client:         client,
+		spenderAddress: spenderAddress,
+	}
+}
+
+// BalanceMismatchError is returned when two balance providers disagree by more than the tolerance.
+type BalanceMismatchError struct {
+	// TokenAddress is the address of the token the providers disagree on.
+	TokenAddress string
+
+	// Field is the reading the providers disagree on, "balance" or "allowance".
+	Field string
+
+	// Primary is the reading of the primary provider.
+	Primary string
+
+	// Secondary is the reading of the secondary provider.
+	Secondary string
+
+	// DeviationPercent is the difference between the readings, in percent of the larger one.
+	DeviationPercent float64
+
+	// TolerancePercent is the configured tolerance, in percent.
+	TolerancePercent float64
+}
+
+func (e *BalanceMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch for token %s: %s vs %s (%.4f%%, tolerance %.4f%%)", e.Field, e.TokenAddress, e.Primary, e.Secondary, e.DeviationPercent, e.TolerancePercent)
+}
+
+// deviationPercent returns the difference between two amounts in base units, in percent of the larger one.
+func deviationPercent(a string, b string) (float64, error) {
+	x, ok := new(big.Int).SetString(a, 10)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount: %s", a)
+	}
+	y, ok := new(big.Int).SetString(b, 10)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount: %s", b)
+	}
+
+	larger := x
+	if y.Cmp(x) > 0 {
+		larger = y
+	}
+	if larger.Sign() == 0 {
+		return 0, nil
+	}
+
+	diff := new(big.Float).SetInt(new(big.Int).Abs(new(big.Int).Sub(x, y)))
+	percent, _ := diff.Quo(diff, new(big.Float).SetInt(larger)).Float64()
+	return percent * 100, nil
+}
+
+// crossCheckedBalanceProvider implements the BalanceProvider interface by reading from two providers and comparing the results.
+type crossCheckedBalanceProvider struct {
+	// primary is the authoritative provider whose readings are returned when both providers succeed.
+	primary BalanceProvider
+
+	// secondary is the provider used to cross-check the primary, and as a fallback when the primary fails.
+	secondary BalanceProvider
+
+	// tolerancePercent is the largest difference between the readings, in percent, that is not an error.
+	tolerancePercent float64
+}
+
+// BalancesAndAllowances returns the balances and router allowances of the given tokens, keyed by the token addresses as passed in.
+// Small mismatches between the providers are logged and the primary reading wins, while mismatches beyond the tolerance
+// return a *BalanceMismatchError so that no trade is based on them. If one provider fails the other one is used.
+func (p *crossCheckedBalanceProvider) BalancesAndAllowances(walletAddress string, tokenAddresses []string) (BalancesAndAllowancesResponse, error) {
+	primary, primaryErr := p.primary.BalancesAndAllowances(walletAddress, tokenAddresses)
+	secondary, secondaryErr := p.secondary.BalancesAndAllowances(walletAddress, tokenAddresses)
+
+	if primaryErr != nil && secondaryErr != nil {
+		return nil, errors.Join(primaryErr, secondaryErr)
+	}
+
+	if primaryErr != nil {
+		log.Warnf("Error occurred while fetching balances from %s provider, falling back to %s provider: %v", p.primary.Name(), p.secondary.Name(), primaryErr)
+		return secondary, nil
+	}
+
+	if secondaryErr != nil {
+		log.Warnf("Error occurred while fetching balances from %s provider, unable to cross-check: %v", p.secondary.Name(), secondaryErr)
+		return primary, nil
+	}
+
+	for _, tokenAddress := range tokenAddresses {
+		a, b := primary[tokenAddress], secondary[tokenAddress]
+		readings := [][3]string{{"balance", a.Balance, b.Balance}}
+		// The native currency has no allowance, and the providers report it differently.
+		if !strings.EqualFold(tokenAddress, NativeTokenAddress) {
+			readings = append(readings, [3]string{"allowance", a.Allowance, b.Allowance})
+		}
+
+		for _, reading := range readings {
+			field, x, y := reading[0], reading[1], reading[2]
+			if x == y {
+				continue
+			}
+			deviation, err := deviationPercent(x, y)
+			if err != nil {
+				return nil, err
+			}
+			if deviation > p.tolerancePercent {
+				return nil, &BalanceMismatchError{
+					TokenAddress:     tokenAddress,
+					Field:            field,
+					Primary:          x,
+					Secondary:        y,
+					DeviationPercent: deviation,
+					TolerancePercent: p.tolerancePercent,
+				}
+			}
+			log.Warnf("Token %s %s mismatch within tolerance: %s provider reports %s, %s provider reports %s", tokenAddress, field, p.primary.Name(), x, p.secondary.Name(), y)
+		}
+	}
+
+	return primary, nil
+}
+
+// Name returns a short human readable name of the provider, used in logs.
+func (p *crossCheckedBalanceProvider) Name() string {
+	return p.primary.Name() + "+" + p.secondary.Name()
+}
+
+// NewCrossCheckedBalanceProvider creates a new BalanceProvider that returns the primary readings cross-checked against the
+// secondary, failing when they differ by more than the tolerance (in percent).
+func NewCrossCheckedBalanceProvider(primary BalanceProvider, secondary BalanceProvider, tolerancePercent float64) BalanceProvider {
+	return &crossCheckedBalanceProvider{
+		primary:          primary,
+		secondary:        secondary,
+		tolerancePercent: tolerancePercent,
+	}
+}
+
+// BalanceCache is a BalanceProvider shared by several workers, that serves recent readings from memory.
+type BalanceCache interface {
+	BalanceProvider
+
+	// Invalidate drops the cached readings of the wallet, so that the next call fetches fresh ones.
+	Invalidate(walletAddress string)
+}
+
+// cachedBalance is a cached balance and allowance reading of a token.
+type cachedBalance struct {
+	reading   TokenBalanceAndAllowance
+	fetchedAt time.Time
+}
+
+// balanceCache implements the BalanceCache interface on top of another provider.
+type balanceCache struct {
+	// provider is the provider readings are fetched from.
+	provider BalanceProvider
+
+	// ttl is how long readings are served from memory.
+	ttl time.Duration
+
+	// mu guards readings. It is held while fetching, so that concurrent callers share a single fetch.
+	mu sync.Mutex
+
+	// readings holds the cached readings, keyed by lower-cased wallet address and then lower-cased token address.
+	readings map[string]map[string]cachedBalance
+}
+
+// BalancesAndAllowances returns the balances and router allowances of the given tokens, keyed by the token addresses as passed in.
+// Only the tokens without a fresh reading are fetched from the provider.
+func (c *balanceCache) BalancesAndAllowances(walletAddress string, tokenAddresses []string) (BalancesAndAllowancesResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wallet := strings.ToLower(walletAddress)
+	if c.readings[wallet] == nil {
+		c.readings[wallet] = make(map[string]cachedBalance)
+	}
+
+	now := time.Now()
+	var stale []string
+	for _, tokenAddress := range tokenAddresses {
+		if cached, ok := c.readings[wallet][strings.ToLower(tokenAddress)]; !ok || now.Sub(cached.fetchedAt) >= c.ttl {
+			stale = append(stale, tokenAddress)
+		}
+	}
+
+	if len(stale) > 0 {
+		fetched, err := c.provider.BalancesAndAllowances(walletAddress, stale)
+		if err != nil {
+			return nil, err
+		}
+		for _, tokenAddress := range stale {
+			c.readings[wallet][strings.ToLower(tokenAddress)] = cachedBalance{reading: fetched[tokenAddress], fetchedAt: now}
+		}
+	}
+
+	resp := make(BalancesAndAllowancesResponse, len(tokenAddresses))
+	for _, tokenAddress := range tokenAddresses {
+		resp[tokenAddress] = c.readings[wallet][strings.ToLower(tokenAddress)].reading
+	}
+	return resp, nil
+}
+
+// Invalidate drops the cached readings of the wallet, so that the next call fetches fresh ones.
+func (c *balanceCache) Invalidate(walletAddress string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.readings, strings.ToLower(walletAddress))
+}
+
+// Name returns a short human readable name of the provider, used in logs.
+func (c *balanceCache) Name() string {
+	return "cached " + c.provider.Name()
+}
+
+// NewBalanceCache creates a new BalanceCache serving readings of the provider for the TTL.
+func NewBalanceCache(provider BalanceProvider, ttl time.Duration) BalanceCache {
+	return &balanceCache{
+		provider: provider,
+		ttl:      ttl,
+		readings: make(map[string]map[string]cachedBalance),
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testTokenAddress   = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	brokenTokenAddress = common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	testRouterAddress  = common.HexToAddress("0x111111125421cA6dc452d289314280a0f8842A65")
+)
+
+// errStubReverted is returned by stubChain for calls that revert.
+var errStubReverted = errors.New("execution reverted")
+
+// stubToken is the ERC-20 state of a token served by stubChain.
+type stubToken struct {
+	// balances are the token balances, keyed by owner.
+	balances map[common.Address]*big.Int
+
+	// allowances are the allowances, keyed by owner and spender.
+	allowances map[[2]common.Address]*big.Int
+
+	// resetRequired makes approvals revert when changing a non-zero allowance to another non-zero value, like USDT.
+	resetRequired bool
+
+	// broken makes every call to the token revert.
+	broken bool
+
+	// name is the token name, returned by name().
+	name string
+
+	// nonce makes the token implement EIP-2612 nonces(owner) when set.
+	nonce *big.Int
+}
+
+// stubChain runs transactions on the simulated backend, but answers ERC-20 and Multicall3 calls at the ABI level instead
+// of executing contract code. Approvals sent to a stub token are mined on the simulated backend and then applied to the
+// token state.
+type stubChain struct {
+	EthereumClient
+
+	// backend is the simulated backend executing the transactions.
+	backend *simulated.Backend
+
+	mu     sync.Mutex
+	tokens map[common.Address]*stubToken
+
+	// sent are the transactions sent, in order.
+	sent []*types.Transaction
+
+	// permit2Nonce is the Permit2 nonce returned for every allowance.
+	permit2Nonce int64
+}
+
+// newStubChain creates a simulated chain funding the test wallet with one ether.
+func newStubChain(t *testing.T) *stubChain {
+	t.Helper()
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		common.HexToAddress(testAddress): {Balance: big.NewInt(params.Ether)},
+	})
+	t.Cleanup(func() { backend.Close() })
+
+	return &stubChain{
+		EthereumClient: backend.Client(),
+		backend:        backend,
+		tokens:         make(map[common.Address]*stubToken),
+	}
+}
+
+// addToken serves a token with the given balance of the test wallet and allowance granted to the test router.
+func (c *stubChain) addToken(address common.Address, balance int64, allowance int64) *stubToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	owner := common.HexToAddress(testAddress)
+	token := &stubToken{
+		balances:   map[common.Address]*big.Int{owner: big.NewInt(balance)},
+		allowances: map[[2]common.Address]*big.Int{{owner, testRouterAddress}: big.NewInt(allowance)},
+	}
+	c.tokens[address] = token
+	return token
+}
+
+// allowance returns the allowance granted by the test wallet to the test router.
+func (c *stubChain) allowance(address common.Address) *big.Int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.tokens[address].allowance(common.HexToAddress(testAddress), testRouterAddress)
+}
+
+// transactions returns the transactions sent so far.
+func (c *stubChain) transactions() []*types.Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.sent)
+}
+
+func (token *stubToken) allowance(owner common.Address, spender common.Address) *big.Int {
+	if allowance, ok := token.allowances[[2]common.Address{owner, spender}]; ok {
+		return allowance
+	}
+	return new(big.Int)
+}
+
+// call executes an ERC-20 call on the token from the caller, without applying approvals.
+func (token *stubToken) call(from common.Address, data []byte) ([]byte, error) {
+	if token.broken || len(data) < 4 {
+		return nil, errStubReverted
+	}
+	method, err := erc20ABI.MethodById(data[:4])
+	if err != nil {
+		if method, err = permitABI.MethodById(data[:4]); err != nil {
+			return nil, errStubReverted
+		}
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, errStubReverted
+	}
+
+	switch method.Name {
+	case "name":
+		return method.Outputs.Pack(token.name)
+	case "nonces":
+		if token.nonce == nil {
+			return nil, errStubReverted
+		}
+		return method.Outputs.Pack(token.nonce)
+	case "balanceOf":
+		balance, ok := token.balances[args[0].(common.Address)]
+		if !ok {
+			balance = new(big.Int)
+		}
+		return method.Outputs.Pack(balance)
+	case "allowance":
+		return method.Outputs.Pack(token.allowance(args[0].(common.Address), args[1].(common.Address)))
+	case "approve":
+		spender, amount := args[0].(common.Address), args[1].(*big.Int)
+		if token.resetRequired && amount.Sign() > 0 && token.allowance(from, spender).Sign() > 0 {
+			return nil, errStubReverted
+		}
+		return method.Outputs.Pack(true)
+	}
+	return nil, errStubReverted
+}
+
+// approve applies a mined approval to the token.
+func (token *stubToken) approve(from common.Address, data []byte) {
+	args, _ := erc20ABI.Methods["approve"].Inputs.Unpack(data[4:])
+	token.allowances[[2]common.Address{from, args[0].(common.Address)}] = args[1].(*big.Int)
+}
+
+// CallContract answers calls to Multicall3 and to the stub tokens, and forwards the others to the simulated backend.
+func (c *stubChain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if msg.To == nil {
+		return c.EthereumClient.CallContract(ctx, msg, blockNumber)
+	}
+	if *msg.To == common.HexToAddress(Multicall3ContractAddress) {
+		return c.multicall(ctx, msg.From, msg.Data)
+	}
+	if *msg.To == common.HexToAddress(Permit2ContractAddress) {
+		return c.permit2Allowance(msg.Data)
+	}
+
+	c.mu.Lock()
+	token, ok := c.tokens[*msg.To]
+	if !ok {
+		c.mu.Unlock()
+		return c.EthereumClient.CallContract(ctx, msg, blockNumber)
+	}
+	defer c.mu.Unlock()
+
+	return token.call(msg.From, msg.Data)
+}
+
+// multicall executes the Multicall3 aggregate3 and getEthBalance functions with the failure semantics of the contract.
+func (c *stubChain) multicall(ctx context.Context, from common.Address, data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errStubReverted
+	}
+	method, err := multicall3ABI.MethodById(data[:4])
+	if err != nil {
+		return nil, errStubReverted
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, errStubReverted
+	}
+
+	if method.Name == "getEthBalance" {
+		balance, err := c.backend.Client().BalanceAt(ctx, args[0].(common.Address), nil)
+		if err != nil {
+			return nil, err
+		}
+		return method.Outputs.Pack(balance)
+	}
+
+	calls := *abi.ConvertType(args[0], new([]multicall3Call)).(*[]multicall3Call)
+	results := make([]multicall3Result, 0, len(calls))
+	for _, call := range calls {
+		out, err := c.CallContract(ctx, ethereum.CallMsg{From: from, To: &call.Target, Data: call.CallData}, nil)
+		if err != nil && !call.AllowFailure {
+			return nil, errStubReverted
+		}
+		results = append(results, multicall3Result{Success: err == nil, ReturnData: out})
+	}
+	return method.Outputs.Pack(results)
+}
+
+// permit2Allowance answers the Permit2 allowance(owner, token, spender) function with no allowance and the Permit2 nonce.
+func (c *stubChain) permit2Allowance(data []byte) ([]byte, error) {
+	method := permitABI.Methods["allowance"]
+	if len(data) < 4 || !bytes.Equal(data[:4], method.ID) {
+		return nil, errStubReverted
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return method.Outputs.Pack(new(big.Int), new(big.Int), big.NewInt(c.permit2Nonce))
+}
+
+// EstimateGas fails for calls to the stub tokens that revert, and estimates the others on the simulated backend.
+func (c *stubChain) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	if msg.To != nil {
+		c.mu.Lock()
+		token, ok := c.tokens[*msg.To]
+		var err error
+		if ok {
+			_, err = token.call(msg.From, msg.Data)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.EthereumClient.EstimateGas(ctx, msg)
+}
+
+// SendTransaction sends the transaction to the simulated backend and mines it, then applies approvals to the stub tokens.
+func (c *stubChain) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := c.EthereumClient.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	c.backend.Commit()
+
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sent = append(c.sent, tx)
+	if token, ok := c.tokens[*tx.To()]; ok {
+		if _, err := token.call(from, tx.Data()); err == nil {
+			token.approve(from, tx.Data())
+		}
+	}
+	return nil
+}
+
+func newSimulatedBalanceProvider(t *testing.T) BalanceProvider {
+	t.Helper()
+
+	chain := newStubChain(t)
+	chain.addToken(testTokenAddress, 1_000_000, 250_000)
+	chain.addToken(brokenTokenAddress, 0, 0).broken = true
+
+	return NewRPCBalanceProvider(chain, testRouterAddress.Hex())
+}
+
+func TestRPCBalanceProvider(t *testing.T) {
+	bp := newSimulatedBalanceProvider(t)
+	tokenAddress := testTokenAddress.Hex()
+
+	resp, err := bp.BalancesAndAllowances(testAddress, []string{tokenAddress, NativeTokenAddress})
+	if err != nil {
+		t.Fatalf("BalancesAndAllowances: %v", err)
+	}
+
+	if got := resp[tokenAddress]; got.Balance != "1000000" || got.Allowance != "250000" {
+		t.Errorf("token reading = %+v, want balance 1000000 and allowance 250000", got)
+	}
+	if want := big.NewInt(params.Ether).String(); resp[NativeTokenAddress].Balance != want {
+		t.Errorf("native balance = %s, want %s", resp[NativeTokenAddress].Balance, want)
+	}
+}
+
+func TestRPCBalanceProviderFailedRead(t *testing.T) {
+	bp := newSimulatedBalanceProvider(t)
+
+	_, err := bp.BalancesAndAllowances(testAddress, []string{testTokenAddress.Hex(), brokenTokenAddress.Hex()})
+	if err == nil {
+		t.Fatal("reading a reverting token succeeded, want an error")
+	}
+	if !strings.Contains(err.Error(), brokenTokenAddress.Hex()) {
+		t.Errorf("error = %v, want it to name %s", err, brokenTokenAddress.Hex())
+	}
+}
+
+// staticBalanceProvider is a BalanceProvider returning fixed readings.
+type staticBalanceProvider struct {
+	name string
+	resp BalancesAndAllowancesResponse
+	err  error
+}
+
+func (p *staticBalanceProvider) BalancesAndAllowances(walletAddress string, tokenAddresses []string) (BalancesAndAllowancesResponse, error) {
+	return p.resp, p.err
+}
+
+func (p *staticBalanceProvider) Name() string {
+	return p.name
+}
+
+func TestCrossCheckedBalanceProvider(t *testing.T) {
+	const token = "0x00000000000000000000000000000000000000a1"
+	reading := func(balance string) *staticBalanceProvider {
+		return &staticBalanceProvider{resp: BalancesAndAllowancesResponse{token: {Balance: balance, Allowance: "100"}}}
+	}
+
+	tests := []struct {
+		name      string
+		primary   *staticBalanceProvider
+		secondary *staticBalanceProvider
+		want      string
+		mismatch  bool
+	}{
+		{name: "equal", primary: reading("1000"), secondary: reading("1000"), want: "1000"},
+		{name: "within tolerance", primary: reading("1000"), secondary: reading("995"), want: "1000"},
+		{name: "beyond tolerance", primary: reading("1000"), secondary: reading("0"), mismatch: true},
+		{name: "primary failed", primary: &staticBalanceProvider{err: errors.New("down")}, secondary: reading("990"), want: "990"},
+		{name: "secondary failed", primary: reading("1000"), secondary: &staticBalanceProvider{err: errors.New("down")}, want: "1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := NewCrossCheckedBalanceProvider(tt.primary, tt.secondary, 1)
+			resp, err := bp.BalancesAndAllowances(testAddress, []string{token})
+
+			var mismatchErr *BalanceMismatchError
+			if tt.mismatch {
+				if !errors.As(err, &mismatchErr) {
+					t.Fatalf("error = %v, want a *BalanceMismatchError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BalancesAndAllowances: %v", err)
+			}
+			if got := resp[token].Balance; got != tt.want {
+				t.Errorf("balance = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOneInchBalanceProviderMissingToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"0x00000000000000000000000000000000000000a1":{"balance":"5","allowance":"0"}}`))
+	}))
+	defer srv.Close()
+
+	bp := NewOneInchBalanceProvider(NewOneInchDevRouter("key", srv.URL, testRouterAddress.Hex(), "1"))
+
+	resp, err := bp.BalancesAndAllowances(testAddress, []string{testTokenAddress.Hex()})
+	if err != nil {
+		t.Fatalf("BalancesAndAllowances: %v", err)
+	}
+	if got := resp[testTokenAddress.Hex()].Balance; got != "5" {
+		t.Errorf("balance = %s, want 5", got)
+	}
+
+	if _, err := bp.BalancesAndAllowances(testAddress, []string{brokenTokenAddress.Hex()}); err == nil {
+		t.Error("reading a token missing from the response succeeded, want an error")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/charmbracelet/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// limitOrderProtocolABIJSON is the subset of the 1inch Limit Order Protocol (router) ABI used to cancel Fusion orders.
+const limitOrderProtocolABIJSON = `[
+	{"type":"function","name":"cancelOrder","stateMutability":"nonpayable","inputs":[{"name":"makerTraits","type":"uint256"},{"name":"orderHash","type":"bytes32"}],"outputs":[]}
+]`
+
+// limitOrderProtocolABI is the parsed Limit Order Protocol ABI.
+var limitOrderProtocolABI = mustParseABI(limitOrderProtocolABIJSON)
+
+// OrderCanceller cancels live Fusion orders of the wallet on-chain.
+type OrderCanceller interface {
+	// CancelOrder cancels the order with the given hash on the router contract and waits for the receipt.
+	CancelOrder(ctx context.Context, orderHash string) (*types.Receipt, error)
+}
+
+// orderCanceller implements the OrderCanceller interface with a cancelOrder transaction to the router contract.
+type orderCanceller struct {
+	// router is used to look up the maker traits of the order.
+	router OneInchRouter
+
+	// transactor sends the cancellation transaction.
+	transactor Transactor
+}
+
+// CancelOrder cancels the order with the given hash on the router contract and waits for the receipt.
+func (c *orderCanceller) CancelOrder(ctx context.Context, orderHash string) (*types.Receipt, error) {
+	orderStatus, err := c.router.GetOrderStatus(orderHash)
+	if err != nil {
+		return nil, err
+	}
+	if orderStatus.Status != "pending" && orderStatus.Status != "partially-filled" {
+		return nil, fmt.Errorf("order %s is %s, only live orders can be cancelled", orderHash, orderStatus.Status)
+	}
+
+	makerTraits, ok := new(big.Int).SetString(orderStatus.Order.MakerTraits, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid maker traits for order %s: %s", orderHash, orderStatus.Order.MakerTraits)
+	}
+
+	data, err := limitOrderProtocolABI.Pack("cancelOrder", makerTraits, common.HexToHash(orderHash))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Cancelling order %s...", orderHash)
+	receipt, err := c.transactor.SendTransaction(ctx, c.router.RouterContractAddress(), data)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Cancelled order %s in transaction %s", orderHash, receipt.TxHash.Hex())
+
+	return receipt, nil
+}
+
+// NewOrderCanceller creates a new OrderCanceller sending transactions from the wallet through the client.
+func NewOrderCanceller(client EthereumClient, w Wallet, r OneInchRouter) OrderCanceller {
+	return &orderCanceller{
+		router:     r,
+		transactor: NewTransactor(client, w),
+	}
+}
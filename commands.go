@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// commandStage is the point of startup at which a command runs, once the dependencies it needs are set up.
+type commandStage int
+
+const (
+	// configStage runs right after the .env file is loaded.
+	configStage commandStage = iota
+
+	// walletStage runs once the wallet is created.
+	walletStage
+
+	// storeStage runs once the RPC client, the approval manager and the state store are set up.
+	storeStage
+
+	// tokensStage runs once the router is authenticated, the pair tokens are verified and the balance provider is set up.
+	tokensStage
+)
+
+// commandEnv holds the arguments of a command and the dependencies set up so far, up to the stage of the command.
+type commandEnv struct {
+	// args are the arguments following the command name, without the --pair argument.
+	args []string
+
+	// pair is the name of the pair selected by the --pair argument (e.g., "WETH/USDC"), or empty if none was given.
+	pair string
+
+	w               Wallet
+	ec              *ethclient.Client
+	am              ApprovalManager
+	ps              PermitSigner
+	st              StateStore
+	r               OneInchRouter
+	tr              TokenRegistry
+	bp              BalanceProvider
+	pairs           []tradedPair
+	costBasisMethod CostBasisMethod
+	adminAddress    string
+	adminToken      string
+}
+
+// selectedPair returns the pair selected by the --pair argument, or the first configured pair if none was given.
+func (env *commandEnv) selectedPair() (tradedPair, error) {
+	if env.pair == "" {
+		return env.pairs[0], nil
+	}
+	for _, tp := range env.pairs {
+		if strings.EqualFold(tp.Name(), env.pair) {
+			return tp, nil
+		}
+	}
+	return tradedPair{}, fmt.Errorf("unknown pair %s", env.pair)
+}
+
+// selectedTokens returns the tokens of the pair selected by the --pair argument, or the first configured pair.
+func (env *commandEnv) selectedTokens() ([]*Token, error) {
+	tp, err := env.selectedPair()
+	if err != nil {
+		return nil, err
+	}
+	return []*Token{tp.target, tp.stable}, nil
+}
+
+// selectedTokenAddresses returns the token addresses of the pair selected by the --pair argument, or of all configured
+// pairs if none was given.
+func (env *commandEnv) selectedTokenAddresses() ([]string, error) {
+	configs := make([]PairConfig, 0, len(env.pairs))
+	for _, tp := range env.pairs {
+		configs = append(configs, tp.config)
+	}
+	if env.pair != "" {
+		tp, err := env.selectedPair()
+		if err != nil {
+			return nil, err
+		}
+		configs = []PairConfig{tp.config}
+	}
+	return PairTokenAddresses(configs), nil
+}
+
+// command is a subcommand, run instead of the service.
+type command struct {
+	// stage is the point of startup at which the command runs.
+	stage commandStage
+
+	// action describes what the command does in its error message (e.g., "approving allowances").
+	action string
+
+	// run runs the command.
+	run func(env *commandEnv) error
+}
+
+// commands are the subcommands by name.
+var commands = map[string]*command{
+	"config": {stage: configStage, action: "running config command", run: func(env *commandEnv) error {
+		return runConfigCommand(env.args)
+	}},
+	"sign-test": {stage: walletStage, action: "testing signatures", run: func(env *commandEnv) error {
+		return runSignTestCommand(env.w)
+	}},
+	"equity": {stage: storeStage, action: "exporting equity curve", run: func(env *commandEnv) error {
+		return runEquityCommand(env.st, env.w.Address(), env.args)
+	}},
+	"revoke": {stage: tokensStage, action: "revoking allowances", run: func(env *commandEnv) error {
+		if env.am == nil {
+			return errors.New("RPC_URL is required to revoke allowances")
+		}
+		tokenAddresses := env.args
+		if len(tokenAddresses) == 0 {
+			var err error
+			if tokenAddresses, err = env.selectedTokenAddresses(); err != nil {
+				return err
+			}
+		}
+		return runRevokeCommand(env.am, tokenAddresses)
+	}},
+	"approve": {stage: tokensStage, action: "approving allowances", run: func(env *commandEnv) error {
+		if env.am == nil {
+			return errors.New("RPC_URL is required to approve allowances")
+		}
+		tokenAddresses, err := env.selectedTokenAddresses()
+		if err != nil {
+			return err
+		}
+		return runApproveCommand(env.am, env.ec, env.w, tokenAddresses, env.args)
+	}},
+	"tui": {stage: tokensStage, action: "running terminal dashboard", run: func(env *commandEnv) error {
+		var admin *adminClient
+		if env.adminToken != "" {
+			admin = NewAdminClient(env.adminAddress, env.adminToken)
+		}
+		var canceller OrderCanceller
+		if env.ec != nil {
+			canceller = NewOrderCanceller(env.ec, env.w, env.r)
+		}
+		pairs := make([]string, 0, len(env.pairs))
+		engines := make(map[string]PnLEngine, len(env.pairs))
+		for _, tp := range env.pairs {
+			pairs = append(pairs, tp.Name())
+			engines[tp.Name()] = NewPnLEngine(env.st, tp.target, tp.stable, env.costBasisMethod)
+		}
+
+		// Logs would garble the dashboard, which renders everything worth knowing.
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+		return runTUICommand(env.st, engines, admin, canceller, env.w.Address(), pairs)
+	}},
+	"balances": {stage: tokensStage, action: "fetching balances", run: func(env *commandEnv) error {
+		tokens, err := env.selectedTokens()
+		if err != nil {
+			return err
+		}
+		return runBalancesCommand(env.bp, env.w, tokens)
+	}},
+	"quote": {stage: tokensStage, action: "generating quote", run: func(env *commandEnv) error {
+		tokens, err := env.selectedTokens()
+		if err != nil {
+			return err
+		}
+		return runQuoteCommand(env.r, env.tr, env.w, tokens, env.args)
+	}},
+	"swap": {stage: tokensStage, action: "swapping", run: func(env *commandEnv) error {
+		tokens, err := env.selectedTokens()
+		if err != nil {
+			return err
+		}
+		return runSwapCommand(env.r, env.tr, env.w, env.ps, env.st, tokens, env.args)
+	}},
+	"orders": {stage: tokensStage, action: "fetching orders", run: func(env *commandEnv) error {
+		return runOrdersCommand(env.r, env.tr, env.w)
+	}},
+	"cancel": {stage: tokensStage, action: "cancelling orders", run: func(env *commandEnv) error {
+		if env.ec == nil {
+			return errors.New("RPC_URL is required to cancel orders")
+		}
+		return runCancelCommand(NewOrderCanceller(env.ec, env.w, env.r), env.args)
+	}},
+}
+
+// parseCommand looks up the command named by the first argument and parses the --pair argument out of the others.
+// It returns a nil command if no arguments were given, in which case the service runs.
+func parseCommand(args []string) (*command, *commandEnv, error) {
+	env := &commandEnv{}
+	if len(args) == 0 {
+		return nil, env, nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown command: %s", args[0])
+	}
+
+	for i := 1; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "pair" {
+			env.args = append(env.args, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, nil, errors.New("--pair requires a pair name (e.g., WETH/USDC)")
+			}
+			i++
+			value = args[i]
+		}
+		env.pair = value
+	}
+	return cmd, env, nil
+}
+
+// dispatch runs the command if it runs at the given stage of startup, exiting if it fails, and reports whether it ran.
+// A nil command never runs.
+func (c *command) dispatch(stage commandStage, env *commandEnv) bool {
+	if c == nil || c.stage != stage {
+		return false
+	}
+	if err := c.run(env); err != nil {
+		log.Fatalf("Error occurred while %s: %v, exiting...", c.action, err)
+	}
+	return true
+}
+
+// runRevokeCommand sets the router allowance of each of the given tokens to zero.
+func runRevokeCommand(am ApprovalManager, tokenAddresses []string) error {
+	for _, tokenAddress := range tokenAddresses {
+		log.Infof("Revoking allowance of token %s for spender %s...", tokenAddress, am.SpenderAddress())
+		receipt, err := am.Revoke(context.TODO(), tokenAddress)
+		if err != nil {
+			return err
+		}
+		if receipt == nil {
+			log.Infof("Allowance of token %s is already zero", tokenAddress)
+			continue
+		}
+		log.Infof("Revoked allowance of token %s in transaction %s", tokenAddress, receipt.TxHash.Hex())
+	}
+	return nil
+}
+
+// runEquityCommand exports the equity curve of a wallet for a time window as CSV or JSON to stdout, one CSV row per holding.
+func runEquityCommand(es EquityStore, defaultWallet string, args []string) error {
+	fs := flag.NewFlagSet("equity", flag.ContinueOnError)
+	wallet := fs.String("wallet", defaultWallet, "wallet address to export")
+	from := fs.String("from", "", "start of the window, RFC 3339 (default: 24h before -to)")
+	to := fs.String("to", "", "end of the window, RFC 3339 (default: now)")
+	format := fs.String("format", "csv", "output format, csv or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	toTime := time.Now()
+	if *to != "" {
+		t, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return err
+		}
+		toTime = t
+	}
+
+	fromTime := toTime.Add(-24 * time.Hour)
+	if *from != "" {
+		t, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			return err
+		}
+		fromTime = t
+	}
+
+	snapshots, err := es.QuerySnapshots(*wallet, fromTime, toTime)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(snapshots)
+	case "csv":
+		cw := csv.NewWriter(os.Stdout)
+		if err := cw.Write([]string{"timestamp", "symbol", "amount", "price_usd", "value_usd", "total_value_usd"}); err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			for _, h := range s.Holdings {
+				if err := cw.Write([]string{
+					s.Timestamp.Format(time.RFC3339),
+					h.Symbol,
+					strconv.FormatFloat(h.Amount, 'f', -1, 64),
+					strconv.FormatFloat(h.Price, 'f', -1, 64),
+					strconv.FormatFloat(h.Value, 'f', -1, 64),
+					strconv.FormatFloat(s.TotalValue, 'f', -1, 64),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return errors.New("unknown output format: " + *format)
+	}
+}
+
+// ParseTokenAmount converts a decimal amount in whole token units (e.g., "0.5") to base units.
+func ParseTokenAmount(amount string, decimals int) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(amount, ".")
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+
+	value, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+	return value, nil
+}
+
+// FormatTokenAmount converts an amount in base units to a decimal amount in whole token units.
+func FormatTokenAmount(amount string, decimals int) string {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return amount
+	}
+	return new(big.Rat).SetFrac(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)).FloatString(decimals)
+}
+
+// resolveTokenArg resolves a token given by address or by the symbol of one of the configured tokens.
+func resolveTokenArg(tr TokenRegistry, configured []*Token, arg string) (*Token, error) {
+	for _, token := range configured {
+		if strings.EqualFold(token.Symbol, arg) {
+			return token, nil
+		}
+	}
+	if !common.IsHexAddress(arg) {
+		return nil, fmt.Errorf("unknown token %s, use a configured symbol or an address", arg)
+	}
+	return tr.Resolve(arg)
+}
+
+// quoteArgs resolves the <from> <to> <amount> arguments of the quote and swap commands.
+func quoteArgs(tr TokenRegistry, configured []*Token, args []string) (*Token, *Token, *big.Int, error) {
+	if len(args) != 3 {
+		return nil, nil, nil, errors.New("expected arguments: <from> <to> <amount>")
+	}
+	from, err := resolveTokenArg(tr, configured, args[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	to, err := resolveTokenArg(tr, configured, args[1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	amount, err := ParseTokenAmount(args[2], from.Decimals)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return from, to, amount, nil
+}
+
+// printQuote writes a human readable summary of the quote to stdout.
+func printQuote(from *Token, to *Token, quote *QuoteResponse) {
+	fromAmount, _ := new(big.Rat).SetString(FormatTokenAmount(quote.FromTokenAmount, from.Decimals))
+	toAmount, _ := new(big.Rat).SetString(FormatTokenAmount(quote.ToTokenAmount, to.Decimals))
+
+	fmt.Printf("Quote ID:    %s\n", quote.QuoteId)
+	fmt.Printf("From:        %s %s\n", FormatTokenAmount(quote.FromTokenAmount, from.Decimals), from.Symbol)
+	fmt.Printf("To:          %s %s\n", FormatTokenAmount(quote.ToTokenAmount, to.Decimals), to.Symbol)
+	if fromAmount != nil && toAmount != nil && fromAmount.Sign() > 0 && toAmount.Sign() > 0 {
+		fmt.Printf("Rate:        1 %s = %s %s\n", from.Symbol, new(big.Rat).Quo(toAmount, fromAmount).FloatString(8), to.Symbol)
+		fmt.Printf("             1 %s = %s %s\n", to.Symbol, new(big.Rat).Quo(fromAmount, toAmount).FloatString(8), from.Symbol)
+	}
+	if quote.MarketAmount != "" {
+		fmt.Printf("Market:      %s %s\n", FormatTokenAmount(quote.MarketAmount, to.Decimals), to.Symbol)
+		fmt.Printf("Impact:      %.4f%%\n", quote.PriceImpactPercent())
+	}
+	fmt.Printf("Fee:         %.0f bps\n", quote.Fee.Bps)
+	fmt.Printf("Preset:      %s\n", quote.RecommendedPreset)
+	if preset, err := quote.Preset(quote.RecommendedPreset); err == nil {
+		fmt.Printf("Auction:     %ds, %s => %s %s\n", preset.AuctionDuration, FormatTokenAmount(preset.AuctionStartAmount, to.Decimals), FormatTokenAmount(preset.AuctionEndAmount, to.Decimals), to.Symbol)
+		fmt.Printf("Gas Cost:    %s %s\n", FormatTokenAmount(preset.CostInDstToken, to.Decimals), to.Symbol)
+	}
+}
+
+// runBalancesCommand prints the wallet balances and router allowances of the tokens.
+func runBalancesCommand(bp BalanceProvider, w Wallet, tokens []*Token) error {
+	tokenAddresses := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		tokenAddresses = append(tokenAddresses, token.Address)
+	}
+
+	balancesAndAllowances, err := bp.BalancesAndAllowances(w.Address(), tokenAddresses)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOKEN\tBALANCE\tALLOWANCE\tADDRESS")
+	for _, token := range tokens {
+		b := balancesAndAllowances[token.Address]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", token.Symbol, FormatTokenAmount(b.Balance, token.Decimals), FormatTokenAmount(b.Allowance, token.Decimals), token.Address)
+	}
+	fmt.Fprintf(tw, "\nSource: %s, Wallet: %s\n", bp.Name(), w.Address())
+	return tw.Flush()
+}
+
+// runQuoteCommand prints a quote to swap an amount (in whole token units) of one token for another.
+func runQuoteCommand(r OneInchRouter, tr TokenRegistry, w Wallet, configured []*Token, args []string) error {
+	from, to, amount, err := quoteArgs(tr, configured, args)
+	if err != nil {
+		return err
+	}
+
+	quote, err := r.GetQuote(w.Address(), from.Address, to.Address, amount.String())
+	if err != nil {
+		return err
+	}
+
+	printQuote(from, to, quote)
+	return nil
+}
+
+// runSwapCommand quotes a swap of an amount (in whole token units) of one token for another and, once confirmed on stdin
+// (or with -yes), creates, signs and submits the Fusion order and records it in the journal. The configured tokens are the
+// target and stable tokens, in that order.
+func runSwapCommand(r OneInchRouter, tr TokenRegistry, w Wallet, ps PermitSigner, j TradeJournal, configured []*Token, args []string) error {
+	fs := flag.NewFlagSet("swap", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "submit without asking for confirmation")
+	preset := fs.String("preset", "", "auction preset (fast, medium or slow), defaults to the recommended preset")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	from, to, amount, err := quoteArgs(tr, configured, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	quote, err := r.GetQuote(w.Address(), from.Address, to.Address, amount.String())
+	if err != nil {
+		return err
+	}
+	printQuote(from, to, quote)
+	if *preset != "" {
+		if _, err := quote.Preset(*preset); err != nil {
+			return err
+		}
+		fmt.Printf("Selected:    %s\n", *preset)
+	}
+
+	if !*yes {
+		fmt.Print("\nSubmit this order? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	orderOpts := &CreateOrderOptions{Preset: *preset}
+	if _, err := SignOrderPermit(context.TODO(), ps, orderOpts, from.Address, amount); err != nil {
+		return err
+	}
+
+	order, err := r.CreateOrder(w.Address(), from.Address, to.Address, amount.String(), quote, orderOpts)
+	if err != nil {
+		return err
+	}
+
+	orderTypedDataBytes, err := json.Marshal(order.TypedData)
+	if err != nil {
+		return err
+	}
+	signature, err := w.SignEIP712Message(orderTypedDataBytes)
+	if err != nil {
+		return err
+	}
+	signatureHex := hexutil.Encode(signature)
+
+	trade := &TradeRecord{
+		ID:               order.OrderHash,
+		Pair:             fmt.Sprintf("%s/%s", from.Symbol, to.Symbol),
+		QuoteId:          quote.QuoteId,
+		OrderHash:        order.OrderHash,
+		Signature:        signatureHex,
+		FromTokenAddress: from.Address,
+		FromTokenSymbol:  from.Symbol,
+		FromTokenAmount:  amount.String(),
+		ToTokenAddress:   to.Address,
+		ToTokenSymbol:    to.Symbol,
+		ToTokenAmount:    quote.ToTokenAmount,
+		TriggerReason:    "manual swap from the command line",
+		Status:           TradeSubmitted,
+	}
+	// Journal swaps of the configured pair as buys or sells, so that they count towards the PnL of the strategy.
+	if len(configured) == 2 {
+		targetToken, stableToken := configured[0], configured[1]
+		if strings.EqualFold(from.Address, targetToken.Address) && strings.EqualFold(to.Address, stableToken.Address) {
+			trade.OrderType = SellOrder.String()
+		}
+		if strings.EqualFold(from.Address, stableToken.Address) && strings.EqualFold(to.Address, targetToken.Address) {
+			trade.Pair = fmt.Sprintf("%s/%s", to.Symbol, from.Symbol)
+			trade.OrderType = BuyOrder.String()
+		}
+	}
+
+	if err := r.SubmitOrder(signatureHex, order, quote); err != nil {
+		trade.Status = TradeSubmitFailed
+		trade.SubmitError = err.Error()
+		if err := j.RecordTrade(trade); err != nil {
+			log.Errorf("Error occurred while recording trade in journal: %v", err)
+		}
+		return err
+	}
+	if err := j.RecordTrade(trade); err != nil {
+		log.Errorf("Error occurred while recording trade in journal: %v", err)
+	}
+
+	fmt.Printf("\nSubmitted order %s\n", order.OrderHash)
+	return nil
+}
+
+// runOrdersCommand prints the Fusion orders of the wallet.
+func runOrdersCommand(r OneInchRouter, tr TokenRegistry, w Wallet) error {
+	orders, err := r.GetOrdersByMaker(w.Address())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORDER HASH\tSTATUS\tMAKING\tTAKING")
+	for _, order := range orders {
+		making := order.Order.MakingAmount + " " + order.Order.MakerAsset
+		if token, err := tr.Resolve(order.Order.MakerAsset); err == nil {
+			making = FormatTokenAmount(order.Order.MakingAmount, token.Decimals) + " " + token.Symbol
+		}
+		taking := order.Order.TakingAmount + " " + order.Order.TakerAsset
+		if token, err := tr.Resolve(order.Order.TakerAsset); err == nil {
+			taking = FormatTokenAmount(order.Order.TakingAmount, token.Decimals) + " " + token.Symbol
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", order.OrderHash, order.Status, making, taking)
+	}
+	return tw.Flush()
+}
+
+// runCancelCommand cancels the live orders with the given hashes on-chain.
+func runCancelCommand(oc OrderCanceller, orderHashes []string) error {
+	if len(orderHashes) == 0 {
+		return errors.New("expected arguments: <hash>...")
+	}
+	for _, orderHash := range orderHashes {
+		if _, err := oc.CancelOrder(context.TODO(), orderHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runApproveCommand approves the spender for each of the tokens. Without -amount, the allowance is ensured to cover the
+// current wallet balance according to the approval mode.
+func runApproveCommand(am ApprovalManager, client EthereumClient, w Wallet, defaultTokenAddresses []string, args []string) error {
+	fs := flag.NewFlagSet("approve", flag.ContinueOnError)
+	amountArg := fs.String("amount", "", "exact allowance to set, in base units (default: ensure the wallet balance is covered)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tokenAddresses := fs.Args()
+	if len(tokenAddresses) == 0 {
+		tokenAddresses = defaultTokenAddresses
+	}
+
+	for _, tokenAddress := range tokenAddresses {
+		var receipt *types.Receipt
+		if *amountArg != "" {
+			amount, ok := new(big.Int).SetString(*amountArg, 10)
+			if !ok {
+				return fmt.Errorf("invalid amount: %s", *amountArg)
+			}
+			log.Infof("Approving %s of token %s for spender %s...", amount, tokenAddress, am.SpenderAddress())
+			r, err := am.Approve(context.TODO(), tokenAddress, amount)
+			if err != nil {
+				return err
+			}
+			receipt = r
+		} else {
+			balance, err := ERC20BalanceOf(context.TODO(), client, tokenAddress, w.Address())
+			if err != nil {
+				return err
+			}
+			log.Infof("Ensuring allowance of token %s for spender %s covers balance %s...", tokenAddress, am.SpenderAddress(), balance)
+			r, err := am.EnsureAllowance(context.TODO(), tokenAddress, balance)
+			if err != nil {
+				return err
+			}
+			receipt = r
+		}
+
+		if receipt == nil {
+			log.Infof("Allowance of token %s is already sufficient", tokenAddress)
+			continue
+		}
+		log.Infof("Approved token %s in transaction %s", tokenAddress, receipt.TxHash.Hex())
+	}
+	return nil
+}
+
+// runSignTestCommand signs a personal message and an EIP-712 typed data message with the wallet, and checks that both
+// signatures recover to the wallet address. No network access is required.
+func runSignTestCommand(w Wallet) error {
+	message := []byte(fmt.Sprintf("kryptonite sign-test %d", time.Now().Unix()))
+	signature, err := w.SignPersonalMessage(message)
+	if err != nil {
+		return err
+	}
+	ok, err := VerifyPersonalMessageSignature(w.Address(), message, signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("personal_sign signature does not recover to the wallet address")
+	}
+	fmt.Printf("personal_sign: OK (%s)\n", hexutil.Encode(signature))
+
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"Test": {
+				{Name: "message", Type: "string"},
+			},
+		},
+		PrimaryType: "Test",
+		Domain: apitypes.TypedDataDomain{
+			Name:    "kryptonite",
+			ChainId: (*math.HexOrDecimal256)(parseChainID(w.ChainID())),
+		},
+		Message: apitypes.TypedDataMessage{
+			"message": string(message),
+		},
+	}
+	signature, err = w.SignTypedData(typedData)
+	if err != nil {
+		return err
+	}
+	ok, err = VerifyTypedDataSignature(w.Address(), typedData, signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("EIP-712 signature does not recover to the wallet address")
+	}
+	fmt.Printf("EIP-712:       OK (%s)\n", hexutil.Encode(signature))
+
+	fmt.Printf("Wallet:        %s (chain %s)\n", w.Address(), w.ChainID())
+	return nil
+}
+
+// parseChainID parses a decimal chain ID, returning zero if it is invalid.
+func parseChainID(chainId string) *big.Int {
+	id, ok := new(big.Int).SetString(chainId, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return id
+}
+
+// runConfigCommand runs a config subcommand. Only "validate" is supported.
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return errors.New("expected subcommand: validate")
+	}
+
+	errs := ValidateConfig()
+	if len(errs) == 0 {
+		fmt.Println("Configuration is valid")
+		return nil
+	}
+	for _, err := range errs {
+		fmt.Printf("✗ %v\n", err)
+	}
+	return fmt.Errorf("configuration has %d error(s)", len(errs))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCmd  string
+		wantPair string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{name: "service"},
+		{name: "no arguments", args: []string{"balances"}, wantCmd: "balances"},
+		{name: "pair flag", args: []string{"balances", "--pair", "WETH/USDC"}, wantCmd: "balances", wantPair: "WETH/USDC"},
+		{name: "pair flag with value", args: []string{"quote", "-pair=WETH/USDC", "WETH", "USDC", "1"}, wantCmd: "quote", wantPair: "WETH/USDC", wantArgs: []string{"WETH", "USDC", "1"}},
+		{name: "pair flag between arguments", args: []string{"swap", "-from", "WETH", "--pair", "WETH/USDC", "-amount", "1"}, wantCmd: "swap", wantPair: "WETH/USDC", wantArgs: []string{"-from", "WETH", "-amount", "1"}},
+		{name: "other flags kept", args: []string{"equity", "-wallet", testAddress}, wantCmd: "equity", wantArgs: []string{"-wallet", testAddress}},
+		{name: "missing pair", args: []string{"balances", "--pair"}, wantErr: true},
+		{name: "unknown command", args: []string{"withdraw"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, env, err := parseCommand(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parsed, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCommand: %v", err)
+			}
+			if tt.wantCmd == "" {
+				if cmd != nil {
+					t.Errorf("command = %+v, want the service", cmd)
+				}
+				return
+			}
+			if cmd != commands[tt.wantCmd] {
+				t.Errorf("command = %+v, want %s", cmd, tt.wantCmd)
+			}
+			if env.pair != tt.wantPair || !slices.Equal(env.args, tt.wantArgs) {
+				t.Errorf("pair = %q, args = %q, want %q and %q", env.pair, env.args, tt.wantPair, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestCommandEnvSelectedPair(t *testing.T) {
+	env := &commandEnv{pairs: []tradedPair{
+		{config: PairConfig{Target: TokenConfig{Address: testWBTC.Address}, Stable: TokenConfig{Address: testUSDC.Address}}, target: testWBTC, stable: testUSDC},
+		{config: PairConfig{Target: TokenConfig{Address: testWETH.Address}, Stable: TokenConfig{Address: testUSDC.Address}}, target: testWETH, stable: testUSDC},
+	}}
+
+	tests := []struct {
+		pair          string
+		wantTarget    *Token
+		wantAddresses []string
+		wantErr       bool
+	}{
+		{wantTarget: testWBTC, wantAddresses: []string{testWBTC.Address, testUSDC.Address, testWETH.Address}},
+		{pair: "weth/usdc", wantTarget: testWETH, wantAddresses: []string{testWETH.Address, testUSDC.Address}},
+		{pair: "LINK/USDC", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pair, func(t *testing.T) {
+			env.pair = tt.pair
+			tokens, err := env.selectedTokens()
+			addresses, addressesErr := env.selectedTokenAddresses()
+			if tt.wantErr {
+				if err == nil || addressesErr == nil {
+					t.Errorf("selected %v and %v, want an error", tokens, addresses)
+				}
+				return
+			}
+			if err != nil || addressesErr != nil {
+				t.Fatalf("selectedTokens: %v, selectedTokenAddresses: %v", err, addressesErr)
+			}
+			if tokens[0] != tt.wantTarget || tokens[1] != testUSDC {
+				t.Errorf("tokens = %s/%s, want %s/USDC", tokens[0].Symbol, tokens[1].Symbol, tt.wantTarget.Symbol)
+			}
+			if !slices.Equal(addresses, tt.wantAddresses) {
+				t.Errorf("token addresses = %v, want %v", addresses, tt.wantAddresses)
+			}
+		})
+	}
+}
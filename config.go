@@ -0,0 +1,213 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ValidateConfig checks the environment configuration without connecting to any service, and returns every problem found.
+func ValidateConfig() []error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	required := func(name string) string {
+		value := os.Getenv(name)
+		if value == "" {
+			check(fmt.Errorf("%s is required", name))
+		}
+		return value
+	}
+
+	address := func(name string) {
+		if value := required(name); value != "" && !common.IsHexAddress(value) {
+			check(fmt.Errorf("%s is not a valid address: %s", name, value))
+		}
+	}
+
+	integer := func(name string) {
+		if value := os.Getenv(name); value != "" {
+			if _, err := strconv.Atoi(value); err != nil {
+				check(fmt.Errorf("%s is not an integer: %s", name, value))
+			}
+		}
+	}
+
+	duration := func(name string) {
+		if value := os.Getenv(name); value != "" {
+			if _, err := time.ParseDuration(value); err != nil {
+				check(fmt.Errorf("%s is not a valid duration: %v", name, err))
+			}
+		}
+	}
+
+	amount := func(name string) {
+		if value := os.Getenv(name); value != "" {
+			if _, ok := new(big.Int).SetString(value, 10); !ok {
+				check(fmt.Errorf("%s is not a valid amount in base units: %s", name, value))
+			}
+		}
+	}
+
+	chainId := required("CHAIN_ID")
+	integer("CHAIN_ID")
+	address("WALLET_ADDRESS")
+	if privateKeyHex := required("WALLET_PRIVATE_KEY_HEX"); privateKeyHex != "" {
+		_, err := NewWallet(privateKeyHex, os.Getenv("WALLET_ADDRESS"), chainId)
+		check(err)
+	}
+	address("ROUTER_CONTRACT_ADDRESS")
+
+	pairsJSON := os.Getenv("PAIRS")
+	if pairsJSON == "" {
+		for _, prefix := range []string{"TARGET_TOKEN", "STABLE_TOKEN"} {
+			address(prefix + "_ADDRESS")
+			required(prefix + "_SYMBOL")
+			integer(prefix + "_DECIMALS")
+			amount(prefix + "_APPROVAL_CAP")
+		}
+	}
+	pairConfigs, err := ParsePairConfigs(pairsJSON, PairConfig{ChainlinkAggregatorAddress: os.Getenv("CHAINLINK_AGGREGATOR_ADDRESS")})
+	if err != nil {
+		check(fmt.Errorf("PAIRS is not a valid JSON array of pairs: %v", err))
+	}
+	if pairsJSON != "" {
+		for _, pc := range pairConfigs {
+			for _, tc := range []TokenConfig{pc.Target, pc.Stable} {
+				if !common.IsHexAddress(tc.Address) {
+					check(fmt.Errorf("PAIRS token address is not a valid address: %s", tc.Address))
+				}
+				if _, ok := new(big.Int).SetString(cmp.Or(tc.ApprovalCap, "0"), 10); !ok {
+					check(fmt.Errorf("PAIRS approval cap of token %s is not a valid amount in base units: %s", tc.Address, tc.ApprovalCap))
+				}
+				if _, err := strconv.Atoi(cmp.Or(tc.Decimals, "0")); err != nil {
+					check(fmt.Errorf("PAIRS decimals of token %s is not an integer: %s", tc.Address, tc.Decimals))
+				}
+			}
+		}
+	}
+
+	rpcUrl := os.Getenv("RPC_URL")
+
+	_, err = ParseApprovalMode(os.Getenv("APPROVAL_MODE"))
+	check(err)
+	if resetTokens := os.Getenv("APPROVAL_RESET_TOKENS"); resetTokens != "" {
+		for _, tokenAddress := range strings.Split(resetTokens, ",") {
+			if !common.IsHexAddress(tokenAddress) {
+				check(fmt.Errorf("APPROVAL_RESET_TOKENS contains an invalid address: %s", tokenAddress))
+			}
+		}
+	}
+
+	permitMode, err := ParsePermitMode(os.Getenv("PERMIT_MODE"))
+	check(err)
+	if err == nil && permitMode != NoPermit && rpcUrl == "" {
+		check(fmt.Errorf("RPC_URL is required for permit mode %s", permitMode))
+	}
+
+	_, err = ParseCostBasisMethod(os.Getenv("COST_BASIS_METHOD"))
+	check(err)
+
+	switch balanceSource := os.Getenv("BALANCE_SOURCE"); balanceSource {
+	case "", "1inch":
+	case "rpc", "both":
+		if rpcUrl == "" {
+			check(fmt.Errorf("RPC_URL is required for balance source %s", balanceSource))
+		}
+	default:
+		check(fmt.Errorf("unknown balance source: %s", balanceSource))
+	}
+
+	switch oneInchApi := os.Getenv("ONEINCH_API"); oneInchApi {
+	case "", "proxy":
+	case "dev":
+		required("ONEINCH_API_KEY")
+	default:
+		check(fmt.Errorf("unknown 1inch API: %s", oneInchApi))
+	}
+
+	switch priceReference := os.Getenv("PRICE_REFERENCE"); priceReference {
+	case "", "quote", "spot":
+	case "chainlink":
+		if rpcUrl == "" {
+			check(fmt.Errorf("RPC_URL is required for price reference %s", priceReference))
+		}
+		for _, pc := range pairConfigs {
+			if !common.IsHexAddress(pc.ChainlinkAggregatorAddress) {
+				check(fmt.Errorf("chainlink aggregator address is not a valid address: %q", pc.ChainlinkAggregatorAddress))
+			}
+		}
+	default:
+		check(fmt.Errorf("unknown price reference: %s", priceReference))
+	}
+
+	switch stateStore := os.Getenv("STATE_STORE"); stateStore {
+	case "", "redis":
+		required("REDIS_HOST")
+		required("REDIS_PORT")
+	case "bolt", "memory":
+	default:
+		check(fmt.Errorf("unknown state store: %s", stateStore))
+	}
+
+	for _, name := range []string{"PERMIT_TTL", "EQUITY_SNAPSHOT_INTERVAL", "LEADER_LEASE_TTL", "HEALTH_TICK_GRACE", "WEBHOOK_DEDUPE_WINDOW", "ERROR_WINDOW", "CHAINLINK_MAX_AGE", "POLL_INTERVAL", "FAST_POLL_INTERVAL", "SUBMIT_COOLDOWN", "FILL_COOLDOWN", "FAILURE_COOLDOWN", "BALANCE_CACHE_TTL"} {
+		duration(name)
+	}
+
+	integer("WEBHOOK_MAX_RETRIES")
+	integer("RISK_MAX_TRADES_PER_DAY")
+	integer("ERROR_THRESHOLD")
+	if _, err := ParseWebhookConfigs(os.Getenv("WEBHOOKS")); err != nil {
+		check(fmt.Errorf("WEBHOOKS is not a valid JSON array of webhooks: %v", err))
+	}
+	for _, name := range []string{"LOW_BALANCE_THRESHOLD", "BALANCE_TOLERANCE_PERCENT", "RISK_MAX_TRADE_NOTIONAL", "RISK_MAX_DAILY_VOLUME", "RISK_MAX_DAILY_LOSS", "REFERENCE_QUOTE_NOTIONAL", "PRICE_MAX_DEVIATION_PERCENT", "MAX_PRICE_IMPACT_PERCENT", "APPROACH_PERCENT"} {
+		if value := os.Getenv(name); value != "" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				check(fmt.Errorf("%s is not a number: %s", name, value))
+			}
+		}
+	}
+
+	customPreset, err := ParseCustomPreset(os.Getenv("CUSTOM_PRESET_AUCTION_DURATION"), os.Getenv("CUSTOM_PRESET_START_PERCENT"), os.Getenv("CUSTOM_PRESET_END_PERCENT"))
+	if err != nil {
+		check(fmt.Errorf("custom preset is invalid: %v", err))
+	} else {
+		_, err := NewPresetPolicy(map[TradeUrgency]string{
+			NormalUrgency:     os.Getenv("PRESET_NORMAL"),
+			StopLossUrgency:   os.Getenv("PRESET_STOP_LOSS"),
+			TakeProfitUrgency: os.Getenv("PRESET_TAKE_PROFIT"),
+			FlattenUrgency:    os.Getenv("PRESET_FLATTEN"),
+		}, customPreset)
+		check(err)
+	}
+
+	if _, err := ParseQuietHours(os.Getenv("QUIET_HOURS")); err != nil {
+		check(err)
+	}
+	if tz := os.Getenv("QUIET_HOURS_TIMEZONE"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			check(fmt.Errorf("QUIET_HOURS_TIMEZONE is not a valid time zone: %v", err))
+		}
+	}
+	if _, err := ParseScheduleConfigs(os.Getenv("SCHEDULES"), ScheduleConfig{PollInterval: time.Second, FastPollInterval: time.Second}); err != nil {
+		check(fmt.Errorf("SCHEDULES is not a valid JSON object of schedules: %v", err))
+	}
+
+	if tz := os.Getenv("TZ"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			check(fmt.Errorf("TZ is not a valid time zone: %v", err))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenHolding is the valuation of the wallet balance of a token.
+type TokenHolding struct {
+	// Symbol is the ticker symbol of the token.
+	Symbol string `json:"symbol"`
+
+	// Address is the contract address of the token.
+	Address string `json:"address"`
+
+	// Balance is the token balance, in base units.
+	Balance string `json:"balance"`
+
+	// Amount is the token balance, in whole tokens.
+	Amount float64 `json:"amount"`
+
+	// Price is the USD price of one token.
+	Price float64 `json:"price"`
+
+	// Value is the USD value of the balance.
+	Value float64 `json:"value"`
+}
+
+// EquitySnapshot is a point-in-time valuation in USD of the distinct tokens held by the wallet across all pairs, so that
+// a token shared by several pairs (e.g., USDC) is counted once.
+type EquitySnapshot struct {
+	// Wallet is the address of the wallet.
+	Wallet string `json:"wallet"`
+
+	// Timestamp is when the snapshot was taken.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Holdings are the valued token balances, ordered by symbol.
+	Holdings []TokenHolding `json:"holdings"`
+
+	// TotalValue is the USD value of all holdings.
+	TotalValue float64 `json:"totalValue"`
+}
+
+// Holding returns the holding of the token with the symbol, or nil if the wallet does not track it.
+func (s *EquitySnapshot) Holding(symbol string) *TokenHolding {
+	for i := range s.Holdings {
+		if strings.EqualFold(s.Holdings[i].Symbol, symbol) {
+			return &s.Holdings[i]
+		}
+	}
+	return nil
+}
+
+// WalletEquity values the distinct tokens of all pairs held by the wallet. Each pair worker updates the balances and
+// USD prices of its tokens, and a snapshot is only available once every token has been valued.
+type WalletEquity struct {
+	// wallet is the address of the wallet.
+	wallet string
+
+	// tokens are the distinct tokens of the pairs, keyed by lowercase address.
+	tokens map[string]*Token
+
+	// mu guards holdings and lastRecorded.
+	mu sync.Mutex
+
+	// holdings are the latest valuations of the tokens, keyed by lowercase address.
+	holdings map[string]TokenHolding
+
+	// lastRecorded is when a snapshot was last claimed for recording.
+	lastRecorded time.Time
+}
+
+// Update values the balance (in base units) of the token at its USD price.
+func (we *WalletEquity) Update(token *Token, balance string, price float64) error {
+	key := strings.ToLower(token.Address)
+	if _, ok := we.tokens[key]; !ok {
+		return fmt.Errorf("token %s is not traded by any pair", token.Symbol)
+	}
+	if price <= 0 {
+		return fmt.Errorf("invalid USD price of %s: %f", token.Symbol, price)
+	}
+
+	amount, err := strconv.ParseFloat(balance, 64)
+	if err != nil {
+		return err
+	}
+	amount /= math.Pow(10, float64(token.Decimals))
+
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	we.holdings[key] = TokenHolding{
+		Symbol:  token.Symbol,
+		Address: token.Address,
+		Balance: balance,
+		Amount:  amount,
+		Price:   price,
+		Value:   amount * price,
+	}
+	return nil
+}
+
+// Snapshot values the latest holdings, or returns nil until every token has been valued.
+func (we *WalletEquity) Snapshot() *EquitySnapshot {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	if len(we.holdings) < len(we.tokens) {
+		return nil
+	}
+
+	snapshot := &EquitySnapshot{
+		Wallet:    we.wallet,
+		Timestamp: time.Now(),
+		Holdings:  make([]TokenHolding, 0, len(we.holdings)),
+	}
+	for _, holding := range we.holdings {
+		snapshot.Holdings = append(snapshot.Holdings, holding)
+		snapshot.TotalValue += holding.Value
+	}
+	sort.Slice(snapshot.Holdings, func(i, j int) bool {
+		return snapshot.Holdings[i].Symbol < snapshot.Holdings[j].Symbol
+	})
+	return snapshot
+}
+
+// ClaimRecording reports whether a snapshot taken at the time is due for recording, at most once per interval across
+// the pair workers.
+func (we *WalletEquity) ClaimRecording(at time.Time, interval time.Duration) bool {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	if at.Sub(we.lastRecorded) < interval {
+		return false
+	}
+	we.lastRecorded = at
+	return true
+}
+
+// NewWalletEquity creates a new WalletEquity valuing the distinct tokens held by the wallet.
+func NewWalletEquity(wallet string, tokens []*Token) *WalletEquity {
+	we := &WalletEquity{
+		wallet:   wallet,
+		tokens:   make(map[string]*Token, len(tokens)),
+		holdings: make(map[string]TokenHolding, len(tokens)),
+	}
+	for _, token := range tokens {
+		we.tokens[strings.ToLower(token.Address)] = token
+	}
+	return we
+}
+
+// EquityStore persists equity snapshots as a time series.
+type EquityStore interface {
+	// RecordSnapshot appends the snapshot to the time series of its wallet.
+	RecordSnapshot(snapshot *EquitySnapshot) error
+
+	// QuerySnapshots returns the snapshots of the wallet taken within [from, to], oldest first.
+	QuerySnapshots(wallet string, from time.Time, to time.Time) ([]*EquitySnapshot, error)
+}
+
+// redisEquityStore implements the EquityStore interface with a Redis sorted set per wallet scored by timestamp.
+type redisEquityStore struct {
+	// rdb is the Redis client.
+	rdb *redis.Client
+}
+
+// equityKey returns the Redis key of the sorted set holding the snapshots of the wallet.
+func equityKey(wallet string) string {
+	return fmt.Sprintf("EQUITY:%s", strings.ToLower(wallet))
+}
+
+// RecordSnapshot appends the snapshot to the time series of its wallet.
+func (s *redisEquityStore) RecordSnapshot(snapshot *EquitySnapshot) error {
+	member, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.ZAdd(context.TODO(), equityKey(snapshot.Wallet), redis.Z{
+		Score:  float64(snapshot.Timestamp.UnixMilli()),
+		Member: member,
+	}).Err()
+}
+
+// QuerySnapshots returns the snapshots of the wallet taken within [from, to], oldest first.
+func (s *redisEquityStore) QuerySnapshots(wallet string, from time.Time, to time.Time) ([]*EquitySnapshot, error) {
+	members, err := s.rdb.ZRangeByScore(context.TODO(), equityKey(wallet), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*EquitySnapshot, 0, len(members))
+	for _, member := range members {
+		var snapshot EquitySnapshot
+		if err := json.Unmarshal([]byte(member), &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// NewRedisEquityStore creates a new EquityStore backed by Redis.
+func NewRedisEquityStore(rdb *redis.Client) EquityStore {
+	return &redisEquityStore{
+		rdb: rdb,
+	}
+}
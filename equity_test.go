@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	testWBTC = &Token{Address: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599", Symbol: "WBTC", Decimals: 8}
+	testWETH = &Token{Address: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", Symbol: "WETH", Decimals: 18}
+	testUSDC = &Token{Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Symbol: "USDC", Decimals: 6}
+)
+
+func TestWalletEquityCountsSharedTokensOnce(t *testing.T) {
+	// Both pairs hold the same USDC balance, as reported by each pair worker.
+	we := NewWalletEquity(testAddress, []*Token{testWBTC, testUSDC, testWETH, testUSDC})
+
+	if err := we.Update(testWBTC, "50000000", 60_000); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := we.Update(testUSDC, "1000000000", 0.998); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if snapshot := we.Snapshot(); snapshot != nil {
+		t.Fatalf("snapshot %+v before every token was valued", snapshot)
+	}
+
+	if err := we.Update(testWETH, "2000000000000000000", 3_000); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := we.Update(testUSDC, "1000000000", 0.998); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	snapshot := we.Snapshot()
+	if snapshot == nil {
+		t.Fatal("no snapshot once every token was valued")
+	}
+	if len(snapshot.Holdings) != 3 {
+		t.Fatalf("holdings = %+v, want WBTC, WETH and USDC once", snapshot.Holdings)
+	}
+	for i, symbol := range []string{"USDC", "WBTC", "WETH"} {
+		if snapshot.Holdings[i].Symbol != symbol {
+			t.Errorf("holding %d = %s, want %s", i, snapshot.Holdings[i].Symbol, symbol)
+		}
+	}
+
+	// 0.5 WBTC at 60000 USD, 2 WETH at 3000 USD and 1000 USDC at 0.998 USD.
+	if want := 30_000 + 6_000 + 998.0; !approxEqual(snapshot.TotalValue, want) {
+		t.Errorf("total value = %f, want %f", snapshot.TotalValue, want)
+	}
+	if usdc := snapshot.Holding("usdc"); usdc == nil || !approxEqual(usdc.Amount, 1_000) || !approxEqual(usdc.Value, 998) {
+		t.Errorf("USDC holding = %+v", usdc)
+	}
+	if snapshot.Wallet != testAddress {
+		t.Errorf("wallet = %s, want %s", snapshot.Wallet, testAddress)
+	}
+}
+
+func TestWalletEquityRejectsInvalidUpdates(t *testing.T) {
+	we := NewWalletEquity(testAddress, []*Token{testWBTC, testUSDC})
+
+	if err := we.Update(testWETH, "1", 3_000); err == nil {
+		t.Error("valued a token not traded by any pair")
+	}
+	if err := we.Update(testUSDC, "1000000", 0); err == nil {
+		t.Error("valued a token without a USD price")
+	}
+	if err := we.Update(testUSDC, "lots", 1); err == nil {
+		t.Error("valued an invalid balance")
+	}
+}
+
+func TestWalletEquityClaimRecording(t *testing.T) {
+	we := NewWalletEquity(testAddress, []*Token{testUSDC})
+	now := time.Now()
+
+	if !we.ClaimRecording(now, time.Hour) {
+		t.Error("first snapshot not due")
+	}
+	if we.ClaimRecording(now.Add(30*time.Minute), time.Hour) {
+		t.Error("snapshot due within the interval")
+	}
+	if !we.ClaimRecording(now.Add(time.Hour), time.Hour) {
+		t.Error("snapshot not due after the interval")
+	}
+}
+
+func TestPairPrice(t *testing.T) {
+	snapshot := &EquitySnapshot{Holdings: []TokenHolding{
+		{Symbol: "USDC", Price: 0.998},
+		{Symbol: "WBTC", Price: 59_880},
+	}}
+
+	if price := pairPrice(snapshot, "WBTC/USDC"); !approxEqual(price, 60_000) {
+		t.Errorf("WBTC/USDC price = %f, want 60000", price)
+	}
+	if price := pairPrice(snapshot, "WETH/USDC"); price != 0 {
+		t.Errorf("WETH/USDC price = %f, want 0 without a WETH holding", price)
+	}
+}
+
+func approxEqual(a float64, b float64) bool {
+	d := a - b
+	return d < 1e-6 && d > -1e-6
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// erc20ABIJSON is the subset of the ERC-20 ABI used by the service.
+const erc20ABIJSON = `[
+	{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+// erc20ABI is the parsed ERC-20 ABI.
+var erc20ABI = mustParseABI(erc20ABIJSON)
+
+// mustParseABI parses a JSON encoded contract ABI and panics if it is invalid.
+func mustParseABI(abiJSON string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// errEmptyResponse is returned by callContract when the contract returns no data, as accounts without code do.
+var errEmptyResponse = errors.New("empty response from contract")
+
+// callContract packs the method call, executes it against the latest block and unpacks the result.
+func callContract(ctx context.Context, client EthereumClient, contractABI abi.ABI, contractAddress string, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	to := common.HexToAddress(contractAddress)
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output) == 0 {
+		return nil, fmt.Errorf("%w %s for %s", errEmptyResponse, contractAddress, method)
+	}
+
+	return contractABI.Unpack(method, output)
+}
+
+// ERC20Allowance returns the amount of the token that the spender is allowed to transfer on behalf of the owner.
+func ERC20Allowance(ctx context.Context, client EthereumClient, tokenAddress string, ownerAddress string, spenderAddress string) (*big.Int, error) {
+	out, err := callContract(ctx, client, erc20ABI, tokenAddress, "allowance", common.HexToAddress(ownerAddress), common.HexToAddress(spenderAddress))
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// ERC20BalanceOf returns the token balance of the owner.
+func ERC20BalanceOf(ctx context.Context, client EthereumClient, tokenAddress string, ownerAddress string) (*big.Int, error) {
+	out, err := callContract(ctx, client, erc20ABI, tokenAddress, "balanceOf", common.HexToAddress(ownerAddress))
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// EthereumClient defines the subset of the Ethereum JSON-RPC API used by the service.
+// It is satisfied by *ethclient.Client as well as the go-ethereum simulated backend client.
+type EthereumClient interface {
+	bind.ContractBackend
+	bind.DeployBackend
+}
+
+// Transactor builds, signs and broadcasts transactions on behalf of a wallet.
+type Transactor interface {
+	// SendTransaction sends a dynamic fee transaction with the given calldata to the contract and waits for its receipt.
+	SendTransaction(ctx context.Context, to string, data []byte) (*types.Receipt, error)
+}
+
+// transactor implements the Transactor interface.
+type transactor struct {
+	// client is the Ethereum JSON-RPC client used to broadcast transactions.
+	client EthereumClient
+
+	// wallet is the wallet used to sign transactions.
+	wallet Wallet
+}
+
+// SendTransaction sends a dynamic fee transaction with the given calldata to the contract and waits for its receipt.
+func (t *transactor) SendTransaction(ctx context.Context, to string, data []byte) (*types.Receipt, error) {
+	from := common.HexToAddress(t.wallet.Address())
+	toAddress := common.HexToAddress(to)
+
+	nonce, err := t.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	gasLimit, err := t.client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &toAddress, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	gasTipCap, err := t.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := t.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if head.BaseFee == nil {
+		return nil, errors.New("chain does not support dynamic fee transactions")
+	}
+
+	// Allow the base fee to double before the transaction becomes unmineable.
+	gasFeeCap := new(big.Int).Add(gasTipCap, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+
+	chainId, ok := new(big.Int).SetString(t.wallet.ChainID(), 10)
+	if !ok {
+		return nil, errors.New("invalid chain id: " + t.wallet.ChainID())
+	}
+
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainId,
+		Nonce:     nonce,
+		GasTipCap: gasTipCap,
+		GasFeeCap: gasFeeCap,
+		Gas:       gasLimit * 120 / 100, // with 20% buffer
+		To:        &toAddress,
+		Data:      data,
+	})
+
+	signedTx, err := t.wallet.SignTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, err
+	}
+
+	receipt, err := bind.WaitMined(ctx, t.client, signedTx)
+	if err != nil {
+		return nil, err
+	}
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, errors.New("transaction reverted: " + signedTx.Hash().Hex())
+	}
+
+	return receipt, nil
+}
+
+// NewTransactor creates a new Transactor that signs with the given wallet and broadcasts through the given client.
+func NewTransactor(client EthereumClient, w Wallet) Transactor {
+	return &transactor{
+		client: client,
+		wallet: w,
+	}
+}
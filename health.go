@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReadinessCheck probes a dependency of the service, returning an error if it is not usable.
+type ReadinessCheck func() error
+
+// HealthResponse is the JSON body of the /healthz endpoint.
+type HealthResponse struct {
+	// Status is "ok" if every loop is ticking, "stalled" otherwise.
+	Status string `json:"status"`
+
+	// Loops maps each loop name to its liveness.
+	Loops map[string]*LoopHealth `json:"loops"`
+}
+
+// LoopHealth is the liveness of one loop (e.g., the trading loop of a pair).
+type LoopHealth struct {
+	// Status is "ok" if the loop is ticking, "stalled" otherwise.
+	Status string `json:"status"`
+
+	// LastTick is when the loop last completed an iteration.
+	LastTick time.Time `json:"lastTick"`
+
+	// LastTickAge is the time elapsed since the last tick, in seconds.
+	LastTickAge float64 `json:"lastTickAgeSeconds"`
+
+	// NextTickDue is when the loop is expected to complete its next iteration.
+	NextTickDue time.Time `json:"nextTickDue"`
+}
+
+// loopTicks are the tick times of one loop.
+type loopTicks struct {
+	// lastTick is when the loop last completed an iteration.
+	lastTick time.Time
+
+	// nextTickDue is when the loop is expected to complete its next iteration.
+	nextTickDue time.Time
+}
+
+// ReadinessResponse is the JSON body of the /readyz endpoint.
+type ReadinessResponse struct {
+	// Status is "ready" if every check passed, "not_ready" otherwise.
+	Status string `json:"status"`
+
+	// Checks maps each check name to "ok" or its error message.
+	Checks map[string]string `json:"checks"`
+}
+
+// HealthMonitor tracks the liveness of the trading loops and the readiness of their dependencies.
+type HealthMonitor struct {
+	// mu guards the fields below.
+	mu sync.Mutex
+
+	// loops are the tick times of the watched loops, keyed by name.
+	loops map[string]*loopTicks
+
+	// grace is how long a loop may overrun its nextTickDue before it is considered stalled.
+	grace time.Duration
+
+	// checks are the readiness probes, keyed by name.
+	checks map[string]ReadinessCheck
+
+	// reports are the readiness results reported by the loop, keyed by name.
+	reports map[string]error
+}
+
+// errNotChecked is reported for expected readiness results the loop has not reported yet.
+var errNotChecked = errors.New("not checked yet")
+
+// Watch registers a loop, which is given the grace period to complete its first iteration.
+func (h *HealthMonitor) Watch(loop string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.loops[loop] = &loopTicks{lastTick: now, nextTickDue: now}
+}
+
+// Tick records that the loop completed an iteration and will complete the next one within the given duration.
+func (h *HealthMonitor) Tick(loop string, next time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.loops[loop] = &loopTicks{lastTick: now, nextTickDue: now.Add(next)}
+}
+
+// AddCheck registers a readiness probe, run on every /readyz request.
+func (h *HealthMonitor) AddCheck(name string, check ReadinessCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = check
+}
+
+// Expect registers a readiness result that the loop reports with Report. It fails until the first report.
+func (h *HealthMonitor) Expect(name string) {
+	h.Report(name, errNotChecked)
+}
+
+// Report records the readiness result of a check performed by the loop.
+func (h *HealthMonitor) Report(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.reports[name] = err
+}
+
+// Health returns the liveness of the loops. It is unhealthy if any loop overran its next tick by more than the grace period.
+func (h *HealthMonitor) Health() (*HealthResponse, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	ok := true
+	response := &HealthResponse{
+		Status: "ok",
+		Loops:  make(map[string]*LoopHealth, len(h.loops)),
+	}
+	for name, ticks := range h.loops {
+		loop := &LoopHealth{
+			Status:      "ok",
+			LastTick:    ticks.lastTick,
+			LastTickAge: now.Sub(ticks.lastTick).Seconds(),
+			NextTickDue: ticks.nextTickDue,
+		}
+		if !now.Before(ticks.nextTickDue.Add(h.grace)) {
+			ok = false
+			loop.Status = "stalled"
+		}
+		response.Loops[name] = loop
+	}
+	if !ok {
+		response.Status = "stalled"
+	}
+
+	return response, ok
+}
+
+// Readiness runs the readiness probes and collects the reported results.
+func (h *HealthMonitor) Readiness() (*ReadinessResponse, bool) {
+	h.mu.Lock()
+	checks := make(map[string]ReadinessCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	results := make(map[string]error, len(h.reports)+len(checks))
+	for name, err := range h.reports {
+		results[name] = err
+	}
+	h.mu.Unlock()
+
+	// Probes may do I/O, run them without holding the lock.
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		results[name] = checks[name]()
+	}
+
+	ok := true
+	response := &ReadinessResponse{
+		Status: "ready",
+		Checks: make(map[string]string, len(results)),
+	}
+	for name, err := range results {
+		if err != nil {
+			ok = false
+			response.Checks[name] = err.Error()
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+	if !ok {
+		response.Status = "not_ready"
+	}
+
+	return response, ok
+}
+
+// HealthHandler serves the liveness of the loops as JSON, with status 503 if any of them is stalled.
+func (h *HealthMonitor) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		response, ok := h.Health()
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+// ReadinessHandler serves the readiness of the dependencies as JSON, with status 503 if any check failed.
+func (h *HealthMonitor) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		response, ok := h.Readiness()
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+// NewHealthMonitor creates a new HealthMonitor with no loops watched.
+func NewHealthMonitor(grace time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		loops:   make(map[string]*loopTicks),
+		grace:   grace,
+		checks:  make(map[string]ReadinessCheck),
+		reports: make(map[string]error),
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/redis/go-redis/v9"
+)
+
+// IntentStatus is the lifecycle status of a trade intent.
+type IntentStatus string
+
+const (
+	// IntentPending means an order was persisted for the intent but the submission outcome is unknown.
+	IntentPending IntentStatus = "pending"
+
+	// IntentSubmitted means the relayer accepted the order of the intent.
+	IntentSubmitted IntentStatus = "submitted"
+
+	// IntentFailed means the relayer rejected the order of the intent, so a new one may be created.
+	IntentFailed IntentStatus = "failed"
+
+	// IntentCompleted means the order of the intent was filled.
+	IntentCompleted IntentStatus = "completed"
+)
+
+// TradeIntent is the decision to swap a given amount of one token for another. Its ID is derived
+// deterministically from the swap and the price monitor generation, so that retries after a timeout or a restart
+// map to the same intent, while the same swap in a later buy/sell cycle maps to a new one.
+type TradeIntent struct {
+	// ID is the deterministic identifier of the intent.
+	ID string `json:"id"`
+
+	// Pair is the traded pair (e.g., "WBTC/USDC").
+	Pair string `json:"pair"`
+
+	// FromTokenAddress is the address of the token sold.
+	FromTokenAddress string `json:"fromTokenAddress"`
+
+	// ToTokenAddress is the address of the token bought.
+	ToTokenAddress string `json:"toTokenAddress"`
+
+	// FromTokenAmount is the amount of the token sold, in base units.
+	FromTokenAmount string `json:"fromTokenAmount"`
+
+	// Generation is the price monitor generation the intent was created in.
+	Generation int `json:"generation"`
+
+	// OrderHash is the hash of the most recent order created for the intent.
+	OrderHash string `json:"orderHash"`
+
+	// Salt is the salt of the most recent order created for the intent, which identifies it even if the relayer
+	// reports the order under another hash.
+	Salt string `json:"salt"`
+
+	// Status is the lifecycle status of the intent.
+	Status IntentStatus `json:"status"`
+
+	// Attempts is the number of orders created for the intent.
+	Attempts int `json:"attempts"`
+
+	// CreatedAt is when the intent was first persisted.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// UpdatedAt is when the intent was last updated.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TradeIntentID derives the deterministic identifier of the intent to swap the amount of one token for another from the wallet
+// in the given price monitor generation.
+func TradeIntentID(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string, generation int) string {
+	key := strings.ToLower(strings.Join([]string{walletAddress, fromTokenAddress, toTokenAddress, fromTokenAmount, strconv.Itoa(generation)}, ":"))
+	return crypto.Keccak256Hash([]byte(key)).Hex()
+}
+
+// IntentStore persists trade intents.
+type IntentStore interface {
+	// GetIntent returns the intent with the given ID, or nil if it does not exist.
+	GetIntent(id string) (*TradeIntent, error)
+
+	// SaveIntent inserts or updates the intent.
+	SaveIntent(intent *TradeIntent) error
+}
+
+// touchIntent sets the creation and update timestamps of the intent before it is stored.
+func touchIntent(intent *TradeIntent) {
+	now := time.Now()
+	if intent.CreatedAt.IsZero() {
+		intent.CreatedAt = now
+	}
+	intent.UpdatedAt = now
+}
+
+// redisIntentStore implements the IntentStore interface with a JSON encoded Redis string per intent.
+type redisIntentStore struct {
+	// rdb is the Redis client.
+	rdb *redis.Client
+
+	// fence is the lock acquisition the writes are conditional on, or nil if they are unconditional.
+	fence *lockFence
+}
+
+// intentKey returns the Redis key holding the intent.
+func intentKey(id string) string {
+	return fmt.Sprintf("INTENT:%s", id)
+}
+
+// GetIntent returns the intent with the given ID, or nil if it does not exist.
+func (s *redisIntentStore) GetIntent(id string) (*TradeIntent, error) {
+	data, err := s.rdb.Get(context.TODO(), intentKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var intent TradeIntent
+	if err := json.Unmarshal(data, &intent); err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// SaveIntent inserts or updates the intent.
+func (s *redisIntentStore) SaveIntent(intent *TradeIntent) error {
+	touchIntent(intent)
+	data, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+	return txPipelined(s.rdb, s.fence, func(pipe redis.Pipeliner) error {
+		return pipe.Set(context.TODO(), intentKey(intent.ID), data, 0).Err()
+	})
+}
+
+// NewRedisIntentStore creates a new IntentStore backed by Redis.
+func NewRedisIntentStore(rdb *redis.Client) IntentStore {
+	return &redisIntentStore{
+		rdb: rdb,
+	}
+}
+
+// ReconcileIntent looks up the orders of the maker at the relayer and reports whether a new order may be created for the intent.
+// Only the order recorded in the intent matches, by its hash or salt. A live order swapping the same amount of the same tokens
+// may have been created by hand or by another intent, so it is not adopted.
+// The intent (and the journal, for orders whose submission seemed to fail) are updated with what the relayer knows.
+func ReconcileIntent(r OneInchRouter, j TradeJournal, intent *TradeIntent, makerAddress string) (bool, error) {
+	if intent.Status == IntentCompleted {
+		return false, nil
+	}
+
+	if intent.OrderHash == "" {
+		return true, nil
+	}
+
+	orders, err := r.GetOrdersByMaker(makerAddress)
+	if err != nil {
+		return false, err
+	}
+
+	// The trade was journaled under the hash of the order when it was created.
+	tradeId := intent.OrderHash
+	for _, order := range orders {
+		isLive := order.Status == "pending" || order.Status == "partially-filled"
+
+		matches := strings.EqualFold(order.OrderHash, intent.OrderHash) || (intent.Salt != "" && order.Order.Salt == intent.Salt)
+		if !matches {
+			continue
+		}
+
+		if isLive {
+			log.Infof("Order %s of intent %s is live at the relayer", order.OrderHash, intent.ID)
+			intent.OrderHash = order.OrderHash
+			intent.Status = IntentSubmitted
+
+			// The submission may have timed out although the relayer accepted the order, track it from now on.
+			trade, err := j.GetTrade(tradeId)
+			if err != nil {
+				return false, err
+			}
+			if trade != nil && trade.Status != TradeSubmitted {
+				trade.Status = TradeSubmitted
+				trade.SubmitError = ""
+				if err := j.RecordTrade(trade); err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+		}
+
+		if order.Status == "filled" {
+			log.Infof("Order %s of intent %s was filled", order.OrderHash, intent.ID)
+			intent.OrderHash = order.OrderHash
+			intent.Status = IntentCompleted
+			return false, nil
+		}
+	}
+
+	log.Infof("No live order for intent %s at the relayer, a new order may be created", intent.ID)
+	return true, nil
+}
+
+// IsDefiniteRejection reports whether the submission error proves that the relayer did not accept the order.
+// Transport errors, timeouts and server errors leave the outcome unknown.
+func IsDefiniteRejection(err error) bool {
+	var requestErr *RequestError
+	return errors.As(err, &requestErr) && requestErr.StatusCode >= 400 && requestErr.StatusCode < 500
+}
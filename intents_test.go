@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+)
+
+// makerOrdersRouter serves a fixed list of orders of the maker.
+type makerOrdersRouter struct {
+	OneInchRouter
+
+	orders []OrderStatusResponse
+}
+
+func (r *makerOrdersRouter) GetOrdersByMaker(makerAddress string) ([]OrderStatusResponse, error) {
+	return r.orders, nil
+}
+
+func TestReconcileIntent(t *testing.T) {
+	intentOrder := CreateOrderResponseMessageType{
+		MakerAsset:   testWBTC.Address,
+		TakerAsset:   testUSDC.Address,
+		MakingAmount: "50000000",
+		Salt:         "1001",
+	}
+	// unrelatedOrder swaps the same amount of the same tokens, but was not created for the intent.
+	unrelatedOrder := intentOrder
+	unrelatedOrder.Salt = "2002"
+
+	tests := []struct {
+		name       string
+		intent     TradeIntent
+		orders     []OrderStatusResponse
+		mayCreate  bool
+		wantStatus IntentStatus
+		wantHash   string
+		wantTrade  TradeStatus
+	}{
+		{
+			name:       "crash before the order was created",
+			intent:     TradeIntent{Status: IntentPending},
+			mayCreate:  true,
+			wantStatus: IntentPending,
+		},
+		{
+			name:       "crash before submit",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentPending},
+			mayCreate:  true,
+			wantStatus: IntentPending,
+			wantHash:   "0xintent",
+			wantTrade:  TradePending,
+		},
+		{
+			name:       "crash after submit",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentPending},
+			orders:     []OrderStatusResponse{{OrderHash: "0xintent", Status: "pending", Order: intentOrder}},
+			wantStatus: IntentSubmitted,
+			wantHash:   "0xintent",
+			wantTrade:  TradeSubmitted,
+		},
+		{
+			name:       "submitted under another hash",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentPending},
+			orders:     []OrderStatusResponse{{OrderHash: "0xrelayer", Status: "partially-filled", Order: intentOrder}},
+			wantStatus: IntentSubmitted,
+			wantHash:   "0xrelayer",
+			wantTrade:  TradeSubmitted,
+		},
+		{
+			name:       "filled",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentSubmitted},
+			orders:     []OrderStatusResponse{{OrderHash: "0xintent", Status: "filled", Order: intentOrder}},
+			wantStatus: IntentCompleted,
+			wantHash:   "0xintent",
+			wantTrade:  TradePending,
+		},
+		{
+			name:       "unrelated live order",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentPending},
+			orders:     []OrderStatusResponse{{OrderHash: "0xunrelated", Status: "pending", Order: unrelatedOrder}},
+			mayCreate:  true,
+			wantStatus: IntentPending,
+			wantHash:   "0xintent",
+			wantTrade:  TradePending,
+		},
+		{
+			name:       "expired order",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentSubmitted},
+			orders:     []OrderStatusResponse{{OrderHash: "0xintent", Status: "expired", Order: intentOrder}},
+			mayCreate:  true,
+			wantStatus: IntentSubmitted,
+			wantHash:   "0xintent",
+			wantTrade:  TradePending,
+		},
+		{
+			name:       "completed",
+			intent:     TradeIntent{OrderHash: "0xintent", Salt: "1001", Status: IntentCompleted},
+			wantStatus: IntentCompleted,
+			wantHash:   "0xintent",
+			wantTrade:  TradePending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewMemoryStateStore()
+			intent := tt.intent
+			intent.ID, intent.FromTokenAddress, intent.ToTokenAddress, intent.FromTokenAmount = "intent-1", testWBTC.Address, testUSDC.Address, "50000000"
+			if intent.OrderHash != "" {
+				trade := &TradeRecord{ID: intent.OrderHash, Pair: "WBTC/USDC", OrderHash: intent.OrderHash, Status: TradePending}
+				if err := j.RecordTrade(trade); err != nil {
+					t.Fatalf("RecordTrade: %v", err)
+				}
+			}
+
+			mayCreate, err := ReconcileIntent(&makerOrdersRouter{orders: tt.orders}, j, &intent, testAddress)
+			if err != nil {
+				t.Fatalf("ReconcileIntent: %v", err)
+			}
+			if mayCreate != tt.mayCreate {
+				t.Errorf("may create = %t, want %t", mayCreate, tt.mayCreate)
+			}
+			if intent.Status != tt.wantStatus || intent.OrderHash != tt.wantHash {
+				t.Errorf("intent %s with order %q, want %s with order %q", intent.Status, intent.OrderHash, tt.wantStatus, tt.wantHash)
+			}
+
+			if tt.intent.OrderHash == "" {
+				return
+			}
+			trade, err := j.GetTrade(tt.intent.OrderHash)
+			if err != nil {
+				t.Fatalf("GetTrade: %v", err)
+			}
+			if trade.Status != tt.wantTrade {
+				t.Errorf("trade status = %s, want %s", trade.Status, tt.wantTrade)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// TradeStatus is the lifecycle status of a journaled trade attempt.
+type TradeStatus string
+
+const (
+	// TradePending means the order was created and signed but not submitted yet.
+	TradePending TradeStatus = "pending"
+
+	// TradeSubmitted means the order was accepted by the relayer and awaits a fill.
+	TradeSubmitted TradeStatus = "submitted"
+
+	// TradeSubmitFailed means the relayer rejected the order or the submission failed.
+	TradeSubmitFailed TradeStatus = "submit_failed"
+
+	// TradeFilled means the order was completely filled.
+	TradeFilled TradeStatus = "filled"
+
+	// TradePartiallyFilled means the order expired or was cancelled after being partially filled.
+	TradePartiallyFilled TradeStatus = "partially_filled"
+
+	// TradeExpired means the order expired without being filled.
+	TradeExpired TradeStatus = "expired"
+
+	// TradeCancelled means the order was cancelled without being filled.
+	TradeCancelled TradeStatus = "cancelled"
+)
+
+// IsOpen reports whether the trade may still change status.
+func (ts TradeStatus) IsOpen() bool {
+	return ts == TradePending || ts == TradeSubmitted
+}
+
+// MarshalBinary encodes the status for storage in Redis.
+func (ts TradeStatus) MarshalBinary() ([]byte, error) {
+	return []byte(ts), nil
+}
+
+// TradeRecord is a journal entry describing a single trade attempt and its outcome.
+type TradeRecord struct {
+	// ID uniquely identifies the trade attempt.
+	ID string `json:"id" redis:"id"`
+
+	// Pair is the traded pair (e.g., "WBTC/USDC").
+	Pair string `json:"pair" redis:"pair"`
+
+	// OrderType is the side of the trade, BUY or SELL.
+	OrderType string `json:"orderType" redis:"order_type"`
+
+	// QuoteId is the 1inch quote the order was built from.
+	QuoteId string `json:"quoteId" redis:"quote_id"`
+
+	// OrderHash is the hash of the Fusion order.
+	OrderHash string `json:"orderHash" redis:"order_hash"`
+
+	// Signature is the hex encoded EIP-712 signature of the order.
+	Signature string `json:"signature" redis:"signature"`
+
+	// FromTokenAddress is the address of the token sold.
+	FromTokenAddress string `json:"fromTokenAddress" redis:"from_token_address"`
+
+	// FromTokenSymbol is the symbol of the token sold.
+	FromTokenSymbol string `json:"fromTokenSymbol" redis:"from_token_symbol"`
+
+	// FromTokenAmount is the amount of the token sold, in base units.
+	FromTokenAmount string `json:"fromTokenAmount" redis:"from_token_amount"`
+
+	// ToTokenAddress is the address of the token bought.
+	ToTokenAddress string `json:"toTokenAddress" redis:"to_token_address"`
+
+	// ToTokenSymbol is the symbol of the token bought.
+	ToTokenSymbol string `json:"toTokenSymbol" redis:"to_token_symbol"`
+
+	// ToTokenAmount is the quoted amount of the token bought, in base units.
+	ToTokenAmount string `json:"toTokenAmount" redis:"to_token_amount"`
+
+	// Price is the quoted price of the target token in stable tokens.
+	Price float64 `json:"price" redis:"price"`
+
+	// TriggerReason describes why the strategy decided to trade.
+	TriggerReason string `json:"triggerReason" redis:"trigger_reason"`
+
+	// SubmitError holds the error returned by the relayer, if the submission failed.
+	SubmitError string `json:"submitError" redis:"submit_error"`
+
+	// Status is the lifecycle status of the trade.
+	Status TradeStatus `json:"status" redis:"status"`
+
+	// FilledFromTokenAmount is the amount of the token sold that was filled, in base units.
+	FilledFromTokenAmount string `json:"filledFromTokenAmount" redis:"filled_from_token_amount"`
+
+	// FilledToTokenAmount is the amount of the token bought that was received, in base units.
+	FilledToTokenAmount string `json:"filledToTokenAmount" redis:"filled_to_token_amount"`
+
+	// CreatedAt is when the trade attempt was made.
+	CreatedAt time.Time `json:"createdAt" redis:"created_at"`
+
+	// UpdatedAt is when the record was last updated.
+	UpdatedAt time.Time `json:"updatedAt" redis:"updated_at"`
+
+	// FilledAt is when the trade was seen filled or partially filled, or zero if it was not.
+	FilledAt time.Time `json:"filledAt" redis:"filled_at"`
+}
+
+// FillTime returns when the trade was filled. Trades journaled before FilledAt was recorded fall back to UpdatedAt.
+func (tr *TradeRecord) FillTime() time.Time {
+	if tr.FilledAt.IsZero() {
+		return tr.UpdatedAt
+	}
+	return tr.FilledAt
+}
+
+// ApplyOrderStatus updates the trade status and filled amounts from the relayer's order status.
+func (tr *TradeRecord) ApplyOrderStatus(orderStatus *OrderStatusResponse) {
+	filledMaker := new(big.Int)
+	filledTaker := new(big.Int)
+	for _, fill := range orderStatus.Fills {
+		if amount, ok := new(big.Int).SetString(fill.FilledMakerAmount, 10); ok {
+			filledMaker.Add(filledMaker, amount)
+		}
+		if amount, ok := new(big.Int).SetString(fill.FilledAuctionTakerAmount, 10); ok {
+			filledTaker.Add(filledTaker, amount)
+		}
+	}
+
+	if len(orderStatus.Fills) > 0 {
+		tr.FilledFromTokenAmount = filledMaker.String()
+		tr.FilledToTokenAmount = filledTaker.String()
+	}
+
+	switch orderStatus.Status {
+	case "filled":
+		tr.Status = TradeFilled
+	case "expired", "cancelled", "false-predicate", "not-enough-balance-or-allowance", "wrong-permit", "invalid-signature":
+		tr.Status = TradeExpired
+		if orderStatus.Status == "cancelled" {
+			tr.Status = TradeCancelled
+		}
+		if filledMaker.Sign() > 0 {
+			tr.Status = TradePartiallyFilled
+		}
+	}
+
+	if (tr.Status == TradeFilled || tr.Status == TradePartiallyFilled) && tr.FilledAt.IsZero() {
+		tr.FilledAt = time.Now()
+	}
+}
+
+// TradeJournal persists trade records and makes them queryable.
+type TradeJournal interface {
+	// RecordTrade inserts or updates the trade record.
+	RecordTrade(record *TradeRecord) error
+
+	// GetTrade returns the trade record with the given ID, or nil if it does not exist.
+	GetTrade(id string) (*TradeRecord, error)
+
+	// QueryTrades returns the trade records of the pair created within [from, to], oldest first.
+	// An empty pair matches all pairs.
+	QueryTrades(pair string, from time.Time, to time.Time) ([]*TradeRecord, error)
+
+	// OpenTrades returns the trade records of the pair whose status may still change.
+	OpenTrades(pair string) ([]*TradeRecord, error)
+}
+
+// redisTradeJournal implements the TradeJournal interface with a Redis hash per trade,
+// indexed by sorted sets scored by creation time and a set of open trades per pair.
+type redisTradeJournal struct {
+	// rdb is the Redis client.
+	rdb *redis.Client
+
+	// fence is the lock acquisition the writes are conditional on, or nil if they are unconditional.
+	fence *lockFence
+}
+
+// tradeKey returns the Redis key holding the trade record.
+func tradeKey(id string) string {
+	return fmt.Sprintf("TRADE:%s", id)
+}
+
+// tradesKey returns the Redis key of the sorted set indexing the trades of the pair, or all trades if the pair is empty.
+func tradesKey(pair string) string {
+	if pair == "" {
+		return "TRADES"
+	}
+	return fmt.Sprintf("TRADES:%s", pair)
+}
+
+// openTradesKey returns the Redis key of the set of open trades of the pair.
+func openTradesKey(pair string) string {
+	return fmt.Sprintf("OPEN_TRADES:%s", pair)
+}
+
+// RecordTrade inserts or updates the trade record.
+func (j *redisTradeJournal) RecordTrade(record *TradeRecord) error {
+	touchTrade(record)
+
+	score := float64(record.CreatedAt.UnixMilli())
+
+	return txPipelined(j.rdb, j.fence, func(pipe redis.Pipeliner) error {
+		pipe.HSet(context.TODO(), tradeKey(record.ID), *record)
+		pipe.ZAdd(context.TODO(), tradesKey(""), redis.Z{Score: score, Member: record.ID})
+		pipe.ZAdd(context.TODO(), tradesKey(record.Pair), redis.Z{Score: score, Member: record.ID})
+		if record.Status.IsOpen() {
+			pipe.SAdd(context.TODO(), openTradesKey(record.Pair), record.ID)
+		} else {
+			pipe.SRem(context.TODO(), openTradesKey(record.Pair), record.ID)
+		}
+		return nil
+	})
+}
+
+// GetTrade returns the trade record with the given ID, or nil if it does not exist.
+func (j *redisTradeJournal) GetTrade(id string) (*TradeRecord, error) {
+	res := j.rdb.HGetAll(context.TODO(), tradeKey(id))
+	fields, err := res.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	var record TradeRecord
+	if err := res.Scan(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// QueryTrades returns the trade records of the pair created within [from, to], oldest first.
+func (j *redisTradeJournal) QueryTrades(pair string, from time.Time, to time.Time) ([]*TradeRecord, error) {
+	ids, err := j.rdb.ZRangeByScore(context.TODO(), tradesKey(pair), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return j.getTrades(ids)
+}
+
+// OpenTrades returns the trade records of the pair whose status may still change.
+func (j *redisTradeJournal) OpenTrades(pair string) ([]*TradeRecord, error) {
+	ids, err := j.rdb.SMembers(context.TODO(), openTradesKey(pair)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return j.getTrades(ids)
+}
+
+// getTrades returns the trade records with the given IDs, skipping the ones that do not exist.
+func (j *redisTradeJournal) getTrades(ids []string) ([]*TradeRecord, error) {
+	records := make([]*TradeRecord, 0, len(ids))
+	for _, id := range ids {
+		record, err := j.GetTrade(id)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// NewRedisTradeJournal creates a new TradeJournal backed by Redis.
+func NewRedisTradeJournal(rdb *redis.Client) TradeJournal {
+	return &redisTradeJournal{
+		rdb: rdb,
+	}
+}
+
+// UpdateOpenTrades refreshes the status of the open trades of the pair from the relayer.
+func UpdateOpenTrades(j TradeJournal, r OneInchRouter, pair string) ([]*TradeRecord, error) {
+	records, err := j.OpenTrades(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*TradeRecord
+	for _, record := range records {
+		if record.OrderHash == "" || record.Status != TradeSubmitted {
+			continue
+		}
+
+		orderStatus, err := r.GetOrderStatus(record.OrderHash)
+		if err != nil {
+			return changed, err
+		}
+
+		previousStatus := record.Status
+		record.ApplyOrderStatus(orderStatus)
+		if err := j.RecordTrade(record); err != nil {
+			return changed, err
+		}
+
+		if record.Status != previousStatus {
+			log.Infof("Order %s is now %s", record.OrderHash, record.Status)
+			RecordOrderMetric(pair, record.Status)
+			changed = append(changed, record)
+		}
+	}
+
+	return changed, nil
+}
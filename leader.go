@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// LeaderElector elects a single leader among the replicas sharing a lease lock.
+type LeaderElector interface {
+	// Run campaigns for and renews the lease until the context is done, then releases it.
+	Run(ctx context.Context)
+
+	// IsLeader reports whether this replica currently believes it holds the lease.
+	IsLeader() bool
+
+	// CheckLeadership verifies with the lock store that this replica still holds the lease under its fencing token.
+	// It must be called right before performing a side effect that only the leader may perform.
+	CheckLeadership() (bool, error)
+
+	// FencingToken returns the fencing token of the current lease, or zero if this replica is not the leader.
+	FencingToken() int64
+
+	// Fence returns a view of the store whose writes only succeed while this replica holds the lease under
+	// the fencing token it holds now, so that a replica that lost the lease cannot overwrite the state of the new leader.
+	Fence(store StateStore) StateStore
+
+	// InstanceID returns the identifier of this replica.
+	InstanceID() string
+}
+
+// leaderElector implements the LeaderElector interface on top of a LockStore.
+type leaderElector struct {
+	// store holds the lease lock.
+	store LockStore
+
+	// name is the name of the lease lock.
+	name string
+
+	// instanceId identifies this replica as the owner of the lease.
+	instanceId string
+
+	// ttl is how long the lease lasts without renewal.
+	ttl time.Duration
+
+	// mu guards token.
+	mu sync.RWMutex
+
+	// token is the fencing token of the current lease, or zero if this replica is not the leader.
+	token int64
+}
+
+// Run campaigns for and renews the lease until the context is done, then releases it.
+// The lease is renewed every third of its TTL, so that a single failed renewal does not lose it.
+func (le *leaderElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(le.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		le.tick()
+
+		select {
+		case <-ctx.Done():
+			if le.IsLeader() {
+				if err := le.store.ReleaseLock(le.name, le.instanceId); err != nil {
+					log.Errorf("Error occurred while releasing leader lease %s: %v", le.name, err)
+				}
+				le.setToken(0)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick acquires the lease if this replica is a standby, or renews it if it is the leader.
+func (le *leaderElector) tick() {
+	if le.IsLeader() {
+		renewed, err := le.store.RenewLock(le.name, le.instanceId, le.ttl)
+		if err != nil {
+			log.Errorf("Error occurred while renewing leader lease %s: %v", le.name, err)
+			return
+		}
+		if !renewed {
+			log.Warnf("Lost leader lease %s, switching to standby", le.name)
+			le.setToken(0)
+		}
+		return
+	}
+
+	token, acquired, err := le.store.AcquireLock(le.name, le.instanceId, le.ttl)
+	if err != nil {
+		log.Errorf("Error occurred while acquiring leader lease %s: %v", le.name, err)
+		return
+	}
+	if acquired {
+		log.Infof("Acquired leader lease %s with fencing token %d", le.name, token)
+		le.setToken(token)
+	}
+}
+
+// setToken sets the fencing token of the current lease.
+func (le *leaderElector) setToken(token int64) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.token = token
+}
+
+// IsLeader reports whether this replica currently believes it holds the lease.
+func (le *leaderElector) IsLeader() bool {
+	return le.FencingToken() > 0
+}
+
+// CheckLeadership verifies with the lock store that this replica still holds the lease under its fencing token.
+func (le *leaderElector) CheckLeadership() (bool, error) {
+	token := le.FencingToken()
+	if token == 0 {
+		return false, nil
+	}
+
+	holds, err := le.store.HoldsLock(le.name, le.instanceId, token)
+	if err != nil {
+		return false, err
+	}
+
+	if !holds {
+		log.Warnf("Leader lease %s is no longer held with fencing token %d, switching to standby", le.name, token)
+		le.setToken(0)
+	}
+	return holds, nil
+}
+
+// FencingToken returns the fencing token of the current lease, or zero if this replica is not the leader.
+func (le *leaderElector) FencingToken() int64 {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	return le.token
+}
+
+// Fence returns a view of the store whose writes only succeed while this replica holds the lease under its current fencing token.
+func (le *leaderElector) Fence(store StateStore) StateStore {
+	return store.Fenced(le.name, le.instanceId, le.FencingToken())
+}
+
+// InstanceID returns the identifier of this replica.
+func (le *leaderElector) InstanceID() string {
+	return le.instanceId
+}
+
+// NewInstanceID returns an identifier for this replica made of the hostname and a random suffix.
+func NewInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return hostname
+	}
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
+// NewLeaderElector creates a new LeaderElector that competes for the named lease lock as the given instance.
+func NewLeaderElector(store LockStore, name string, instanceId string, ttl time.Duration) LeaderElector {
+	return &leaderElector{
+		store:      store,
+		name:       name,
+		instanceId: instanceId,
+		ttl:        ttl,
+	}
+}
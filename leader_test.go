@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaderElectorTakeover(t *testing.T) {
+	st := NewMemoryStateStore()
+	ttl := 100 * time.Millisecond
+	a := NewLeaderElector(st, "LEADER:test", "a", ttl).(*leaderElector)
+	b := NewLeaderElector(st, "LEADER:test", "b", ttl).(*leaderElector)
+
+	a.tick()
+	b.tick()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("a leader = %t, b leader = %t, want only a", a.IsLeader(), b.IsLeader())
+	}
+	stale := a.Fence(st)
+
+	// The renewed lease outlives its original TTL.
+	time.Sleep(ttl / 2)
+	a.tick()
+	time.Sleep(ttl / 2)
+	b.tick()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("a leader = %t, b leader = %t after a renewal, want only a", a.IsLeader(), b.IsLeader())
+	}
+	if ok, err := a.CheckLeadership(); err != nil || !ok {
+		t.Errorf("CheckLeadership of the leader = %t, %v, want true", ok, err)
+	}
+
+	// a stops renewing, for instance while paused, and b takes over the expired lease.
+	time.Sleep(ttl + 20*time.Millisecond)
+	b.tick()
+	if !b.IsLeader() {
+		t.Fatal("b did not take over the expired lease")
+	}
+	if b.FencingToken() <= a.FencingToken() {
+		t.Errorf("fencing token %d after %d, want it to increase", b.FencingToken(), a.FencingToken())
+	}
+
+	// a still believes it is the leader until it checks, but its writes are already fenced off.
+	if !a.IsLeader() {
+		t.Fatal("a noticed the takeover without checking")
+	}
+	if err := stale.SetMonitorState("WBTC/USDC", &PriceMonitorState{TriggerPriceUp: 1}); !errors.Is(err, ErrFenced) {
+		t.Errorf("SetMonitorState by the stale leader = %v, want ErrFenced", err)
+	}
+	if err := a.Fence(st).SaveIntent(&TradeIntent{ID: "intent-1", Status: IntentPending}); !errors.Is(err, ErrFenced) {
+		t.Errorf("SaveIntent by the stale leader = %v, want ErrFenced", err)
+	}
+	if err := b.Fence(st).SetMonitorState("WBTC/USDC", &PriceMonitorState{TriggerPriceUp: 2}); err != nil {
+		t.Fatalf("SetMonitorState by the new leader: %v", err)
+	}
+	if state, err := st.GetMonitorState("WBTC/USDC"); err != nil || state.TriggerPriceUp != 2 {
+		t.Errorf("monitor state = %+v, %v, want the new leader's", state, err)
+	}
+	if intent, err := st.GetIntent("intent-1"); err != nil || intent != nil {
+		t.Errorf("intent = %+v, %v, want none saved by the stale leader", intent, err)
+	}
+
+	if ok, err := a.CheckLeadership(); err != nil || ok {
+		t.Errorf("CheckLeadership of the stale leader = %t, %v, want false", ok, err)
+	}
+	if a.IsLeader() {
+		t.Error("stale leader did not switch to standby")
+	}
+}
+
+func TestLeaderElectorStandbyAfterFailedRenewal(t *testing.T) {
+	st := NewMemoryStateStore()
+	ttl := 50 * time.Millisecond
+	a := NewLeaderElector(st, "LEADER:test", "a", ttl).(*leaderElector)
+	b := NewLeaderElector(st, "LEADER:test", "b", ttl).(*leaderElector)
+
+	a.tick()
+	time.Sleep(ttl + 20*time.Millisecond)
+	b.tick()
+
+	// The renewal fails once the lease expired and was taken over, so a switches to standby and stays there.
+	a.tick()
+	if a.IsLeader() {
+		t.Error("a is still the leader after its renewal failed")
+	}
+	a.tick()
+	if a.IsLeader() || !b.IsLeader() {
+		t.Errorf("a leader = %t, b leader = %t, want only b", a.IsLeader(), b.IsLeader())
+	}
+}
@@ -1,18 +1,24 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/joho/godotenv"
-	"github.com/redis/go-redis/v9"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -29,6 +35,15 @@ func main() {
 		log.SetLevel(log.InfoLevel)
 	}
 
+	// Commands are dispatched as soon as the dependencies they need are set up.
+	cmd, ce, err := parseCommand(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error occurred while parsing command: %v, exiting...", err)
+	}
+	if cmd.dispatch(configStage, ce) {
+		return
+	}
+
 	walletExpectedAddress := os.Getenv("WALLET_ADDRESS")
 	privateKeyHex := os.Getenv("WALLET_PRIVATE_KEY_HEX")
 	chainId := os.Getenv("CHAIN_ID")
@@ -44,228 +59,1255 @@ func main() {
 	redisHost := os.Getenv("REDIS_HOST")
 	redisPort := os.Getenv("REDIS_PORT")
 	redisPassword := os.Getenv("REDIS_PASSWORD")
+	stateStoreKind := os.Getenv("STATE_STORE")
+	stateStorePath := os.Getenv("STATE_STORE_PATH")
+	instanceId := os.Getenv("INSTANCE_ID")
+	leaderLeaseTTL := os.Getenv("LEADER_LEASE_TTL")
+	rpcUrl := os.Getenv("RPC_URL")
+	approvalModeName := os.Getenv("APPROVAL_MODE")
+	approvalResetTokens := os.Getenv("APPROVAL_RESET_TOKENS")
+	targetTokenApprovalCap := os.Getenv("TARGET_TOKEN_APPROVAL_CAP")
+	stableTokenApprovalCap := os.Getenv("STABLE_TOKEN_APPROVAL_CAP")
+	equitySnapshotInterval := os.Getenv("EQUITY_SNAPSHOT_INTERVAL")
+	costBasisMethodName := os.Getenv("COST_BASIS_METHOD")
+	permitModeName := os.Getenv("PERMIT_MODE")
+	permitTTL := os.Getenv("PERMIT_TTL")
+	balanceSource := os.Getenv("BALANCE_SOURCE")
+	balanceTolerancePercent := os.Getenv("BALANCE_TOLERANCE_PERCENT")
+	httpAddress := os.Getenv("HTTP_ADDRESS")
+	healthTickGrace := os.Getenv("HEALTH_TICK_GRACE")
+	adminAddress := os.Getenv("ADMIN_ADDRESS")
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	webhooks := os.Getenv("WEBHOOKS")
+	webhookMaxRetries := os.Getenv("WEBHOOK_MAX_RETRIES")
+	webhookDedupeWindow := os.Getenv("WEBHOOK_DEDUPE_WINDOW")
+	errorThreshold := os.Getenv("ERROR_THRESHOLD")
+	errorWindow := os.Getenv("ERROR_WINDOW")
+	lowBalanceThreshold := os.Getenv("LOW_BALANCE_THRESHOLD")
+	riskMaxTradeNotional := os.Getenv("RISK_MAX_TRADE_NOTIONAL")
+	riskMaxTradesPerDay := os.Getenv("RISK_MAX_TRADES_PER_DAY")
+	riskMaxDailyVolume := os.Getenv("RISK_MAX_DAILY_VOLUME")
+	riskMaxDailyLoss := os.Getenv("RISK_MAX_DAILY_LOSS")
+	priceReference := os.Getenv("PRICE_REFERENCE")
+	chainlinkAggregatorAddress := os.Getenv("CHAINLINK_AGGREGATOR_ADDRESS")
+	chainlinkMaxAge := os.Getenv("CHAINLINK_MAX_AGE")
+	referenceQuoteNotional := os.Getenv("REFERENCE_QUOTE_NOTIONAL")
+	priceMaxDeviationPercent := os.Getenv("PRICE_MAX_DEVIATION_PERCENT")
+	maxPriceImpactPercent := os.Getenv("MAX_PRICE_IMPACT_PERCENT")
+	presetStopLoss := os.Getenv("PRESET_STOP_LOSS")
+	presetTakeProfit := os.Getenv("PRESET_TAKE_PROFIT")
+	presetFlatten := os.Getenv("PRESET_FLATTEN")
+	presetNormal := os.Getenv("PRESET_NORMAL")
+	customPresetAuctionDuration := os.Getenv("CUSTOM_PRESET_AUCTION_DURATION")
+	customPresetStartPercent := os.Getenv("CUSTOM_PRESET_START_PERCENT")
+	customPresetEndPercent := os.Getenv("CUSTOM_PRESET_END_PERCENT")
+	pollInterval := os.Getenv("POLL_INTERVAL")
+	fastPollInterval := os.Getenv("FAST_POLL_INTERVAL")
+	approachPercent := os.Getenv("APPROACH_PERCENT")
+	submitCooldown := os.Getenv("SUBMIT_COOLDOWN")
+	fillCooldown := os.Getenv("FILL_COOLDOWN")
+	failureCooldown := os.Getenv("FAILURE_COOLDOWN")
+	quietHours := os.Getenv("QUIET_HOURS")
+	quietHoursTimezone := os.Getenv("QUIET_HOURS_TIMEZONE")
+	schedules := os.Getenv("SCHEDULES")
+	pairsJSON := os.Getenv("PAIRS")
+	balanceCacheTTL := os.Getenv("BALANCE_CACHE_TTL")
+	oneInchApi := os.Getenv("ONEINCH_API")
+	oneInchApiKey := os.Getenv("ONEINCH_API_KEY")
+	oneInchApiUrl := os.Getenv("ONEINCH_API_URL")
 
-	log.Info("Connecting to redis...")
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisHost + ":" + redisPort,
-		Password: redisPassword,
-		DB:       0,
+	pairConfigs, err := ParsePairConfigs(pairsJSON, PairConfig{
+		Target: TokenConfig{
+			Address:     targetTokenAddress,
+			Symbol:      targetTokenSymbol,
+			Name:        targetTokenName,
+			Decimals:    targetTokenDecimals,
+			ApprovalCap: targetTokenApprovalCap,
+		},
+		Stable: TokenConfig{
+			Address:     stableTokenAddress,
+			Symbol:      stableTokenSymbol,
+			Name:        stableTokenName,
+			Decimals:    stableTokenDecimals,
+			ApprovalCap: stableTokenApprovalCap,
+		},
+		ChainlinkAggregatorAddress: chainlinkAggregatorAddress,
 	})
-	if err := rdb.Ping(context.TODO()).Err(); err != nil {
-		log.Fatalf("Error occurred while connecting to Redis: %v, exiting...", err)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing pairs: %v, exiting...", err)
 	}
-	log.Info("Connected to redis successfully")
 
 	w, err := NewWallet(privateKeyHex, walletExpectedAddress, chainId)
 	if err != nil {
 		log.Fatalf("Error occurred while creating wallet: %v, exiting...", err)
 	}
 
+	ce.w = w
+	if cmd.dispatch(walletStage, ce) {
+		return
+	}
+
+	permitMode, err := ParsePermitMode(permitModeName)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing permit mode: %v, exiting...", err)
+	}
+
+	var ec *ethclient.Client
+	var am ApprovalManager
+	var ps PermitSigner
+	if rpcUrl != "" {
+		log.Info("Connecting to RPC endpoint...")
+		ec, err = ethclient.Dial(rpcUrl)
+		if err != nil {
+			log.Fatalf("Error occurred while connecting to RPC endpoint: %v, exiting...", err)
+		}
+		log.Info("Connected to RPC endpoint successfully")
+
+		approvalMode, err := ParseApprovalMode(approvalModeName)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing approval mode: %v, exiting...", err)
+		}
+
+		approvalCaps := make(map[string]*big.Int)
+		for _, pc := range pairConfigs {
+			for _, tc := range []TokenConfig{pc.Target, pc.Stable} {
+				if tc.ApprovalCap == "" {
+					continue
+				}
+				c, ok := new(big.Int).SetString(tc.ApprovalCap, 10)
+				if !ok {
+					log.Fatalf("Invalid approval cap %s for token %s, exiting...", tc.ApprovalCap, tc.Address)
+				}
+				approvalCaps[tc.Address] = c
+			}
+		}
+
+		// With Permit2 the router is authorized per order, but the token itself must be approved to the Permit2 contract.
+		spenderAddress := routerContractAddress
+		if permitMode == Permit2Permit {
+			spenderAddress = Permit2ContractAddress
+		}
+
+		var resetTokenAddresses []string
+		if approvalResetTokens != "" {
+			resetTokenAddresses = strings.Split(approvalResetTokens, ",")
+		}
+
+		am = NewApprovalManager(ec, w, spenderAddress, approvalMode, approvalCaps, resetTokenAddresses)
+		log.Infof("Approval Mode: %s, Spender: %s", approvalMode, spenderAddress)
+
+		if permitMode != NoPermit {
+			ttl := 30 * time.Minute
+			if permitTTL != "" {
+				ttl, err = time.ParseDuration(permitTTL)
+				if err != nil {
+					log.Fatalf("Error occurred while parsing permit TTL: %v, exiting...", err)
+				}
+			}
+			ps = NewPermitSigner(ec, w, routerContractAddress, permitMode, ttl)
+			log.Infof("Permit Mode: %s, TTL: %s", permitMode, ttl)
+		}
+	} else if permitMode != NoPermit {
+		log.Fatal("RPC_URL is required to sign permits, exiting...")
+	}
+
+	if stateStoreKind == "" {
+		stateStoreKind = "redis"
+	}
+	if stateStorePath == "" {
+		stateStorePath = "kryptonite.db"
+	}
+
+	log.Infof("Connecting to %s state store...", stateStoreKind)
+	st, err := NewStateStore(stateStoreKind, redisHost+":"+redisPort, redisPassword, stateStorePath)
+	if err != nil {
+		log.Fatalf("Error occurred while creating state store: %v, exiting...", err)
+	}
+	defer st.Close()
+	if err := st.Ping(); err != nil {
+		log.Fatalf("Error occurred while connecting to %s state store: %v, exiting...", stateStoreKind, err)
+	}
+	log.Infof("Connected to %s state store successfully", stateStoreKind)
+
+	ce.ec, ce.am, ce.ps, ce.st = ec, am, ps, st
+	if cmd.dispatch(storeStage, ce) {
+		return
+	}
+
 	log.Infof("Wallet Address: %s", w.Address())
 	log.Infof("Chain ID: %s", chainId)
-	log.Infof("Target Token: %s, Name: %s, Decimals: %s, Address: %s", targetTokenSymbol, targetTokenName, targetTokenDecimals, targetTokenAddress)
-	log.Infof("Stable Token: %s, Name: %s, Decimals: %s, Address: %s", stableTokenSymbol, stableTokenName, stableTokenDecimals, stableTokenAddress)
 
-	r := NewOneInchRouter(routerContractAddress, chainId)
+	var r OneInchRouter
+	switch oneInchApi {
+	case "", "proxy":
+		r = NewOneInchRouter(oneInchApiUrl, routerContractAddress, chainId)
+	case "dev":
+		if oneInchApiKey == "" {
+			log.Fatal("ONEINCH_API_KEY is required for the 1inch Developer Portal API, exiting...")
+		}
+		r = NewOneInchDevRouter(oneInchApiKey, oneInchApiUrl, routerContractAddress, chainId)
+	default:
+		log.Fatalf("Unknown 1inch API: %s, exiting...", oneInchApi)
+	}
+	log.Infof("1inch API: %s", cmp.Or(oneInchApi, "proxy"))
 	log.Infof("Router Contract Address: %s", r.RouterContractAddress())
 	log.Infof("Router Chain ID: %s", r.ChainID())
 
-	pm := NewPriceMonitor(BuyOrder, 0, 0, 0.5, 1.0)
+	if err := r.GenerateOrRefreshAccessToken(); err != nil {
+		log.Fatalf("Error occurred while generating/refreshing access token: %v, exiting...", err)
+	}
+	go r.KeepAccessTokenFresh(context.Background())
+
+	tokenSources := []TokenMetadataSource{}
+	if ec != nil {
+		tokenSources = append(tokenSources, NewRPCTokenMetadataSource(ec))
+	}
+	tokenSources = append(tokenSources, NewOneInchTokenMetadataSource(r, DefaultTokenListTTL))
+	tr := NewTokenRegistry(chainId, st, tokenSources...)
+
+	log.Info("Verifying token metadata...")
+	tradedPairs := make([]tradedPair, 0, len(pairConfigs))
+	for _, pc := range pairConfigs {
+		targetToken, err := VerifyConfiguredToken(tr, pc.Target.Address, pc.Target.Symbol, pc.Target.Name, pc.Target.Decimals)
+		if err != nil {
+			log.Fatalf("Error occurred while verifying target token: %v, exiting...", err)
+		}
+		stableToken, err := VerifyConfiguredToken(tr, pc.Stable.Address, pc.Stable.Symbol, pc.Stable.Name, pc.Stable.Decimals)
+		if err != nil {
+			log.Fatalf("Error occurred while verifying stable token: %v, exiting...", err)
+		}
+		tradedPairs = append(tradedPairs, tradedPair{config: pc, target: targetToken, stable: stableToken})
 
-	for {
-		if err := r.GenerateOrRefreshAccessToken(); err != nil {
-			log.Fatalf("Error occurred while generating/refreshing access token: %v, exiting...", err)
+		log.Infof("Target Token: %s, Name: %s, Decimals: %d, Address: %s", targetToken.Symbol, targetToken.Name, targetToken.Decimals, targetToken.Address)
+		log.Infof("Stable Token: %s, Name: %s, Decimals: %d, Address: %s", stableToken.Symbol, stableToken.Name, stableToken.Decimals, stableToken.Address)
+	}
+	log.Info("Verified token metadata successfully")
+
+	if balanceSource == "" {
+		balanceSource = "1inch"
+		if ec != nil {
+			balanceSource = "both"
 		}
-		log.Debug("Generated/Refreshed access token successfully")
-		log.Debugf("Access Token: %s", r.AccessToken())
-		log.Debugf("Expiration: %d", r.Expiration())
+	}
 
-		log.Debug("Fetching wallet token balances and router allowances...")
-		balancesAndAllowances, err := r.GetWalletTokenBalancesAndRouterAllowances(w.Address())
+	var bp BalanceProvider
+	switch balanceSource {
+	case "1inch":
+		bp = NewOneInchBalanceProvider(r)
+	case "rpc", "both":
+		if ec == nil {
+			log.Fatalf("RPC_URL is required for balance source %s, exiting...", balanceSource)
+		}
+		bp = NewRPCBalanceProvider(ec, routerContractAddress)
+		if balanceSource == "both" {
+			tolerance := 1.0
+			if balanceTolerancePercent != "" {
+				tolerance, err = strconv.ParseFloat(balanceTolerancePercent, 64)
+				if err != nil {
+					log.Fatalf("Error occurred while parsing balance tolerance percent: %v, exiting...", err)
+				}
+			}
+			bp = NewCrossCheckedBalanceProvider(bp, NewOneInchBalanceProvider(r), tolerance)
+		}
+	default:
+		log.Fatalf("Unknown balance source: %s, exiting...", balanceSource)
+	}
+	log.Infof("Balance Provider: %s", bp.Name())
+
+	costBasisMethod, err := ParseCostBasisMethod(costBasisMethodName)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing cost basis method: %v, exiting...", err)
+	}
+
+	if adminAddress == "" {
+		adminAddress = "127.0.0.1:8081"
+	}
+
+	ce.r, ce.tr, ce.bp, ce.pairs, ce.costBasisMethod = r, tr, bp, tradedPairs, costBasisMethod
+	ce.adminAddress, ce.adminToken = adminAddress, adminToken
+	if cmd.dispatch(tokensStage, ce) {
+		return
+	}
+
+	webhookConfigs, err := ParseWebhookConfigs(webhooks)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing webhooks: %v, exiting...", err)
+	}
+	maxRetries := 3
+	if webhookMaxRetries != "" {
+		maxRetries, err = strconv.Atoi(webhookMaxRetries)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing webhook max retries: %v, exiting...", err)
+		}
+	}
+	dedupeWindow := 15 * time.Minute
+	if webhookDedupeWindow != "" {
+		dedupeWindow, err = time.ParseDuration(webhookDedupeWindow)
 		if err != nil {
-			log.Fatalf("Error occurred while fetching token balances and router allowances: %v, exiting...", err)
+			log.Fatalf("Error occurred while parsing webhook dedupe window: %v, exiting...", err)
 		}
-		log.Debugf("%s Balance: %s", targetTokenSymbol, balancesAndAllowances[targetTokenAddress].Balance)
-		log.Debugf("%s Balance: %s", stableTokenSymbol, balancesAndAllowances[stableTokenAddress].Balance)
-		log.Debugf("%s Allowance: %s", targetTokenSymbol, balancesAndAllowances[targetTokenAddress].Allowance)
-		log.Debugf("%s Allowance: %s", stableTokenSymbol, balancesAndAllowances[stableTokenAddress].Allowance)
-		log.Debug("Fetched wallet token balances and router allowances successfully")
+	}
+	n, err := NewWebhookNotifier(webhookConfigs, maxRetries, dedupeWindow)
+	if err != nil {
+		log.Fatalf("Error occurred while creating webhook notifier: %v, exiting...", err)
+	}
+	defer n.Close(30 * time.Second)
+	log.Infof("Webhooks: %d", len(webhookConfigs))
+
+	errThreshold := 5
+	if errorThreshold != "" {
+		errThreshold, err = strconv.Atoi(errorThreshold)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing error threshold: %v, exiting...", err)
+		}
+	}
+	errWindow := 10 * time.Minute
+	if errorWindow != "" {
+		errWindow, err = time.ParseDuration(errorWindow)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing error window: %v, exiting...", err)
+		}
+	}
+	et := NewErrorTracker(n, errThreshold, errWindow)
+
+	lowBalance := 0.0
+	if lowBalanceThreshold != "" {
+		lowBalance, err = strconv.ParseFloat(lowBalanceThreshold, 64)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing low balance threshold: %v, exiting...", err)
+		}
+	}
+
+	if httpAddress == "" {
+		httpAddress = ":8080"
+	}
+	tickGrace := 5 * time.Minute
+	if healthTickGrace != "" {
+		tickGrace, err = time.ParseDuration(healthTickGrace)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing health tick grace: %v, exiting...", err)
+		}
+	}
+	hm := NewHealthMonitor(tickGrace)
+	hm.AddCheck("store", st.Ping)
+	hm.AddCheck("wallet", func() error {
+		if w.Address() == "" {
+			return errors.New("wallet not loaded")
+		}
+		return nil
+	})
+	hm.AddCheck("accessToken", func() error {
+		if r.AccessToken() == "" {
+			return errors.New("no access token")
+		}
+		if exp := r.Expiration(); exp != 0 && exp <= time.Now().Unix() {
+			return errors.New("access token expired")
+		}
+		return nil
+	})
+	hm.Expect("allowances")
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", hm.HealthHandler())
+	mux.Handle("/readyz", hm.ReadinessHandler())
+	go ServeHTTP(httpAddress, mux)
+
+	snapshotInterval := 1 * time.Hour
+	if equitySnapshotInterval != "" {
+		snapshotInterval, err = time.ParseDuration(equitySnapshotInterval)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing equity snapshot interval: %v, exiting...", err)
+		}
+	}
+
+	var riskLimits RiskLimits
+	for _, l := range []struct {
+		value string
+		limit *float64
+	}{
+		{riskMaxTradeNotional, &riskLimits.MaxTradeNotional},
+		{riskMaxDailyVolume, &riskLimits.MaxDailyVolume},
+		{riskMaxDailyLoss, &riskLimits.MaxDailyLoss},
+	} {
+		if l.value == "" {
+			continue
+		}
+		*l.limit, err = strconv.ParseFloat(l.value, 64)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing risk limit: %v, exiting...", err)
+		}
+	}
+	if riskMaxTradesPerDay != "" {
+		riskLimits.MaxTradesPerDay, err = strconv.Atoi(riskMaxTradesPerDay)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing risk limit: %v, exiting...", err)
+		}
+	}
+
+	maxDeviation := 2.0
+	if priceMaxDeviationPercent != "" {
+		maxDeviation, err = strconv.ParseFloat(priceMaxDeviationPercent, 64)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing price max deviation percent: %v, exiting...", err)
+		}
+	}
+
+	notional := 100.0
+	if referenceQuoteNotional != "" {
+		notional, err = strconv.ParseFloat(referenceQuoteNotional, 64)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing reference quote notional: %v, exiting...", err)
+		}
+	}
 
-		log.Debug("Checking router allowances...")
-		if balancesAndAllowances[targetTokenAddress].Allowance == "0" {
-			log.Fatalf("Insufficient router allowance for %s, exiting...", targetTokenSymbol)
+	maxAge := 1 * time.Hour
+	if chainlinkMaxAge != "" {
+		maxAge, err = time.ParseDuration(chainlinkMaxAge)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing chainlink max age: %v, exiting...", err)
 		}
-		if balancesAndAllowances[stableTokenAddress].Allowance == "0" {
-			log.Fatalf("Insufficient router allowance for %s, exiting...", stableTokenSymbol)
+	}
+	switch priceReference {
+	case "":
+		log.Warn("PRICE_REFERENCE is not set, quotes are not sanity checked")
+	case "chainlink":
+		if ec == nil {
+			log.Fatal("RPC_URL is required for the chainlink price reference, exiting...")
 		}
-		log.Debug("Checked router allowances successfully")
+	case "quote", "spot":
+	default:
+		log.Fatalf("Unknown price reference: %s, exiting...", priceReference)
+	}
 
-		log.Debug("Checking token balances...")
-		if balancesAndAllowances[targetTokenAddress].Balance == "0" && balancesAndAllowances[stableTokenAddress].Balance == "0" {
-			log.Fatalf("Insufficient wallet balances for %s and %s, exiting...", targetTokenSymbol, stableTokenSymbol)
+	maxImpact := 0.0
+	if maxPriceImpactPercent != "" {
+		maxImpact, err = strconv.ParseFloat(maxPriceImpactPercent, 64)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing max price impact percent: %v, exiting...", err)
 		}
-		log.Debug("Checked token balances successfully")
+	}
 
-		log.Debug("Updating token balances in redis...")
-		b1, err := rdb.Get(context.TODO(), fmt.Sprintf("LAST_BALANCE:%s", targetTokenSymbol)).Result()
-		if err == redis.Nil {
-			log.Warnf("Key LAST_BALANCE:%s does not exist in Redis, creating it...", targetTokenSymbol)
-			if err := rdb.Set(context.TODO(), fmt.Sprintf("LAST_BALANCE:%s", targetTokenSymbol), balancesAndAllowances[targetTokenAddress].Balance, 0).Err(); err != nil {
-				log.Fatalf("Error occurred while setting LAST_BALANCE:%s in Redis: %v, exiting...", targetTokenSymbol, err)
+	if presetStopLoss == "" {
+		presetStopLoss = "fast"
+	}
+	if presetTakeProfit == "" {
+		presetTakeProfit = "slow"
+	}
+	if presetFlatten == "" {
+		presetFlatten = "fast"
+	}
+	customPreset, err := ParseCustomPreset(customPresetAuctionDuration, customPresetStartPercent, customPresetEndPercent)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing custom preset: %v, exiting...", err)
+	}
+	pp, err := NewPresetPolicy(map[TradeUrgency]string{
+		NormalUrgency:     presetNormal,
+		StopLossUrgency:   presetStopLoss,
+		TakeProfitUrgency: presetTakeProfit,
+		FlattenUrgency:    presetFlatten,
+	}, customPreset)
+	if err != nil {
+		log.Fatalf("Error occurred while creating preset policy: %v, exiting...", err)
+	}
+	log.Infof("Presets: stop-loss %s, take-profit %s, flatten %s, normal %s", presetStopLoss, presetTakeProfit, presetFlatten, cmp.Or(presetNormal, "recommended"))
+
+	schedule := ScheduleConfig{
+		PollInterval:    10 * time.Second,
+		SubmitCooldown:  1 * time.Hour,
+		FailureCooldown: 1 * time.Minute,
+	}
+	for _, d := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"poll interval", pollInterval, &schedule.PollInterval},
+		{"fast poll interval", fastPollInterval, &schedule.FastPollInterval},
+		{"submit cooldown", submitCooldown, &schedule.SubmitCooldown},
+		{"fill cooldown", fillCooldown, &schedule.FillCooldown},
+		{"failure cooldown", failureCooldown, &schedule.FailureCooldown},
+	} {
+		if d.value == "" {
+			continue
+		}
+		*d.target, err = time.ParseDuration(d.value)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing %s: %v, exiting...", d.name, err)
+		}
+	}
+	if schedule.FastPollInterval == 0 {
+		schedule.FastPollInterval = schedule.PollInterval
+	}
+	if approachPercent != "" {
+		schedule.ApproachPercent, err = strconv.ParseFloat(approachPercent, 64)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing approach percent: %v, exiting...", err)
+		}
+	}
+	schedule.QuietHours, err = ParseQuietHours(quietHours)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing quiet hours: %v, exiting...", err)
+	}
+	if quietHoursTimezone != "" {
+		schedule.QuietHoursLocation, err = time.LoadLocation(quietHoursTimezone)
+		if err != nil {
+			log.Fatalf("Error occurred while loading quiet hours time zone: %v, exiting...", err)
+		}
+	}
+	scheduleConfigs, err := ParseScheduleConfigs(schedules, schedule)
+	if err != nil {
+		log.Fatalf("Error occurred while parsing schedules: %v, exiting...", err)
+	}
+	sched := NewScheduler(schedule, scheduleConfigs)
+
+	if instanceId == "" {
+		instanceId = NewInstanceID()
+	}
+	leaseTTL := 30 * time.Second
+	if leaderLeaseTTL != "" {
+		leaseTTL, err = time.ParseDuration(leaderLeaseTTL)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing leader lease TTL: %v, exiting...", err)
+		}
+	}
+
+	cacheTTL := 5 * time.Second
+	if balanceCacheTTL != "" {
+		cacheTTL, err = time.ParseDuration(balanceCacheTTL)
+		if err != nil {
+			log.Fatalf("Error occurred while parsing balance cache TTL: %v, exiting...", err)
+		}
+	}
+	// Workers share the balances of the wallet, and serialize their order submissions.
+	bc := NewBalanceCache(bp, cacheTTL)
+	pairNames := make([]string, 0, len(tradedPairs))
+	for _, tp := range tradedPairs {
+		pairNames = append(pairNames, tp.Name())
+	}
+	ser := NewOrderSerializer(st, pairNames)
+	log.Infof("Pairs: %v, Balance Cache TTL: %s", pairNames, cacheTTL)
+
+	// Equity is valued over the distinct tokens of the wallet, a token shared by several pairs is only counted once.
+	walletTokens := make([]*Token, 0, 2*len(tradedPairs))
+	for _, tp := range tradedPairs {
+		walletTokens = append(walletTokens, tp.target, tp.stable)
+	}
+	we := NewWalletEquity(w.Address(), walletTokens)
+
+	controllers := make(map[string]*PairController, len(tradedPairs))
+	for _, tp := range tradedPairs {
+		targetToken, stableToken := tp.target, tp.stable
+		targetTokenAddress, stableTokenAddress := targetToken.Address, stableToken.Address
+		targetTokenSymbol, stableTokenSymbol := targetToken.Symbol, stableToken.Symbol
+		pair := tp.Name()
+		// Logs of the workers interleave, so every line carries the pair.
+		log := log.With("pair", pair)
+
+		ctrl := NewPairController(pair)
+		controllers[pair] = ctrl
+
+		pe := NewPnLEngine(st, targetToken, stableToken, costBasisMethod)
+
+		rm := NewRiskManager(st, pe, stableToken, riskLimits)
+		log.Infof("Risk Limits: max trade %f %s, max %d trades/day, max daily volume %f %s, max daily loss %f %s", riskLimits.MaxTradeNotional, stableTokenSymbol, riskLimits.MaxTradesPerDay, riskLimits.MaxDailyVolume, stableTokenSymbol, riskLimits.MaxDailyLoss, stableTokenSymbol)
+
+		var pg *PriceGuard
+		switch priceReference {
+		case "chainlink":
+			pg = NewPriceGuard(NewChainlinkPriceReference(ec, tp.config.ChainlinkAggregatorAddress, maxAge), maxDeviation)
+		case "quote":
+			pg = NewPriceGuard(NewQuotePriceReference(r, w.Address(), targetToken, stableToken, notional), maxDeviation)
+		case "spot":
+			pg = NewPriceGuard(NewSpotPriceReference(r, targetToken, stableToken), maxDeviation)
+		}
+		if pg != nil {
+			log.Infof("Price Reference: %s, Max Deviation: %.2f%%", pg.Name(), maxDeviation)
+		}
+
+		var ig *PriceImpactGuard
+		if maxImpact > 0 {
+			ig = NewPriceImpactGuard(NewQuotePriceReference(r, w.Address(), targetToken, stableToken, notional), targetToken, stableToken, maxImpact)
+			log.Infof("Max Price Impact: %.2f%% against a %f %s reference quote", maxImpact, notional, stableTokenSymbol)
+		}
+
+		pairSchedule := sched.Config(pair)
+		log.Infof("Schedule: poll every %s (%s within %.2f%% of a trigger), cooldowns: submit %s, fill %s, failure %s, quiet hours: %v", pairSchedule.PollInterval, pairSchedule.FastPollInterval, pairSchedule.ApproachPercent, pairSchedule.SubmitCooldown, pairSchedule.FillCooldown, pairSchedule.FailureCooldown, pairSchedule.QuietHours)
+
+		pnl, err := pe.Report(pair, 0)
+		if err != nil {
+			log.Fatalf("Error occurred while computing PnL from journal: %v, exiting...", err)
+		}
+
+		pm := NewPriceMonitor(BuyOrder, 0, 0, 0.5, 1.0)
+		if pnl.LastFilledOrderType == BuyOrder.String() && pnl.LastBuyPrice > 0 {
+			log.Infof("Last Buy Price: 1 %s = %f %s, resuming price monitor in %s mode", targetTokenSymbol, pnl.LastBuyPrice, stableTokenSymbol, SellOrder)
+			pm = NewPriceMonitor(SellOrder, 0, pnl.LastBuyPrice, 0.5, 1.0)
+		}
+
+		le := NewLeaderElector(st, fmt.Sprintf("LEADER:%s:%s", w.Address(), pair), instanceId, leaseTTL)
+		go le.Run(context.Background())
+		log.Infof("Instance ID: %s, Leader Lease TTL: %s", le.InstanceID(), leaseTTL)
+
+		isLeader := false
+		tick := func() time.Duration {
+			if !le.IsLeader() {
+				if isLeader {
+					log.Warn("Lost leadership, switching to standby")
+				}
+				isLeader = false
+				log.Infof("Standing by while another instance holds the leader lease, retrying in %s...", leaseTTL/3)
+				return leaseTTL / 3
+			}
+
+			if !isLeader {
+				// Resume from the persisted state, another instance may have traded while this one was on standby.
+				monitorState, err := st.GetMonitorState(pair)
+				if err != nil {
+					log.Errorf("Error occurred while getting price monitor state: %v", err)
+					et.Record(pair, err)
+					return sched.Config(pair).PollInterval
+				}
+
+				isLeader = true
+				log.Infof("Elected as leader with fencing token %d", le.FencingToken())
+				if monitorState != nil {
+					log.Infof("Resuming price monitor in %s mode, Up: %f %s, Down: %f %s", monitorState.CurrentOrderType, monitorState.TriggerPriceUp, stableTokenSymbol, monitorState.TriggerPriceDown, stableTokenSymbol)
+					pm = RestorePriceMonitor(monitorState)
+				}
+			}
+
+			loopStart := time.Now()
+			// fst only accepts writes while this instance holds the lease under the current fencing token, so that
+			// an instance that lost the lease mid-tick neither overwrites the new leader's state nor submits an order.
+			fst := le.Fence(st)
+			// dur is the delay until the next tick, the poll interval until the price is known.
+			dur := sched.Config(pair).PollInterval
+
+			commands := ctrl.TakeCommands()
+			if commands.LimitPercent > 0 || commands.StopLossPercent > 0 {
+				limitPercent, stopLossPercent := pm.limitPercent, pm.stopLossPercent
+				if commands.LimitPercent > 0 {
+					limitPercent = commands.LimitPercent
+				}
+				if commands.StopLossPercent > 0 {
+					stopLossPercent = commands.StopLossPercent
+				}
+				pm.SetPercentages(limitPercent, stopLossPercent)
+				log.Infof("Changed limit percentage to %f and stop-loss percentage to %f", limitPercent, stopLossPercent)
 			}
-		} else {
+
+			log.Debug("Fetching wallet token balances and router allowances...")
+			balancesAndAllowances, err := bc.BalancesAndAllowances(w.Address(), []string{targetTokenAddress, stableTokenAddress})
 			if err != nil {
-				log.Fatalf("Error occurred while getting LAST_BALANCE:%s from Redis: %v, exiting...", targetTokenSymbol, err)
+				log.Errorf("Error occurred while fetching token balances and router allowances: %v", err)
+				et.Record(pair, err)
+				return dur
 			}
-		}
+			log.Debugf("%s Balance: %s", targetTokenSymbol, balancesAndAllowances[targetTokenAddress].Balance)
+			log.Debugf("%s Balance: %s", stableTokenSymbol, balancesAndAllowances[stableTokenAddress].Balance)
+			log.Debugf("%s Allowance: %s", targetTokenSymbol, balancesAndAllowances[targetTokenAddress].Allowance)
+			log.Debugf("%s Allowance: %s", stableTokenSymbol, balancesAndAllowances[stableTokenAddress].Allowance)
+			RecordBalanceMetric(targetToken, balancesAndAllowances[targetTokenAddress].Balance)
+			RecordBalanceMetric(stableToken, balancesAndAllowances[stableTokenAddress].Balance)
+			log.Debug("Fetched wallet token balances and router allowances successfully")
 
-		if balancesAndAllowances[targetTokenAddress].Balance != "0" {
-			if b1 != balancesAndAllowances[targetTokenAddress].Balance {
-				if err := rdb.Set(context.TODO(), fmt.Sprintf("LAST_BALANCE:%s", targetTokenSymbol), balancesAndAllowances[targetTokenAddress].Balance, 0).Err(); err != nil {
-					log.Fatalf("Error occurred while setting LAST_BALANCE:%s in Redis: %v, exiting...", targetTokenSymbol, err)
+			log.Debug("Checking router allowances...")
+			for tokenAddress, tokenSymbol := range map[string]string{targetTokenAddress: targetTokenSymbol, stableTokenAddress: stableTokenSymbol} {
+				// EIP-2612 permits authorize the router per order, only tokens without permit support need an allowance.
+				needsAllowance, err := RequiresAllowance(context.TODO(), ps, tokenAddress)
+				if err != nil {
+					log.Errorf("Error occurred while checking %s permit support: %v", tokenSymbol, err)
+					et.Record(pair, err)
+					return dur
 				}
-				if err := rdb.LPush(context.TODO(), fmt.Sprintf("BALANCES:%s", targetTokenSymbol), balancesAndAllowances[targetTokenAddress].Balance).Err(); err != nil {
-					log.Fatalf("Error occurred while pushing %s balance to Redis: %v, exiting...", targetTokenSymbol, err)
+				if !needsAllowance {
+					continue
+				}
+
+				if am == nil {
+					if balancesAndAllowances[tokenAddress].Allowance == "0" {
+						n.Notify(Event{
+							Type:    EventAllowanceMissing,
+							Pair:    pair,
+							Message: fmt.Sprintf("Insufficient router allowance for %s", tokenSymbol),
+							Data:    map[string]any{"token": tokenSymbol, "tokenAddress": tokenAddress},
+						})
+						err := fmt.Errorf("insufficient router allowance for %s", tokenSymbol)
+						log.Errorf("Error occurred while checking router allowances: %v", err)
+						hm.Report("allowances", err)
+						et.Record(pair, err)
+						return dur
+					}
+					continue
+				}
+
+				if balancesAndAllowances[tokenAddress].Balance == "0" {
+					continue
+				}
+
+				required, ok := new(big.Int).SetString(balancesAndAllowances[tokenAddress].Balance, 10)
+				if !ok {
+					err := fmt.Errorf("invalid %s balance: %s", tokenSymbol, balancesAndAllowances[tokenAddress].Balance)
+					log.Errorf("Error occurred while checking router allowances: %v", err)
+					et.Record(pair, err)
+					return dur
+				}
+
+				// The reported allowances are granted to the router, so they only spare the on-chain read without Permit2.
+				if permitMode != Permit2Permit {
+					if allowance, ok := new(big.Int).SetString(balancesAndAllowances[tokenAddress].Allowance, 10); ok && allowance.Cmp(required) >= 0 {
+						continue
+					}
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), allowanceTimeout)
+				_, err = am.EnsureAllowance(ctx, tokenAddress, required)
+				cancel()
+				if err != nil {
+					n.Notify(Event{
+						Type:    EventAllowanceMissing,
+						Pair:    pair,
+						Message: fmt.Sprintf("Error occurred while approving router allowance for %s: %v", tokenSymbol, err),
+						Data:    map[string]any{"token": tokenSymbol, "tokenAddress": tokenAddress, "error": err.Error()},
+					})
+					log.Errorf("Error occurred while approving router allowance for %s: %v", tokenSymbol, err)
+					hm.Report("allowances", err)
+					et.Record(pair, err)
+					return dur
 				}
 			}
-		}
+			hm.Report("allowances", nil)
+			log.Debug("Checked router allowances successfully")
 
-		b2, err := rdb.Get(context.TODO(), fmt.Sprintf("LAST_BALANCE:%s", stableTokenSymbol)).Result()
-		if err == redis.Nil {
-			log.Warnf("Key LAST_BALANCE:%s does not exist in Redis, creating it...", stableTokenSymbol)
-			if err := rdb.Set(context.TODO(), fmt.Sprintf("LAST_BALANCE:%s", stableTokenSymbol), balancesAndAllowances[stableTokenAddress].Balance, 0).Err(); err != nil {
-				log.Fatalf("Error occurred while setting LAST_BALANCE:%s in Redis: %v, exiting...", stableTokenSymbol, err)
+			log.Debug("Checking token balances...")
+			// Another pair may have committed a shared token, so an empty wallet only skips the pair.
+			if balancesAndAllowances[targetTokenAddress].Balance == "0" && balancesAndAllowances[stableTokenAddress].Balance == "0" {
+				log.Warnf("Insufficient wallet balances for %s and %s, skipping...", targetTokenSymbol, stableTokenSymbol)
+				return dur
 			}
-		} else {
+			log.Debug("Checked token balances successfully")
+
+			log.Debug("Updating open trades in journal...")
+			updatedTrades, err := UpdateOpenTrades(fst, r, pair)
 			if err != nil {
-				log.Fatalf("Error occurred while getting LAST_BALANCE:%s from Redis: %v, exiting...", stableTokenSymbol, err)
+				log.Errorf("Error occurred while updating open trades: %v", err)
+				et.Record(pair, err)
+			} else {
+				log.Debug("Updated open trades in journal successfully")
+			}
+			for _, trade := range updatedTrades {
+				event := Event{
+					Pair: pair,
+					Data: map[string]any{
+						"orderHash":   trade.OrderHash,
+						"orderType":   trade.OrderType,
+						"from":        trade.FromTokenSymbol,
+						"to":          trade.ToTokenSymbol,
+						"filledFrom":  trade.FilledFromTokenAmount,
+						"filledTo":    trade.FilledToTokenAmount,
+						"quotedPrice": trade.Price,
+					},
+					DedupeKey: fmt.Sprintf("%s:%s", trade.OrderHash, trade.Status),
+				}
+				switch trade.Status {
+				case TradeFilled:
+					sched.Cooldown(pair, FillCooldown)
+					event.Type = EventOrderFilled
+					event.Message = fmt.Sprintf("%s order %s filled", trade.OrderType, trade.OrderHash)
+				case TradeExpired:
+					event.Type = EventOrderExpired
+					event.Message = fmt.Sprintf("%s order %s expired", trade.OrderType, trade.OrderHash)
+				default:
+					continue
+				}
+				n.Notify(event)
 			}
-		}
 
-		if balancesAndAllowances[stableTokenAddress].Balance != "0" {
-			if b2 != balancesAndAllowances[stableTokenAddress].Balance {
-				if err := rdb.Set(context.TODO(), fmt.Sprintf("LAST_BALANCE:%s", stableTokenSymbol), balancesAndAllowances[stableTokenAddress].Balance, 0).Err(); err != nil {
-					log.Fatalf("Error occurred while setting LAST_BALANCE:%s in Redis: %v, exiting...", stableTokenSymbol, err)
+			log.Debug("Updating token balances in state store...")
+			for tokenAddress, tokenSymbol := range map[string]string{targetTokenAddress: targetTokenSymbol, stableTokenAddress: stableTokenSymbol} {
+				balance := balancesAndAllowances[tokenAddress].Balance
+
+				lastBalance, ok, err := st.GetLastBalance(tokenSymbol)
+				if err != nil {
+					log.Errorf("Error occurred while getting last %s balance from state store: %v", tokenSymbol, err)
+					et.Record(pair, err)
+					return dur
+				}
+				if !ok {
+					log.Warnf("Last %s balance does not exist in state store, creating it...", tokenSymbol)
+					if err := fst.SetLastBalance(tokenSymbol, balance); err != nil {
+						log.Errorf("Error occurred while setting last %s balance in state store: %v", tokenSymbol, err)
+						et.Record(pair, err)
+						return dur
+					}
 				}
-				if err := rdb.LPush(context.TODO(), fmt.Sprintf("BALANCES:%s", stableTokenSymbol), balancesAndAllowances[stableTokenAddress].Balance).Err(); err != nil {
-					log.Fatalf("Error occurred while pushing %s balance to Redis: %v, exiting...", stableTokenSymbol, err)
+
+				if balance != "0" && lastBalance != balance {
+					if err := fst.SetLastBalance(tokenSymbol, balance); err != nil {
+						log.Errorf("Error occurred while setting last %s balance in state store: %v", tokenSymbol, err)
+						et.Record(pair, err)
+						return dur
+					}
+					if err := fst.PushBalance(tokenSymbol, balance); err != nil {
+						log.Errorf("Error occurred while pushing %s balance to state store: %v", tokenSymbol, err)
+						et.Record(pair, err)
+						return dur
+					}
 				}
 			}
-		}
-		log.Debug("Updated token balances in redis successfully")
+			log.Debug("Updated token balances in state store successfully")
+
+			var fromTokenAddress string
+			var fromTokenSymbol string
+			var fromTokenAmount string
+			var fromTokenDecimals int
+			var toTokenAddress string
+			var toTokenSymbol string
+			var toTokenDecimals int
+
+			// With a token shared by several pairs both balances may be non-zero, the monitor then keeps its side.
+			if balancesAndAllowances[stableTokenAddress].Balance != "0" && (balancesAndAllowances[targetTokenAddress].Balance == "0" || pm.currentOrderType == BuyOrder) {
+				if pm.currentOrderType != BuyOrder {
+					pm.SwitchOrderType(BuyOrder, 0, 0)
+				}
+				fromTokenAddress = stableTokenAddress
+				fromTokenSymbol = stableTokenSymbol
+				fromTokenAmount = balancesAndAllowances[stableTokenAddress].Balance
+				fromTokenDecimals = stableToken.Decimals
+				toTokenAddress = targetTokenAddress
+				toTokenSymbol = targetTokenSymbol
+				toTokenDecimals = targetToken.Decimals
+			}
 
-		var fromTokenAddress string
-		var fromTokenSymbol string
-		var fromTokenAmount string
-		var fromTokenDecimals int
-		var toTokenAddress string
-		var toTokenSymbol string
-		var toTokenDecimals int
+			if balancesAndAllowances[targetTokenAddress].Balance != "0" && (balancesAndAllowances[stableTokenAddress].Balance == "0" || pm.currentOrderType == SellOrder) {
+				if pm.currentOrderType != SellOrder {
+					pm.SwitchOrderType(SellOrder, 0, 0)
+				}
+				fromTokenAddress = targetTokenAddress
+				fromTokenSymbol = targetTokenSymbol
+				fromTokenAmount = balancesAndAllowances[targetTokenAddress].Balance
+				fromTokenDecimals = targetToken.Decimals
+				toTokenAddress = stableTokenAddress
+				toTokenSymbol = stableTokenSymbol
+				toTokenDecimals = stableToken.Decimals
+			}
 
-		if balancesAndAllowances[targetTokenAddress].Balance == "0" && balancesAndAllowances[stableTokenAddress].Balance != "0" {
-			if pm.currentOrderType != BuyOrder {
-				pm.SwitchOrderType(BuyOrder, 0, 0)
+			log.Debugf("Waiting to swap from %s to %s, generating quote...", fromTokenSymbol, toTokenSymbol)
+			quote, err := r.GetQuote(w.Address(), fromTokenAddress, toTokenAddress, fromTokenAmount)
+			if err != nil {
+				log.Errorf("Error occurred while generating quote: %v", err)
+				et.Record(pair, err)
+				return dur
 			}
-			fromTokenAddress = stableTokenAddress
-			fromTokenSymbol = stableTokenSymbol
-			fromTokenAmount = balancesAndAllowances[stableTokenAddress].Balance
-			fromTokenDecimals, err = strconv.Atoi(stableTokenDecimals)
+
+			fromTokenAmountFloat, err := strconv.ParseFloat(fromTokenAmount, 64)
 			if err != nil {
-				log.Fatalf("Error converting stable token decimals: %v, exiting...", err)
+				log.Errorf("Error converting fromTokenAmount to float: %v", err)
+				et.Record(pair, err)
+				return dur
 			}
-			toTokenAddress = targetTokenAddress
-			toTokenSymbol = targetTokenSymbol
-			toTokenDecimals, err = strconv.Atoi(targetTokenDecimals)
+
+			quoteToTokenAmountFloat, err := strconv.ParseFloat(quote.ToTokenAmount, 64)
 			if err != nil {
-				log.Fatalf("Error converting target token decimals: %v, exiting...", err)
+				log.Errorf("Error converting toTokenAmount to float: %v", err)
+				et.Record(pair, err)
+				return dur
+			}
+
+			f1 := (fromTokenAmountFloat / math.Pow(10, float64(fromTokenDecimals)))
+			f2 := (quoteToTokenAmountFloat / math.Pow(10, float64(toTokenDecimals)))
+			currentPrice := 0.0
+
+			if pm.currentOrderType == BuyOrder {
+				currentPrice = f1 / f2
 			}
-		}
 
-		if balancesAndAllowances[targetTokenAddress].Balance != "0" && balancesAndAllowances[stableTokenAddress].Balance == "0" {
-			if pm.currentOrderType != SellOrder {
-				pm.SwitchOrderType(SellOrder, 0, 0)
+			if pm.currentOrderType == SellOrder {
+				currentPrice = f2 / f1
+			}
+			pm.Update(currentPrice)
+			RecordMonitorMetrics(pair, currentPrice, pm)
+			ctrl.PublishStatus(PairStatus{
+				Pair:             pair,
+				OrderType:        pm.currentOrderType.String(),
+				Price:            currentPrice,
+				TriggerPriceUp:   pm.triggerPriceUp,
+				TriggerPriceDown: pm.triggerPriceDown,
+				LimitPercent:     pm.limitPercent,
+				StopLossPercent:  pm.stopLossPercent,
+				Balances: map[string]string{
+					targetTokenSymbol: balancesAndAllowances[targetTokenAddress].Balance,
+					stableTokenSymbol: balancesAndAllowances[stableTokenAddress].Balance,
+				},
+			})
+			if err := fst.SetMonitorState(pair, pm.State()); err != nil {
+				log.Errorf("Error occurred while saving price monitor state: %v", err)
+			}
+
+			log.Infof("Current Exchange Rate: %f %s => %f %s", f1, fromTokenSymbol, f2, toTokenSymbol)
+			log.Debugf("Quote Price Impact: %.4f%%, Fee: %.0f bps, Preset: %s", quote.PriceImpactPercent(), quote.Fee.Bps, quote.RecommendedPreset)
+			log.Debug("Generated swap quote successfully")
+
+			// The USD price of the stable token comes from the spot prices rather than an assumed peg, the target token is
+			// valued at the quoted price.
+			log.Debug("Valuing wallet equity...")
+			spotPrices, err := r.GetSpotPrices([]string{stableTokenAddress}, "USD")
+			if err == nil {
+				var stableTokenPrice float64
+				if stableTokenPrice, err = SpotPrice(spotPrices, stableToken); err == nil {
+					err = errors.Join(
+						we.Update(targetToken, balancesAndAllowances[targetTokenAddress].Balance, currentPrice*stableTokenPrice),
+						we.Update(stableToken, balancesAndAllowances[stableTokenAddress].Balance, stableTokenPrice),
+					)
+				}
 			}
-			fromTokenAddress = targetTokenAddress
-			fromTokenSymbol = targetTokenSymbol
-			fromTokenAmount = balancesAndAllowances[targetTokenAddress].Balance
-			fromTokenDecimals, err = strconv.Atoi(targetTokenDecimals)
 			if err != nil {
-				log.Fatalf("Error converting target token decimals: %v, exiting...", err)
+				log.Errorf("Error occurred while valuing wallet equity: %v", err)
+				et.Record(pair, err)
+			} else if equity := we.Snapshot(); equity != nil {
+				if equity.TotalValue < lowBalance {
+					n.Notify(Event{
+						Type:      EventLowBalance,
+						Message:   fmt.Sprintf("Wallet value %f USD is below %f USD", equity.TotalValue, lowBalance),
+						Data:      map[string]any{"totalValue": equity.TotalValue, "threshold": lowBalance},
+						DedupeKey: string(EventLowBalance),
+					})
+				}
+
+				if we.ClaimRecording(equity.Timestamp, snapshotInterval) {
+					log.Debug("Recording equity snapshot...")
+					if err := st.RecordSnapshot(equity); err != nil {
+						log.Errorf("Error occurred while recording equity snapshot: %v", err)
+						et.Record(pair, err)
+					} else {
+						log.Debugf("Recorded equity snapshot successfully, Total Value: %f USD", equity.TotalValue)
+					}
+				}
 			}
-			toTokenAddress = stableTokenAddress
-			toTokenSymbol = stableTokenSymbol
-			toTokenDecimals, err = strconv.Atoi(stableTokenDecimals)
+
+			pnl, err := pe.Report(pair, currentPrice)
 			if err != nil {
-				log.Fatalf("Error converting stable token decimals: %v, exiting...", err)
+				log.Errorf("Error occurred while computing PnL: %v", err)
+				et.Record(pair, err)
+			} else {
+				log.Infof("Position: %f %s, Cost Basis: %f %s, Realized PnL: %f %s, Unrealized PnL: %f %s", pnl.Position, targetTokenSymbol, pnl.CostBasis, stableTokenSymbol, pnl.RealizedPnL, stableTokenSymbol, pnl.UnrealizedPnL, stableTokenSymbol)
 			}
-		}
 
-		log.Debugf("Waiting to swap from %s to %s, generating quote...", fromTokenSymbol, toTokenSymbol)
-		quote, err := r.GetQuote(w.Address(), fromTokenAddress, toTokenAddress, fromTokenAmount)
-		if err != nil {
-			log.Fatalf("Error occurred while generating quote: %v, exiting...", err)
-		}
+			isTriggered := pm.IsTriggered()
+			triggerReason := fmt.Sprintf("%s threshold crossed at price %f", pm.currentOrderType, currentPrice)
+			if ctrl.IsPaused() {
+				log.Infof("Trading is paused for %s", pair)
+				isTriggered = false
+			}
+			if reason := sched.Blocked(pair, time.Now()); reason != "" && isTriggered {
+				log.Infof("Not trading %s while %s", pair, reason)
+				isTriggered = false
+			}
+			if commands.ForceTrade {
+				log.Infof("Forcing %s order for %s", pm.currentOrderType, pair)
+				isTriggered = true
+				triggerReason = fmt.Sprintf("%s forced by admin at price %f", pm.currentOrderType, currentPrice)
+			}
+			if commands.Flatten {
+				if pm.currentOrderType == SellOrder {
+					log.Warnf("Flattening %s to %s", targetTokenSymbol, stableTokenSymbol)
+					isTriggered = true
+					triggerReason = fmt.Sprintf("flatten requested by admin at price %f", currentPrice)
+				} else {
+					log.Infof("Already flat in %s, nothing to flatten", stableTokenSymbol)
+				}
+			}
+			log.Infof("Waiting to %s, Triggered: %t, Current Price: 1 %s = %f %s, Up: %f %s, Down %f %s", pm.currentOrderType.String(), isTriggered, targetTokenSymbol, currentPrice, stableTokenSymbol, pm.triggerPriceUp, stableTokenSymbol, pm.triggerPriceDown, stableTokenSymbol)
 
-		fromTokenAmountFloat, err := strconv.ParseFloat(fromTokenAmount, 64)
-		if err != nil {
-			log.Fatalf("Error converting fromTokenAmount to float: %v, exiting...", err)
-		}
+			urgency := NormalUrgency
+			if commands.Flatten && pm.currentOrderType == SellOrder {
+				urgency = FlattenUrgency
+			} else if !commands.ForceTrade {
+				urgency = ClassifyTrade(pm, currentPrice)
+			}
+			preset, err := pp.Select(urgency, quote)
+			if err != nil {
+				log.Errorf("Error occurred while selecting the %s preset, using %s: %v", urgency, quote.RecommendedPreset, err)
+				et.Record(pair, err)
+				preset = quote.RecommendedPreset
+			}
+			log.Debugf("Selected %s preset for %s trade", preset, urgency)
 
-		quoteToTokenAmountFloat, err := strconv.ParseFloat(quote.ToTokenAmount, 64)
-		if err != nil {
-			log.Fatalf("Error converting toTokenAmount to float: %v, exiting...", err)
-		}
+			dur = sched.Interval(pair, pm, currentPrice)
+			if isTriggered {
+				if ok, err := le.CheckLeadership(); err != nil || !ok {
+					log.Warnf("Leadership could not be confirmed, skipping order submission (error: %v)", err)
+					return dur
+				}
 
-		f1 := (fromTokenAmountFloat / math.Pow(10, float64(fromTokenDecimals)))
-		f2 := (quoteToTokenAmountFloat / math.Pow(10, float64(toTokenDecimals)))
-		currentPrice := 0.0
+				// Workers submit one at a time per wallet, and never commit a balance reserved by the open orders of another pair.
+				unlock := ser.Lock(w.Address())
+				defer unlock()
 
-		if pm.currentOrderType == BuyOrder {
-			currentPrice = f1 / f2
-		}
+				bc.Invalidate(w.Address())
+				fresh, err := bc.BalancesAndAllowances(w.Address(), []string{fromTokenAddress})
+				if err != nil {
+					log.Errorf("Error occurred while refreshing %s balance, skipping order submission: %v", fromTokenSymbol, err)
+					et.Record(pair, err)
+					return dur
+				}
+				reserved, err := ser.Reserved(fromTokenAddress, pair)
+				if err != nil {
+					log.Errorf("Error occurred while reading open orders, skipping order submission: %v", err)
+					et.Record(pair, err)
+					return dur
+				}
+				available, ok := new(big.Int).SetString(fresh[fromTokenAddress].Balance, 10)
+				if !ok {
+					log.Errorf("Invalid %s balance: %s, skipping order submission", fromTokenSymbol, fresh[fromTokenAddress].Balance)
+					return dur
+				}
+				available.Sub(available, reserved)
+				if amount, ok := new(big.Int).SetString(fromTokenAmount, 10); !ok || available.Cmp(amount) < 0 {
+					log.Warnf("Only %s of %s %s is available after %s reserved by other pairs, skipping order submission", available, fromTokenAmount, fromTokenSymbol, reserved)
+					return dur
+				}
 
-		if pm.currentOrderType == SellOrder {
-			currentPrice = f2 / f1
-		}
-		pm.Update(currentPrice)
+				// Flattening reduces exposure, so it is never held back by the risk limits.
+				if !commands.Flatten {
+					notional := f1
+					if pm.currentOrderType == SellOrder {
+						notional = f2
+					}
+					if err := rm.Check(pair, notional); err != nil {
+						var limitErr *RiskLimitError
+						if errors.As(err, &limitErr) {
+							log.Warnf("Refusing %s order of %f %s: %v", pm.currentOrderType, notional, stableTokenSymbol, err)
+							n.Notify(Event{
+								Type:      EventRiskLimitBreached,
+								Pair:      pair,
+								Message:   fmt.Sprintf("Refused %s order of %f %s: %v", pm.currentOrderType, notional, stableTokenSymbol, err),
+								Data:      map[string]any{"limit": limitErr.Limit, "value": limitErr.Value, "max": limitErr.Max, "notional": notional},
+								DedupeKey: fmt.Sprintf("%s:%s:%s", EventRiskLimitBreached, pair, limitErr.Limit),
+							})
+						} else {
+							log.Errorf("Error occurred while checking risk limits, skipping order submission: %v", err)
+							et.Record(pair, err)
+						}
+						return dur
+					}
+				}
 
-		log.Infof("Current Exchange Rate: %f %s => %f %s", f1, fromTokenSymbol, f2, toTokenSymbol)
-		log.Debug("Generated swap quote successfully")
+				if pg != nil {
+					if err := pg.Check(pm.currentOrderType, currentPrice); err != nil {
+						var deviationErr *PriceDeviationError
+						if errors.As(err, &deviationErr) {
+							log.Warnf("Blocking %s order: %v", pm.currentOrderType, err)
+							n.Notify(Event{
+								Type:      EventPriceDeviation,
+								Pair:      pair,
+								Message:   fmt.Sprintf("Blocked %s order: %v", pm.currentOrderType, err),
+								Data:      map[string]any{"price": deviationErr.Price, "referencePrice": deviationErr.ReferencePrice, "deviationPercent": deviationErr.DeviationPercent},
+								DedupeKey: fmt.Sprintf("%s:%s", EventPriceDeviation, pair),
+							})
+						} else {
+							log.Errorf("Error occurred while reading %s reference price, skipping order submission: %v", pg.Name(), err)
+							et.Record(pair, err)
+						}
+						return dur
+					}
+				}
 
-		log.Debug("Creating order data...")
-		order, err := r.CreateOrder(w.Address(), fromTokenAddress, toTokenAddress, fromTokenAmount, quote)
-		if err != nil {
-			log.Fatalf("Error occurred while creating order data for signing: %v, exiting...", err)
-		}
-		log.Debugf("Created order with hash: %s successfully", order.OrderHash)
+				if ig != nil {
+					if err := ig.Check(pm.currentOrderType, quote, preset); err != nil {
+						var impactErr *PriceImpactError
+						if errors.As(err, &impactErr) {
+							log.Warnf("Rejecting %s order: %v", pm.currentOrderType, err)
+							n.Notify(Event{
+								Type:      EventPriceImpact,
+								Pair:      pair,
+								Message:   fmt.Sprintf("Rejected %s order: %v", pm.currentOrderType, err),
+								Data:      map[string]any{"effectivePrice": impactErr.EffectivePrice, "referencePrice": impactErr.ReferencePrice, "impactPercent": impactErr.ImpactPercent},
+								DedupeKey: fmt.Sprintf("%s:%s", EventPriceImpact, pair),
+							})
+						} else {
+							log.Errorf("Error occurred while checking price impact, skipping order submission: %v", err)
+							et.Record(pair, err)
+						}
+						return dur
+					}
+				}
 
-		log.Debug("Signing order...")
-		orderTypedDataBytes, err := json.Marshal(order.TypedData)
-		if err != nil {
-			log.Fatalf("Error occurred while marshaling order typed data: %v, exiting...", err)
-		}
-		signature, err := w.SignEIP712Message(orderTypedDataBytes)
-		if err != nil {
-			log.Fatalf("Error occurred while signing order: %v, exiting...", err)
-		}
-		signatureHex := hexutil.Encode(signature)
-		log.Debugf("Signed EIP-712 Message Hex: %s", signatureHex)
-		log.Debug("Signed order successfully")
+				// The permit and order are only signed once a trade is about to be submitted, as permits read their nonce on-chain.
+				orderOpts := &CreateOrderOptions{Preset: preset}
+				if ps != nil {
+					log.Debug("Signing permit...")
+					amount, ok := new(big.Int).SetString(fromTokenAmount, 10)
+					if !ok {
+						err := fmt.Errorf("invalid %s amount: %s", fromTokenSymbol, fromTokenAmount)
+						log.Errorf("Error occurred while signing permit, skipping order submission: %v", err)
+						et.Record(pair, err)
+						return dur
+					}
+					signed, err := SignOrderPermit(context.TODO(), ps, orderOpts, fromTokenAddress, amount)
+					if err != nil {
+						log.Errorf("Error occurred while signing permit, skipping order submission: %v", err)
+						et.Record(pair, err)
+						return dur
+					}
+					if signed {
+						log.Debugf("Signed %s permit for %s %s successfully", ps.Mode(), fromTokenAmount, fromTokenSymbol)
+					} else {
+						log.Debugf("%s does not support permits, relying on the router allowance", fromTokenSymbol)
+					}
+				}
 
-		isTriggered := ((pm.currentOrderType == SellOrder && currentPrice > 115000.0) || (pm.currentOrderType == BuyOrder && currentPrice < 100000.0))
-		log.Infof("Waiting to %s, Triggered: %t, Current Price: 1 %s = %f %s, Up: %f %s, Down %f %s", pm.currentOrderType.String(), isTriggered, targetTokenSymbol, currentPrice, stableTokenSymbol, pm.triggerPriceUp, stableTokenSymbol, pm.triggerPriceDown, stableTokenSymbol)
+				log.Debug("Creating order data...")
+				order, err := r.CreateOrder(w.Address(), fromTokenAddress, toTokenAddress, fromTokenAmount, quote, orderOpts)
+				if err != nil {
+					log.Errorf("Error occurred while creating order data for signing, skipping order submission: %v", err)
+					et.Record(pair, err)
+					return dur
+				}
+				log.Debugf("Created order with hash: %s successfully", order.OrderHash)
 
-		dur := 10 * time.Second
-		if isTriggered {
-			log.Info("Submitting order...")
-			if err := r.SubmitOrder(signatureHex, order, quote); err != nil {
-				log.Errorf("Error occurred while submitting order: %v", err)
-			} else {
-				log.Info("Order submitted successfully")
+				log.Debug("Signing order...")
+				orderTypedDataBytes, err := json.Marshal(order.TypedData)
+				if err != nil {
+					log.Errorf("Error occurred while marshaling order typed data, skipping order submission: %v", err)
+					et.Record(pair, err)
+					return dur
+				}
+				signature, err := w.SignEIP712Message(orderTypedDataBytes)
+				if err != nil {
+					log.Errorf("Error occurred while signing order, skipping order submission: %v", err)
+					et.Record(pair, err)
+					return dur
+				}
+				signatureHex := hexutil.Encode(signature)
+				log.Debugf("Signed EIP-712 Message Hex: %s", signatureHex)
+				log.Debug("Signed order successfully")
+
+				intentId := TradeIntentID(w.Address(), fromTokenAddress, toTokenAddress, fromTokenAmount, pm.Generation())
+				n.Notify(Event{
+					Type:      EventTriggerHit,
+					Pair:      pair,
+					Message:   triggerReason,
+					Data:      map[string]any{"orderType": pm.currentOrderType.String(), "price": currentPrice, "from": fromTokenSymbol, "to": toTokenSymbol, "amount": fromTokenAmount},
+					DedupeKey: fmt.Sprintf("%s:%s", EventTriggerHit, intentId),
+				})
+				intent, err := st.GetIntent(intentId)
+				if err != nil {
+					log.Errorf("Error occurred while loading trade intent %s, skipping order submission: %v", intentId, err)
+					et.Record(pair, err)
+					return dur
+				}
+
+				mayCreate := true
+				if intent == nil {
+					intent = &TradeIntent{
+						ID:               intentId,
+						Pair:             pair,
+						FromTokenAddress: fromTokenAddress,
+						ToTokenAddress:   toTokenAddress,
+						FromTokenAmount:  fromTokenAmount,
+						Generation:       pm.Generation(),
+					}
+				} else if mayCreate, err = ReconcileIntent(r, fst, intent, w.Address()); err != nil {
+					log.Errorf("Error occurred while reconciling trade intent %s, skipping order submission: %v", intentId, err)
+					et.Record(pair, err)
+					return dur
+				}
+
+				if !mayCreate {
+					log.Infof("Trade intent %s is already %s with order %s, skipping order submission", intent.ID, intent.Status, intent.OrderHash)
+					sched.Cooldown(pair, SubmitCooldown)
+					if err := fst.SaveIntent(intent); err != nil {
+						log.Errorf("Error occurred while saving trade intent: %v", err)
+					}
+				} else {
+					// Persist the intent before submitting, so that an ambiguous outcome is reconciled instead of resubmitted.
+					intent.OrderHash = order.OrderHash
+					intent.Salt = order.TypedData.Message.Salt
+					intent.Status = IntentPending
+					intent.Attempts++
+					if err := fst.SaveIntent(intent); errors.Is(err, ErrFenced) {
+						log.Warn("Leader lease was taken over by another instance, skipping order submission")
+						return dur
+					} else if err != nil {
+						log.Errorf("Error occurred while saving trade intent, skipping order submission: %v", err)
+						return dur
+					}
+
+					trade := &TradeRecord{
+						ID:               order.OrderHash,
+						Pair:             pair,
+						OrderType:        pm.currentOrderType.String(),
+						QuoteId:          quote.QuoteId,
+						OrderHash:        order.OrderHash,
+						Signature:        signatureHex,
+						FromTokenAddress: fromTokenAddress,
+						FromTokenSymbol:  fromTokenSymbol,
+						FromTokenAmount:  fromTokenAmount,
+						ToTokenAddress:   toTokenAddress,
+						ToTokenSymbol:    toTokenSymbol,
+						ToTokenAmount:    quote.ToTokenAmount,
+						Price:            currentPrice,
+						TriggerReason:    triggerReason,
+						Status:           TradePending,
+					}
+					if err := fst.RecordTrade(trade); err != nil {
+						log.Errorf("Error occurred while recording trade in journal: %v", err)
+					}
+
+					log.Info("Submitting order...")
+					if err := r.SubmitOrder(signatureHex, order, quote); err != nil {
+						log.Errorf("Error occurred while submitting order: %v", err)
+						et.Record(pair, err)
+						trade.Status = TradeSubmitFailed
+						trade.SubmitError = err.Error()
+						if IsDefiniteRejection(err) {
+							intent.Status = IntentFailed
+						}
+						sched.Cooldown(pair, FailureCooldown)
+					} else {
+						log.Info("Order submitted successfully")
+						n.Notify(Event{
+							Type:      EventOrderSubmitted,
+							Pair:      pair,
+							Message:   fmt.Sprintf("%s order %s submitted", pm.currentOrderType, order.OrderHash),
+							Data:      map[string]any{"orderHash": order.OrderHash, "orderType": pm.currentOrderType.String(), "price": currentPrice, "from": fromTokenSymbol, "to": toTokenSymbol, "amount": fromTokenAmount},
+							DedupeKey: fmt.Sprintf("%s:%s", EventOrderSubmitted, order.OrderHash),
+						})
+						trade.Status = TradeSubmitted
+						intent.Status = IntentSubmitted
+						bc.Invalidate(w.Address())
+						sched.Cooldown(pair, SubmitCooldown)
+					}
+
+					RecordOrderMetric(pair, trade.Status)
+
+					if err := fst.RecordTrade(trade); err != nil {
+						log.Errorf("Error occurred while recording trade in journal: %v", err)
+					}
+					if err := fst.SaveIntent(intent); err != nil {
+						log.Errorf("Error occurred while saving trade intent: %v", err)
+					}
+				}
 			}
-			dur = 1 * time.Hour
+			loopDuration.WithLabelValues(pair).Observe(time.Since(loopStart).Seconds())
+
+			return dur
 		}
-		log.Infof("Sleeping for %s before next request...", dur)
-		time.Sleep(dur)
+
+		hm.Watch(pair)
+		sched.Add(pair, func() time.Duration {
+			d := tick()
+			hm.Tick(pair, d)
+			return d
+		}, ctrl.Wake())
+	}
+
+	if adminToken != "" {
+		go ServeHTTP(adminAddress, NewAdminHandler(adminToken, st, controllers))
+	} else {
+		log.Warn("ADMIN_TOKEN is not set, admin API is disabled")
 	}
+
+	sched.Run(context.Background())
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// priceGauge is the current price of the target token in the stable token.
+	priceGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kryptonite_price",
+		Help: "Current price of the target token in the stable token.",
+	}, []string{"pair"})
+
+	// triggerPriceGauge is the price level at which the monitor triggers an order, by direction (up or down).
+	triggerPriceGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kryptonite_trigger_price",
+		Help: "Price level at which the price monitor triggers an order.",
+	}, []string{"pair", "direction"})
+
+	// orderTypeGauge is 1 for the order type the monitor is waiting to place, and 0 for the other.
+	orderTypeGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kryptonite_order_type",
+		Help: "Order type the price monitor is waiting to place (1 for the current type, 0 otherwise).",
+	}, []string{"pair", "order_type"})
+
+	// balanceGauge is the wallet balance of a token, in whole token units.
+	balanceGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kryptonite_balance",
+		Help: "Wallet balance of the token, in whole token units.",
+	}, []string{"token"})
+
+	// requestDuration is the latency of requests to the 1inch API, by endpoint.
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kryptonite_oneinch_request_duration_seconds",
+		Help:    "Latency of requests to the 1inch API.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// requestErrors is the number of failed requests to the 1inch API, by endpoint and status code ("transport" when no response was received).
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kryptonite_oneinch_request_errors_total",
+		Help: "Number of failed requests to the 1inch API.",
+	}, []string{"endpoint", "status"})
+
+	// ordersCounter is the number of orders by outcome (submitted, submit_failed, filled, expired, ...).
+	ordersCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kryptonite_orders_total",
+		Help: "Number of orders by outcome.",
+	}, []string{"pair", "status"})
+
+	// tokenRefreshes is the number of 1inch access token refreshes, by reason (expiring or unauthorized).
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kryptonite_token_refreshes_total",
+		Help: "Number of 1inch access token refreshes.",
+	}, []string{"reason"})
+
+	// tokenIssuedAt is the Unix time the current 1inch access token was issued at, zero until the first refresh.
+	tokenIssuedAt atomic.Int64
+
+	// tokenAge is the time since the current 1inch access token was issued.
+	tokenAge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kryptonite_token_age_seconds",
+		Help: "Time since the current 1inch access token was issued.",
+	}, func() float64 {
+		issuedAt := tokenIssuedAt.Load()
+		if issuedAt == 0 {
+			return 0
+		}
+		return time.Since(time.Unix(issuedAt, 0)).Seconds()
+	})
+
+	// loopDuration is the duration of an iteration of the trading loop, excluding the sleep.
+	loopDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kryptonite_loop_duration_seconds",
+		Help:    "Duration of an iteration of the trading loop, excluding the sleep.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"pair"})
+)
+
+// observeRequest records the latency and outcome of a request to the 1inch API endpoint.
+func observeRequest(endpoint string, start time.Time, resp *http.Response, err error) {
+	requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestErrors.WithLabelValues(endpoint, "transport").Inc()
+		return
+	}
+	if resp.StatusCode >= 400 {
+		requestErrors.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+}
+
+// RecordMonitorMetrics updates the price, trigger level and order type gauges of the pair from the current price and the price monitor.
+func RecordMonitorMetrics(pair string, currentPrice float64, pm *PriceMonitor) {
+	priceGauge.WithLabelValues(pair).Set(currentPrice)
+	triggerPriceGauge.WithLabelValues(pair, "up").Set(pm.triggerPriceUp)
+	triggerPriceGauge.WithLabelValues(pair, "down").Set(pm.triggerPriceDown)
+	for _, orderType := range []OrderType{BuyOrder, SellOrder} {
+		value := 0.0
+		if pm.currentOrderType == orderType {
+			value = 1
+		}
+		orderTypeGauge.WithLabelValues(pair, orderType.String()).Set(value)
+	}
+}
+
+// RecordBalanceMetric updates the balance gauge of the token from its balance in base units.
+func RecordBalanceMetric(token *Token, balance string) {
+	amount, err := strconv.ParseFloat(balance, 64)
+	if err != nil {
+		return
+	}
+	balanceGauge.WithLabelValues(token.Symbol).Set(amount / math.Pow(10, float64(token.Decimals)))
+}
+
+// RecordOrderMetric counts an order outcome for the pair.
+func RecordOrderMetric(pair string, status TradeStatus) {
+	ordersCounter.WithLabelValues(pair, string(status)).Inc()
+}
+
+// RecordTokenRefresh counts an access token refresh for the reason, and records when the new token was issued.
+func RecordTokenRefresh(reason string, issuedAt time.Time) {
+	tokenRefreshes.WithLabelValues(reason).Inc()
+	tokenIssuedAt.Store(issuedAt.Unix())
+}
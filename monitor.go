@@ -24,6 +24,32 @@ type PriceMonitor struct {
 	stopLossPercent  float64
 	previousPrice    float64
 	isTriggered      bool
+	generation       int
+}
+
+// PriceMonitorState is a serializable snapshot of a PriceMonitor, used to resume it after a restart.
+type PriceMonitorState struct {
+	CurrentOrderType OrderType `json:"currentOrderType"`
+	LimitPercent     float64   `json:"limitPercent"`
+	TriggerPriceUp   float64   `json:"triggerPriceUp"`
+	TriggerPriceDown float64   `json:"triggerPriceDown"`
+	StopLossPercent  float64   `json:"stopLossPercent"`
+	PreviousPrice    float64   `json:"previousPrice"`
+	IsTriggered      bool      `json:"isTriggered"`
+	Generation       int       `json:"generation"`
+}
+
+func (pm *PriceMonitor) State() *PriceMonitorState {
+	return &PriceMonitorState{
+		CurrentOrderType: pm.currentOrderType,
+		LimitPercent:     pm.limitPercent,
+		TriggerPriceUp:   pm.triggerPriceUp,
+		TriggerPriceDown: pm.triggerPriceDown,
+		StopLossPercent:  pm.stopLossPercent,
+		PreviousPrice:    pm.previousPrice,
+		IsTriggered:      pm.isTriggered,
+		Generation:       pm.generation,
+	}
 }
 
 func (pm *PriceMonitor) SwitchOrderType(orderType OrderType, triggerPriceUp float64, triggerPriceDown float64) {
@@ -32,6 +58,7 @@ func (pm *PriceMonitor) SwitchOrderType(orderType OrderType, triggerPriceUp floa
 	pm.triggerPriceUp = 1e10
 	pm.triggerPriceDown = -1
 	pm.isTriggered = false
+	pm.generation++
 
 	if triggerPriceUp > 0 {
 		pm.triggerPriceUp = triggerPriceUp
@@ -42,6 +69,29 @@ func (pm *PriceMonitor) SwitchOrderType(orderType OrderType, triggerPriceUp floa
 	}
 }
 
+// SetPercentages changes the limit and stop-loss percentages, re-centering the trigger prices on the last observed price.
+func (pm *PriceMonitor) SetPercentages(limitPercent float64, stopLossPercent float64) {
+	pm.limitPercent = limitPercent
+	pm.stopLossPercent = stopLossPercent
+
+	if pm.previousPrice <= 0 {
+		return
+	}
+
+	if pm.currentOrderType == BuyOrder {
+		pm.triggerPriceUp = pm.previousPrice * (1 + (stopLossPercent / 100))
+		pm.triggerPriceDown = pm.previousPrice * (1 - (limitPercent / 100))
+	} else if pm.currentOrderType == SellOrder {
+		pm.triggerPriceUp = pm.previousPrice * (1 + (limitPercent / 100))
+		pm.triggerPriceDown = pm.previousPrice * (1 - (stopLossPercent / 100))
+	}
+}
+
+// Generation returns the number of times the monitor switched its order type. Each generation trades at most once.
+func (pm *PriceMonitor) Generation() int {
+	return pm.generation
+}
+
 func (pm *PriceMonitor) IsTriggered() bool {
 	return pm.isTriggered
 }
@@ -111,5 +161,24 @@ func NewPriceMonitor(initialOrderType OrderType, initialPrice float64, lastBuyPr
 		panic("unknown order type")
 	}
 
+	// Without a reference price the trigger prices are set by the first update instead.
+	if pm.triggerPriceUp <= 0 {
+		pm.triggerPriceUp = 1e10
+		pm.triggerPriceDown = -1
+	}
+
 	return &pm
 }
+
+func RestorePriceMonitor(state *PriceMonitorState) *PriceMonitor {
+	return &PriceMonitor{
+		currentOrderType: state.CurrentOrderType,
+		limitPercent:     state.LimitPercent,
+		triggerPriceUp:   state.TriggerPriceUp,
+		triggerPriceDown: state.TriggerPriceDown,
+		stopLossPercent:  state.StopLossPercent,
+		previousPrice:    state.PreviousPrice,
+		isTriggered:      state.IsTriggered,
+		generation:       state.Generation,
+	}
+}
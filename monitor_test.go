@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestPriceMonitorWithoutReferencePrice(t *testing.T) {
+	for _, orderType := range []OrderType{BuyOrder, SellOrder} {
+		pm := NewPriceMonitor(orderType, 0, 0, 0.5, 1.0)
+
+		pm.Update(100)
+		if pm.IsTriggered() {
+			t.Errorf("%s: triggered on the first update", orderType)
+		}
+		if pm.triggerPriceUp <= 100 || pm.triggerPriceDown >= 100 {
+			t.Errorf("%s: trigger prices %f/%f do not bracket the first price", orderType, pm.triggerPriceUp, pm.triggerPriceDown)
+		}
+	}
+}
+
+func TestPriceMonitorTriggers(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType OrderType
+		price     float64
+		triggered bool
+	}{
+		{"buy within bands", BuyOrder, 100, false},
+		{"buy limit", BuyOrder, 99, true},
+		{"buy stop-loss", BuyOrder, 102, true},
+		{"sell within bands", SellOrder, 100, false},
+		{"sell limit", SellOrder, 101, true},
+		{"sell stop-loss", SellOrder, 98, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPriceMonitor(tt.orderType, 100, 100, 0.5, 1.0)
+
+			pm.Update(tt.price)
+			if pm.IsTriggered() != tt.triggered {
+				t.Errorf("triggered = %t at %f (up %f, down %f), want %t", pm.IsTriggered(), tt.price, pm.triggerPriceUp, pm.triggerPriceDown, tt.triggered)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// EventType is the type of a notification event.
+type EventType string
+
+const (
+	// EventTriggerHit is sent when the strategy decides to place an order.
+	EventTriggerHit EventType = "trigger_hit"
+
+	// EventOrderSubmitted is sent when the relayer accepts an order.
+	EventOrderSubmitted EventType = "order_submitted"
+
+	// EventOrderFilled is sent when an order is filled.
+	EventOrderFilled EventType = "order_filled"
+
+	// EventOrderExpired is sent when an order expires unfilled.
+	EventOrderExpired EventType = "order_expired"
+
+	// EventErrorThreshold is sent when too many errors occur within the error window.
+	EventErrorThreshold EventType = "error_threshold"
+
+	// EventLowBalance is sent when the wallet value of a pair drops below the configured threshold.
+	EventLowBalance EventType = "low_balance"
+
+	// EventAllowanceMissing is sent when the router allowance of a token is missing.
+	EventAllowanceMissing EventType = "allowance_missing"
+
+	// EventRiskLimitBreached is sent when a trade is refused because it would breach a risk limit.
+	EventRiskLimitBreached EventType = "risk_limit_breached"
+
+	// EventPriceDeviation is sent when trading is blocked because the quote deviates too much from the reference price.
+	EventPriceDeviation EventType = "price_deviation"
+
+	// EventPriceImpact is sent when an order is rejected because its effective price is too far below the reference quote.
+	EventPriceImpact EventType = "price_impact"
+)
+
+// Event is a notification about something that happened in the service.
+type Event struct {
+	// Type is the type of the event.
+	Type EventType `json:"type"`
+
+	// Pair is the pair the event relates to, if any.
+	Pair string `json:"pair,omitempty"`
+
+	// Message is a human readable description of the event.
+	Message string `json:"message"`
+
+	// Data holds event specific details (e.g., order hash, price).
+	Data map[string]any `json:"data,omitempty"`
+
+	// Time is when the event occurred.
+	Time time.Time `json:"time"`
+
+	// DedupeKey identifies repeated occurrences of the same event. Defaults to the type, pair and message.
+	DedupeKey string `json:"-"`
+}
+
+// Notifier delivers notification events.
+type Notifier interface {
+	// Notify queues the event for delivery without blocking.
+	Notify(event Event)
+
+	// Close delivers the queued events, waiting at most the given timeout.
+	Close(timeout time.Duration)
+}
+
+// WebhookConfig configures a webhook receiving notification events.
+type WebhookConfig struct {
+	// URL is the endpoint the events are POSTed to.
+	URL string `json:"url"`
+
+	// Events are the event types delivered to the webhook. Empty means all events.
+	Events []EventType `json:"events"`
+
+	// Template is a text/template rendering the JSON body from the Event. Empty means the Event encoded as JSON.
+	// The "json" function encodes a value as JSON, e.g. {"text": {{json .Message}}}.
+	Template string `json:"template"`
+}
+
+// webhookQueueSize is the number of events each webhook queues while delivering earlier ones.
+const webhookQueueSize = 100
+
+// webhook is a configured webhook with its parsed template and its queue of events waiting for delivery.
+type webhook struct {
+	config   WebhookConfig
+	template *template.Template
+	queue    chan Event
+}
+
+// accepts reports whether the event is delivered to the webhook.
+func (hook *webhook) accepts(event Event) bool {
+	return len(hook.config.Events) == 0 || slices.Contains(hook.config.Events, event.Type)
+}
+
+// webhookNotifier implements the Notifier interface by POSTing JSON to webhooks, each from its own background worker,
+// so that a webhook retrying a failed delivery does not delay the others.
+type webhookNotifier struct {
+	// webhooks are the configured webhooks.
+	webhooks []*webhook
+
+	// client is the HTTP client used for all deliveries.
+	client *http.Client
+
+	// maxRetries is the number of retries of a failed delivery.
+	maxRetries int
+
+	// dedupeWindow is how long repeated events with the same dedupe key are suppressed.
+	dedupeWindow time.Duration
+
+	// mu guards sent, closed and sending to the queues.
+	mu sync.Mutex
+
+	// sent maps dedupe keys to when the event was last queued.
+	sent map[string]time.Time
+
+	// closed reports whether the queues are closed.
+	closed bool
+
+	// workers tracks the workers delivering the queued events.
+	workers sync.WaitGroup
+}
+
+// Notify queues the event for delivery without blocking. Duplicates within the dedupe window are dropped.
+func (n *webhookNotifier) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.DedupeKey == "" {
+		event.DedupeKey = fmt.Sprintf("%s:%s:%s", event.Type, event.Pair, event.Message)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		log.Warnf("Notifier is closed, dropping %s notification", event.Type)
+		return
+	}
+	if last, ok := n.sent[event.DedupeKey]; ok && event.Time.Sub(last) < n.dedupeWindow {
+		log.Debugf("Suppressing duplicate %s notification", event.Type)
+		return
+	}
+
+	queued := false
+	for _, hook := range n.webhooks {
+		if !hook.accepts(event) {
+			continue
+		}
+		select {
+		case hook.queue <- event:
+			queued = true
+		default:
+			log.Warnf("Notification queue of %s is full, dropping %s notification", hook.config.URL, event.Type)
+		}
+	}
+
+	// An event dropped by every webhook is not a duplicate of anything delivered, so the next occurrence is sent.
+	if !queued {
+		return
+	}
+	n.sent[event.DedupeKey] = event.Time
+	for key, last := range n.sent {
+		if event.Time.Sub(last) >= n.dedupeWindow {
+			delete(n.sent, key)
+		}
+	}
+}
+
+// Close delivers the queued events, waiting at most the given timeout.
+func (n *webhookNotifier) Close(timeout time.Duration) {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, hook := range n.webhooks {
+			close(hook.queue)
+		}
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Warn("Timed out while delivering queued notifications")
+	}
+}
+
+// run delivers the events queued for the webhook until its queue is closed.
+func (n *webhookNotifier) run(hook *webhook) {
+	defer n.workers.Done()
+
+	for event := range hook.queue {
+		if err := n.deliver(hook, event); err != nil {
+			log.Errorf("Error occurred while delivering %s notification to %s: %v", event.Type, hook.config.URL, err)
+		}
+	}
+}
+
+// deliver renders the event with the webhook template and POSTs it, retrying with exponential backoff on transport errors,
+// 429 and 5xx responses.
+func (n *webhookNotifier) deliver(hook *webhook, event Event) error {
+	var body []byte
+	if hook.template == nil {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		body = b
+	} else {
+		var buf bytes.Buffer
+		if err := hook.template.Execute(&buf, event); err != nil {
+			return err
+		}
+		if !json.Valid(buf.Bytes()) {
+			return fmt.Errorf("template rendered invalid JSON: %s", buf.String())
+		}
+		body = buf.Bytes()
+	}
+
+	backoff := 1 * time.Second
+	var err error
+	for attempt := 0; attempt <= n.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = n.post(hook.config.URL, body)
+		if err == nil || !retry {
+			return err
+		}
+		log.Warnf("Delivery of %s notification to %s failed (attempt %d/%d): %v", event.Type, hook.config.URL, attempt+1, n.maxRetries+1, err)
+	}
+	return err
+}
+
+// post sends the JSON body to the URL, and reports whether a failure is worth retrying.
+func (n *webhookNotifier) post(url string, body []byte) (bool, error) {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("webhook failed, status code: %s", resp.Status)
+	}
+	return false, nil
+}
+
+// templateFuncs are the functions available in webhook templates.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewWebhookNotifier creates a new Notifier delivering events to the webhooks, and starts a background worker per webhook.
+func NewWebhookNotifier(configs []WebhookConfig, maxRetries int, dedupeWindow time.Duration) (Notifier, error) {
+	return newWebhookNotifier(configs, maxRetries, dedupeWindow, webhookQueueSize)
+}
+
+// newWebhookNotifier creates a new webhookNotifier whose webhooks each queue up to queueSize events.
+func newWebhookNotifier(configs []WebhookConfig, maxRetries int, dedupeWindow time.Duration, queueSize int) (*webhookNotifier, error) {
+	webhooks := make([]*webhook, 0, len(configs))
+	for _, config := range configs {
+		if config.URL == "" {
+			return nil, fmt.Errorf("webhook URL is required")
+		}
+		hook := &webhook{config: config, queue: make(chan Event, queueSize)}
+		if config.Template != "" {
+			t, err := template.New(config.URL).Funcs(templateFuncs).Parse(config.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template for webhook %s: %v", config.URL, err)
+			}
+			hook.template = t
+		}
+		webhooks = append(webhooks, hook)
+	}
+
+	n := &webhookNotifier{
+		webhooks:     webhooks,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		maxRetries:   maxRetries,
+		dedupeWindow: dedupeWindow,
+		sent:         make(map[string]time.Time),
+	}
+	for _, hook := range webhooks {
+		n.workers.Add(1)
+		go n.run(hook)
+	}
+	return n, nil
+}
+
+// ParseWebhookConfigs parses a JSON array of webhook configurations. An empty string means no webhooks.
+func ParseWebhookConfigs(s string) ([]WebhookConfig, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var configs []WebhookConfig
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// ErrorTracker counts errors within a sliding window, and notifies when they reach a threshold.
+type ErrorTracker struct {
+	// mu guards errors.
+	mu sync.Mutex
+
+	// errors are the times of the errors within the window.
+	errors []time.Time
+
+	// threshold is the number of errors within the window that triggers a notification.
+	threshold int
+
+	// window is the length of the sliding window.
+	window time.Duration
+
+	// notifier receives the error threshold events.
+	notifier Notifier
+}
+
+// Record counts the error, and notifies if the threshold is reached within the window.
+func (t *ErrorTracker) Record(pair string, err error) {
+	if t.threshold <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	t.errors = append(t.errors, now)
+	t.errors = slices.DeleteFunc(t.errors, func(at time.Time) bool {
+		return now.Sub(at) > t.window
+	})
+	count := len(t.errors)
+	t.mu.Unlock()
+
+	if count >= t.threshold {
+		t.notifier.Notify(Event{
+			Type:      EventErrorThreshold,
+			Pair:      pair,
+			Message:   fmt.Sprintf("%d errors within %s, last error: %v", count, t.window, err),
+			Data:      map[string]any{"count": count, "window": t.window.String(), "error": err.Error()},
+			DedupeKey: fmt.Sprintf("%s:%s", EventErrorThreshold, pair),
+		})
+	}
+}
+
+// NewErrorTracker creates a new ErrorTracker. A non-positive threshold disables it.
+func NewErrorTracker(notifier Notifier, threshold int, window time.Duration) *ErrorTracker {
+	return &ErrorTracker{
+		threshold: threshold,
+		window:    window,
+		notifier:  notifier,
+	}
+}
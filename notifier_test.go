@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the bodies POSTed to each path, failing the first requests with the configured status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	bodies   map[string][]string
+	failures int
+	status   int
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	rcv.attempts[req.URL.Path]++
+	if rcv.failures > 0 {
+		rcv.failures--
+		w.WriteHeader(rcv.status)
+		return
+	}
+	rcv.bodies[req.URL.Path] = append(rcv.bodies[req.URL.Path], string(body))
+}
+
+func (rcv *webhookReceiver) received(path string) []string {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	return rcv.bodies[path]
+}
+
+func (rcv *webhookReceiver) attempted(path string) int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	return rcv.attempts[path]
+}
+
+func newWebhookReceiver(t *testing.T, failures int, status int) (*webhookReceiver, string) {
+	t.Helper()
+
+	rcv := &webhookReceiver{
+		attempts: make(map[string]int),
+		bodies:   make(map[string][]string),
+		failures: failures,
+		status:   status,
+	}
+	srv := httptest.NewServer(rcv)
+	t.Cleanup(srv.Close)
+	return rcv, srv.URL
+}
+
+func newTestNotifier(t *testing.T, configs []WebhookConfig, maxRetries int, dedupeWindow time.Duration) Notifier {
+	t.Helper()
+
+	n, err := NewWebhookNotifier(configs, maxRetries, dedupeWindow)
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+	return n
+}
+
+func TestWebhookNotifierRetriesServerErrors(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, 1, http.StatusServiceUnavailable)
+	n := newTestNotifier(t, []WebhookConfig{{URL: url + "/hook"}}, 2, time.Hour)
+
+	n.Notify(Event{Type: EventOrderFilled, Pair: "WBTC/USDC", Message: "filled"})
+	n.Close(10 * time.Second)
+
+	if rcv.attempted("/hook") != 2 {
+		t.Errorf("attempts = %d, want 2", rcv.attempted("/hook"))
+	}
+	bodies := rcv.received("/hook")
+	if len(bodies) != 1 {
+		t.Fatalf("received %d events, want 1", len(bodies))
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(bodies[0]), &event); err != nil {
+		t.Fatalf("decoding event: %v", err)
+	}
+	if event.Type != EventOrderFilled || event.Pair != "WBTC/USDC" || event.Message != "filled" || event.Time.IsZero() {
+		t.Errorf("received %+v", event)
+	}
+}
+
+func TestWebhookNotifierDoesNotRetryClientErrors(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, 1, http.StatusBadRequest)
+	n := newTestNotifier(t, []WebhookConfig{{URL: url + "/hook"}}, 2, time.Hour)
+
+	n.Notify(Event{Type: EventOrderFilled, Message: "filled"})
+	n.Close(10 * time.Second)
+
+	if rcv.attempted("/hook") != 1 {
+		t.Errorf("attempts = %d, want 1", rcv.attempted("/hook"))
+	}
+	if bodies := rcv.received("/hook"); len(bodies) != 0 {
+		t.Errorf("received %d events, want 0", len(bodies))
+	}
+}
+
+func TestWebhookNotifierDedupe(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, 0, 0)
+	n := newTestNotifier(t, []WebhookConfig{{URL: url + "/hook"}}, 0, time.Hour)
+
+	n.Notify(Event{Type: EventTriggerHit, Pair: "WBTC/USDC", Message: "first", DedupeKey: "intent"})
+	n.Notify(Event{Type: EventTriggerHit, Pair: "WBTC/USDC", Message: "second", DedupeKey: "intent"})
+	n.Notify(Event{Type: EventLowBalance, Pair: "WBTC/USDC", Message: "low"})
+	n.Notify(Event{Type: EventLowBalance, Pair: "WBTC/USDC", Message: "low"})
+	n.Notify(Event{Type: EventLowBalance, Pair: "WETH/USDC", Message: "low"})
+	n.Close(10 * time.Second)
+
+	if bodies := rcv.received("/hook"); len(bodies) != 3 {
+		t.Errorf("received %d events, want 3: %v", len(bodies), bodies)
+	}
+}
+
+func TestWebhookNotifierDedupeWindowExpires(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, 0, 0)
+	n := newTestNotifier(t, []WebhookConfig{{URL: url + "/hook"}}, 0, time.Minute)
+
+	now := time.Now()
+	n.Notify(Event{Type: EventLowBalance, Message: "low", Time: now})
+	n.Notify(Event{Type: EventLowBalance, Message: "low", Time: now.Add(30 * time.Second)})
+	n.Notify(Event{Type: EventLowBalance, Message: "low", Time: now.Add(2 * time.Minute)})
+	n.Close(10 * time.Second)
+
+	if bodies := rcv.received("/hook"); len(bodies) != 2 {
+		t.Errorf("received %d events, want 2: %v", len(bodies), bodies)
+	}
+}
+
+func TestWebhookNotifierEventFilter(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, 0, 0)
+	n := newTestNotifier(t, []WebhookConfig{
+		{URL: url + "/all"},
+		{URL: url + "/fills", Events: []EventType{EventOrderFilled}},
+	}, 0, time.Hour)
+
+	n.Notify(Event{Type: EventTriggerHit, Message: "trigger"})
+	n.Notify(Event{Type: EventOrderFilled, Message: "filled"})
+	n.Close(10 * time.Second)
+
+	if bodies := rcv.received("/all"); len(bodies) != 2 {
+		t.Errorf("/all received %d events, want 2", len(bodies))
+	}
+	fills := rcv.received("/fills")
+	if len(fills) != 1 {
+		t.Fatalf("/fills received %d events, want 1", len(fills))
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(fills[0]), &event); err != nil {
+		t.Fatalf("decoding event: %v", err)
+	}
+	if event.Type != EventOrderFilled {
+		t.Errorf("/fills received a %s event", event.Type)
+	}
+}
+
+func TestWebhookNotifierTemplate(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, 0, 0)
+	n := newTestNotifier(t, []WebhookConfig{
+		{URL: url + "/chat", Template: `{"text": {{json .Message}}, "pair": {{json .Pair}}, "price": {{json (index .Data "price")}}}`},
+		{URL: url + "/broken", Template: `{"text": {{.Message}}}`},
+	}, 0, time.Hour)
+
+	n.Notify(Event{Type: EventOrderFilled, Pair: "WBTC/USDC", Message: `filled "at" market`, Data: map[string]any{"price": 101.5}})
+	n.Close(10 * time.Second)
+
+	bodies := rcv.received("/chat")
+	if len(bodies) != 1 {
+		t.Fatalf("received %d events, want 1", len(bodies))
+	}
+
+	var body struct {
+		Text  string  `json:"text"`
+		Pair  string  `json:"pair"`
+		Price float64 `json:"price"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &body); err != nil {
+		t.Fatalf("decoding rendered body %s: %v", bodies[0], err)
+	}
+	if body.Text != `filled "at" market` || body.Pair != "WBTC/USDC" || body.Price != 101.5 {
+		t.Errorf("rendered %+v", body)
+	}
+
+	if rcv.attempted("/broken") != 0 {
+		t.Errorf("template rendering invalid JSON was posted %d times", rcv.attempted("/broken"))
+	}
+}
+
+func TestNewWebhookNotifierInvalidConfig(t *testing.T) {
+	if _, err := NewWebhookNotifier([]WebhookConfig{{URL: ""}}, 0, time.Hour); err == nil {
+		t.Error("webhook without URL accepted")
+	}
+	if _, err := NewWebhookNotifier([]WebhookConfig{{URL: "http://localhost", Template: "{{"}}, 0, time.Hour); err == nil {
+		t.Error("webhook with unparsable template accepted")
+	}
+}
+
+// blockingHandler holds every request until released, and records the bodies of the released ones.
+type blockingHandler struct {
+	once     sync.Once
+	release  chan struct{}
+	received chan string
+}
+
+// unblock releases the held and future requests.
+func (h *blockingHandler) unblock() {
+	h.once.Do(func() { close(h.release) })
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	<-h.release
+	h.received <- string(body)
+}
+
+func newBlockingWebhook(t *testing.T) (*blockingHandler, string) {
+	t.Helper()
+
+	h := &blockingHandler{release: make(chan struct{}), received: make(chan string, 10)}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	t.Cleanup(h.unblock)
+	return h, srv.URL
+}
+
+// waitFor fails the test if the condition does not hold within a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookNotifierDoesNotDedupeDroppedEvents(t *testing.T) {
+	h, url := newBlockingWebhook(t)
+	n, err := newWebhookNotifier([]WebhookConfig{{URL: url}}, 0, time.Hour, 1)
+	if err != nil {
+		t.Fatalf("newWebhookNotifier: %v", err)
+	}
+
+	// The worker holds the first event while the second fills the queue, so the third is dropped.
+	n.Notify(Event{Type: EventOrderFilled, Message: "first"})
+	waitFor(t, "the first delivery", func() bool { return len(n.webhooks[0].queue) == 0 })
+	n.Notify(Event{Type: EventOrderFilled, Message: "second"})
+	n.Notify(Event{Type: EventLowBalance, Message: "low"})
+
+	h.unblock()
+	for range 2 {
+		<-h.received
+	}
+
+	// The dropped event was never delivered, so its next occurrence is not suppressed as a duplicate.
+	n.Notify(Event{Type: EventLowBalance, Message: "low"})
+	n.Close(10 * time.Second)
+
+	select {
+	case body := <-h.received:
+		var event Event
+		if err := json.Unmarshal([]byte(body), &event); err != nil || event.Type != EventLowBalance {
+			t.Errorf("received %s, want the low balance event", body)
+		}
+	default:
+		t.Error("the event dropped on a full queue was suppressed when it occurred again")
+	}
+}
+
+func TestWebhookNotifierDeliversIndependently(t *testing.T) {
+	slow, slowUrl := newBlockingWebhook(t)
+	rcv, url := newWebhookReceiver(t, 0, 0)
+	n := newTestNotifier(t, []WebhookConfig{{URL: slowUrl}, {URL: url + "/fast"}}, 0, time.Hour)
+
+	n.Notify(Event{Type: EventTriggerHit, Message: "trigger"})
+	n.Notify(Event{Type: EventOrderFilled, Message: "filled"})
+
+	// Both events reach the healthy webhook while the slow one still holds the first.
+	waitFor(t, "the healthy webhook", func() bool { return len(rcv.received("/fast")) == 2 })
+	if len(slow.received) != 0 {
+		t.Errorf("slow webhook completed %d deliveries before being released", len(slow.received))
+	}
+
+	slow.unblock()
+	n.Close(10 * time.Second)
+	if len(slow.received) != 2 {
+		t.Errorf("slow webhook received %d events, want 2", len(slow.received))
+	}
+}
@@ -2,21 +2,145 @@ package main
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/charmbracelet/log"
 )
 
+// QuoteAuctionPoint is a point of the Dutch auction price curve of a quote preset.
+type QuoteAuctionPoint struct {
+	// Delay is the number of seconds after the previous point.
+	Delay int `json:"delay"`
+
+	// Coefficient is the rate bump at the point.
+	Coefficient int `json:"coefficient"`
+}
+
+// QuoteGasCost is the estimated gas cost of filling an order, used to bump the auction price with the gas price.
+type QuoteGasCost struct {
+	GasBumpEstimate  json.Number `json:"gasBumpEstimate"`
+	GasPriceEstimate json.Number `json:"gasPriceEstimate"`
+}
+
+// QuotePreset represents the Dutch auction parameters of a quote preset (e.g., "fast", "medium", "slow").
+type QuotePreset struct {
+	// AuctionDuration is the duration of the auction, in seconds.
+	AuctionDuration int `json:"auctionDuration"`
+
+	// StartAuctionIn is the delay before the auction starts, in seconds.
+	StartAuctionIn int `json:"startAuctionIn"`
+
+	// InitialRateBump is the rate bump at the start of the auction.
+	InitialRateBump int `json:"initialRateBump"`
+
+	// AuctionStartAmount is the amount of destination tokens the auction starts at.
+	AuctionStartAmount string `json:"auctionStartAmount"`
+
+	// StartAmount is the amount of source tokens sold.
+	StartAmount string `json:"startAmount"`
+
+	// AuctionEndAmount is the amount of destination tokens the auction ends at, i.e. the minimum return of the order.
+	AuctionEndAmount string `json:"auctionEndAmount"`
+
+	// CostInDstToken is the estimated cost of the fill, in destination tokens.
+	CostInDstToken string `json:"costInDstToken"`
+
+	// Points are the points of the auction price curve.
+	Points []QuoteAuctionPoint `json:"points"`
+
+	// AllowPartialFills reports whether the order may be partially filled.
+	AllowPartialFills bool `json:"allowPartialFills"`
+
+	// AllowMultipleFills reports whether the order may be filled by several resolvers.
+	AllowMultipleFills bool `json:"allowMultipleFills"`
+
+	// GasCost is the estimated gas cost of the fill.
+	GasCost QuoteGasCost `json:"gasCost"`
+}
+
+// QuoteFee represents the fee charged on a quote.
+type QuoteFee struct {
+	// Receiver is the address receiving the fee.
+	Receiver string `json:"receiver"`
+
+	// Bps is the fee in basis points.
+	Bps float64 `json:"bps"`
+
+	// WhitelistDiscountPercent is the discount on the fee granted to whitelisted resolvers, in percent.
+	WhitelistDiscountPercent float64 `json:"whitelistDiscountPercent"`
+}
+
 // QuoteResponse represents the response structure for a swap quote from the 1inch API.
 type QuoteResponse struct {
 	QuoteId           string `json:"quoteId"`
 	FromTokenAmount   string `json:"fromTokenAmount"`
 	ToTokenAmount     string `json:"toTokenAmount"`
 	RecommendedPreset string `json:"recommended_preset"`
-	Raw               string `json:"raw"`
+
+	// MarketAmount is the amount of destination tokens the source tokens are worth at the market rate, without fees.
+	MarketAmount string `json:"marketAmount"`
+
+	// FeeToken is the address of the token the fee is charged in.
+	FeeToken string `json:"feeToken"`
+
+	// Fee is the fee charged on the quote.
+	Fee QuoteFee `json:"fee"`
+
+	// SettlementAddress is the address of the settlement contract.
+	SettlementAddress string `json:"settlementAddress"`
+
+	// Presets are the auction presets offered, keyed by name.
+	Presets map[string]QuotePreset `json:"presets"`
+
+	Raw string `json:"raw"`
+}
+
+// Preset returns the auction preset with the given name.
+func (q *QuoteResponse) Preset(name string) (*QuotePreset, error) {
+	preset, ok := q.Presets[name]
+	if !ok {
+		return nil, fmt.Errorf("quote %s has no %s preset", q.QuoteId, name)
+	}
+	return &preset, nil
+}
+
+// MinReturnAmount returns the amount of destination tokens the order receives at worst with the given preset, i.e. the
+// auction end amount, falling back to the quoted amount if the preset does not provide one.
+func (q *QuoteResponse) MinReturnAmount(presetName string) (*big.Int, error) {
+	amount := q.ToTokenAmount
+	if preset, err := q.Preset(presetName); err == nil && preset.AuctionEndAmount != "" {
+		amount = preset.AuctionEndAmount
+	}
+
+	minReturn, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid return amount: %s", amount)
+	}
+	return minReturn, nil
+}
+
+// PriceImpactPercent returns how much less the quoted amount is than the market amount, in percent. It returns zero if
+// the quote has no market amount.
+func (q *QuoteResponse) PriceImpactPercent() float64 {
+	marketAmount, err := strconv.ParseFloat(q.MarketAmount, 64)
+	if err != nil || marketAmount <= 0 {
+		return 0
+	}
+	toTokenAmount, err := strconv.ParseFloat(q.ToTokenAmount, 64)
+	if err != nil {
+		return 0
+	}
+	return (marketAmount - toTokenAmount) / marketAmount * 100
 }
 
 type CreateOrderResponseMessageType struct {
@@ -56,6 +180,20 @@ type CreateOrderResponse struct {
 	Extension string `json:"extension"`
 }
 
+// CreateOrderOptions holds optional parameters for building a swap order on the 1inch API.
+type CreateOrderOptions struct {
+	// Permit is the encoded permit (token address followed by the permit call arguments) authorizing the router
+	// to transfer the maker asset. It is attached to the order extension instead of relying on an allowance.
+	Permit string
+
+	// IsPermit2 indicates whether Permit is a Uniswap Permit2 permit rather than an EIP-2612 permit.
+	IsPermit2 bool
+
+	// Preset is the name of the auction preset of the order. Empty means the recommended preset of the quote.
+	// The custom preset is taken from the presets of the quote.
+	Preset string
+}
+
 // SubmitOrderRequestPayload represents the payload structure for submitting a swap order on the 1inch API.
 type SubmitOrderRequestPayload struct {
 	Extension string                         `json:"extension"`
@@ -68,29 +206,100 @@ type SubmitOrderRequestPayload struct {
 type SubmitOrderResponse struct {
 }
 
-// BalancesAndAllowancesResponse represents the response structure for token balances and allowances from the 1inch API.
-type BalancesAndAllowancesResponse map[string]struct {
+// TokenBalanceAndAllowance represents the balance of a token held by a wallet and the allowance granted to the router.
+type TokenBalanceAndAllowance struct {
 	Balance   string `json:"balance"`
 	Allowance string `json:"allowance"`
 }
 
+// BalancesAndAllowancesResponse represents the response structure for token balances and allowances from the 1inch API.
+type BalancesAndAllowancesResponse map[string]TokenBalanceAndAllowance
+
+// OrderFill represents a single (partial) fill of a swap order.
+type OrderFill struct {
+	TxHash                   string `json:"txHash"`
+	FilledMakerAmount        string `json:"filledMakerAmount"`
+	FilledAuctionTakerAmount string `json:"filledAuctionTakerAmount"`
+}
+
+// OrderStatusResponse represents the response structure for the status of a swap order from the 1inch API.
+type OrderStatusResponse struct {
+	OrderHash string                         `json:"orderHash"`
+	Status    string                         `json:"status"`
+	Order     CreateOrderResponseMessageType `json:"order"`
+	Extension string                         `json:"extension"`
+	Fills     []OrderFill                    `json:"fills"`
+}
+
+// TokenListResponse represents the response structure for the token list from the 1inch API, keyed by token address.
+type TokenListResponse map[string]struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"`
+}
+
+// SpotPricesResponse represents the response structure for token spot prices from the 1inch API, keyed by token address.
+type SpotPricesResponse map[string]string
+
+// RequestError is returned when the 1inch API responds with an unexpected status code.
+type RequestError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Status is the HTTP status line of the response (e.g., "404 Not Found").
+	Status string
+}
+
+func (e *RequestError) Error() string {
+	return "request failed, status code: " + e.Status
+}
+
+// oneInchProxyBaseUrl is the base URL of the API of the 1inch web app.
+const oneInchProxyBaseUrl = "https://proxy-app.1inch.io/v2.0"
+
+// oneInchProxySource is the source parameter the 1inch web app sends with quotes and orders.
+const oneInchProxySource = "0xe26b9977" // TODO(praveen): no idea what this param is for, but it is probably needed by the API
+
+// ordersByMakerPageLimit is the number of orders requested per page of the orders of a maker.
+const ordersByMakerPageLimit = 100
+
+// ordersByMakerMaxPages bounds the number of pages read of the orders of a maker.
+const ordersByMakerMaxPages = 20
+
 // OneInchRouter defines the interface for interacting with the 1inch API.
 type OneInchRouter interface {
 	// GenerateOrRefreshAccessToken generates or refreshes the access token for the 1inch API.
 	GenerateOrRefreshAccessToken() error
 
+	// KeepAccessTokenFresh refreshes the access token in the background before it expires, until the context is cancelled.
+	KeepAccessTokenFresh(ctx context.Context)
+
 	// GetWalletTokenBalancesAndRouterAllowances retrieves the balances and allowances for the specified wallet address
 	GetWalletTokenBalancesAndRouterAllowances(walletAddress string) (BalancesAndAllowancesResponse, error)
 
+	// GetTokenList retrieves the list of tokens known to the 1inch API on the chain.
+	GetTokenList() (TokenListResponse, error)
+
+	// GetSpotPrices retrieves the spot prices of the tokens in the currency (e.g., "USD") from the 1inch API.
+	GetSpotPrices(tokenAddresses []string, currency string) (SpotPricesResponse, error)
+
 	// GetQuote retrieves a swap quote from the 1inch API.
 	GetQuote(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string) (*QuoteResponse, error)
 
-	// CreateOrder creates a swap order on the 1inch API.
-	CreateOrder(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string, quote *QuoteResponse) (*CreateOrderResponse, error)
+	// CreateOrder creates a swap order on the 1inch API. The options may be nil.
+	CreateOrder(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string, quote *QuoteResponse, opts *CreateOrderOptions) (*CreateOrderResponse, error)
 
 	// SubmitOrder submits a swap order to the 1inch API.
 	SubmitOrder(signatureHex string, order *CreateOrderResponse, quote *QuoteResponse) error
 
+	// GetOrderStatus retrieves the status of a submitted swap order from the 1inch API.
+	GetOrderStatus(orderHash string) (*OrderStatusResponse, error)
+
+	// GetOrdersByMaker retrieves the swap orders created by the maker from the 1inch API, reading up to
+	// ordersByMakerMaxPages pages.
+	GetOrdersByMaker(makerAddress string) ([]OrderStatusResponse, error)
+
 	// AccessToken returns the current access token.
 	AccessToken() string
 
@@ -113,16 +322,25 @@ type oneInchRouterSession struct {
 	Exp int64 `json:"exp"`
 }
 
-// oneInchRouter implements the OneInchRouter interface for interacting with the 1inch API.
+// oneInchRouter implements the OneInchRouter interface for interacting with the 1inch API. It is safe for concurrent use.
 type oneInchRouter struct {
-	// session holds the access token and expiration time for the 1inch API.
-	session *oneInchRouterSession
+	// session keeps the access token for the 1inch API.
+	session SessionManager
+
+	// baseUrl is the URL the API paths are relative to.
+	baseUrl string
+
+	// source is the source parameter sent with quotes and orders, if any.
+	source string
 
 	// routerContractAddress is the contract address of the 1inch router.
 	routerContractAddress string
 
 	// chainId is the blockchain network ID (e.g., "1" for Ethereum mainnet).
 	chainId string
+
+	// client is the HTTP client used for all requests to the 1inch API.
+	client *http.Client
 }
 
 // RouterContractAddress returns the contract address of the 1inch router.
@@ -135,27 +353,58 @@ func (r *oneInchRouter) ChainID() string {
 	return r.chainId
 }
 
+// send sends the request to the 1inch API endpoint, recording its latency and outcome in the metrics.
+func (r *oneInchRouter) send(endpoint string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	observeRequest(endpoint, start, resp, err)
+	return resp, err
+}
+
+// do sends the request to the 1inch API endpoint with the access token. If the API rejects the token, it is refreshed
+// and the request is replayed once.
+func (r *oneInchRouter) do(endpoint string, req *http.Request) (*http.Response, error) {
+	token := r.session.AccessToken()
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := r.send(endpoint, req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	log.Warnf("The 1inch API rejected the access token on %s, refreshing it and retrying once...", endpoint)
+	if err := r.session.Invalidate(token); err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.session.AccessToken()))
+	return r.send(endpoint, retry)
+}
+
 // GetWalletTokenBalancesAndRouterAllowances retrieves the token balances and router allowances for the specified wallet address.
 func (r *oneInchRouter) GetWalletTokenBalancesAndRouterAllowances(walletAddress string) (BalancesAndAllowancesResponse, error) {
-	url := fmt.Sprintf("https://proxy-app.1inch.io/v2.0/balance/v1.2/%s/allowancesAndBalances/%s/%s", r.chainId, r.routerContractAddress, walletAddress)
+	url := fmt.Sprintf("%s/balance/v1.2/%s/allowancesAndBalances/%s/%s", r.baseUrl, r.chainId, r.routerContractAddress, walletAddress)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", r.session.AccessToken))
-
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := r.do("balances", req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("request failed, status code: " + resp.Status)
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -171,9 +420,79 @@ func (r *oneInchRouter) GetWalletTokenBalancesAndRouterAllowances(walletAddress
 	return balancesAndAllowancesResponse, nil
 }
 
+// GetTokenList retrieves the list of tokens known to the 1inch API on the chain.
+func (r *oneInchRouter) GetTokenList() (TokenListResponse, error) {
+	url := fmt.Sprintf("%s/token/v1.2/%s", r.baseUrl, r.chainId)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.do("tokens", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenListResponse TokenListResponse
+	if err := json.Unmarshal(bodyBytes, &tokenListResponse); err != nil {
+		return nil, err
+	}
+
+	return tokenListResponse, nil
+}
+
+// GetSpotPrices retrieves the spot prices of the tokens in the currency (e.g., "USD") from the 1inch API.
+func (r *oneInchRouter) GetSpotPrices(tokenAddresses []string, currency string) (SpotPricesResponse, error) {
+	url := fmt.Sprintf("%s/price/v1.1/%s/%s", r.baseUrl, r.chainId, strings.Join(tokenAddresses, ","))
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+
+	q.Add("currency", currency)
+
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := r.do("spot_prices", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var spotPricesResponse SpotPricesResponse
+	if err := json.Unmarshal(bodyBytes, &spotPricesResponse); err != nil {
+		return nil, err
+	}
+
+	return spotPricesResponse, nil
+}
+
 // GetQuote retrieves a swap quote from the 1inch API using the provided token addresses and amount.
 func (r *oneInchRouter) GetQuote(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string) (*QuoteResponse, error) {
-	url := fmt.Sprintf("https://proxy-app.1inch.io/v2.0/fusion/quoter/v2.0/%s/quote/receive", r.chainId)
+	url := fmt.Sprintf("%s/fusion/quoter/v2.0/%s/quote/receive", r.baseUrl, r.chainId)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -189,22 +508,20 @@ func (r *oneInchRouter) GetQuote(walletAddress string, fromTokenAddress string,
 
 	q.Add("enableEstimate", "true")
 	q.Add("showDestAmountMinusFee", "true")
-	q.Add("source", "0xe26b9977") // TODO(praveen): no idea what this param is for, but it is probably needed by the API
+	if r.source != "" {
+		q.Add("source", r.source)
+	}
 
 	req.URL.RawQuery = q.Encode()
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", r.session.AccessToken))
-
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := r.do("quote", req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("request failed, status code: " + resp.Status)
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -236,14 +553,31 @@ func (r *oneInchRouter) GetQuote(walletAddress string, fromTokenAddress string,
 }
 
 // CreateOrder creates a swap order on the 1inch API using the provided wallet address, token addresses, and amount.
-func (r *oneInchRouter) CreateOrder(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string, quote *QuoteResponse) (*CreateOrderResponse, error) {
+func (r *oneInchRouter) CreateOrder(walletAddress string, fromTokenAddress string, toTokenAddress string, fromTokenAmount string, quote *QuoteResponse, opts *CreateOrderOptions) (*CreateOrderResponse, error) {
 	if quote == nil {
 		return nil, errors.New("invalid quote, cannot be nil")
 	}
 
-	url := fmt.Sprintf("https://proxy-app.1inch.io/v2.0/fusion/quoter/v2.0/%s/quote/build", r.chainId)
+	url := fmt.Sprintf("%s/fusion/quoter/v2.0/%s/quote/build", r.baseUrl, r.chainId)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(quote.Raw)))
+	preset := quote.RecommendedPreset
+	if opts != nil && opts.Preset != "" {
+		preset = opts.Preset
+	}
+
+	body := []byte(quote.Raw)
+	if preset == CustomPresetName {
+		customPreset, err := quote.Preset(CustomPresetName)
+		if err != nil {
+			return nil, err
+		}
+		body, err = withCustomPreset(body, customPreset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
@@ -254,24 +588,28 @@ func (r *oneInchRouter) CreateOrder(walletAddress string, fromTokenAddress strin
 	q.Add("amount", fromTokenAmount)
 	q.Add("fromTokenAddress", fromTokenAddress)
 	q.Add("toTokenAddress", toTokenAddress)
-	q.Add("preset", quote.RecommendedPreset)
-	q.Add("source", "0xe26b9977") // TODO(praveen): no idea what this param is for, but it is probably needed by the API
+	q.Add("preset", preset)
+	if r.source != "" {
+		q.Add("source", r.source)
+	}
+
+	if opts != nil && opts.Permit != "" {
+		q.Add("permit", opts.Permit)
+		q.Add("isPermit2", strconv.FormatBool(opts.IsPermit2))
+	}
 
 	req.URL.RawQuery = q.Encode()
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", r.session.AccessToken))
 	req.Header.Add("Content-Type", "application/json; charset=utf-8")
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := r.do("build", req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return nil, errors.New("request failed, status code: " + resp.Status)
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -287,6 +625,32 @@ func (r *oneInchRouter) CreateOrder(walletAddress string, fromTokenAddress strin
 	return &createOrderResponse, nil
 }
 
+// withCustomPreset adds the custom preset to the presets of the raw quote.
+func withCustomPreset(raw []byte, preset *QuotePreset) ([]byte, error) {
+	var quote map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &quote); err != nil {
+		return nil, err
+	}
+
+	presets := make(map[string]json.RawMessage)
+	if p, ok := quote["presets"]; ok {
+		if err := json.Unmarshal(p, &presets); err != nil {
+			return nil, err
+		}
+	}
+
+	customPreset, err := json.Marshal(preset)
+	if err != nil {
+		return nil, err
+	}
+	presets[CustomPresetName] = customPreset
+
+	if quote["presets"], err = json.Marshal(presets); err != nil {
+		return nil, err
+	}
+	return json.Marshal(quote)
+}
+
 // SubmitOrder submits a swap order to the 1inch API.
 func (r *oneInchRouter) SubmitOrder(signatureHex string, order *CreateOrderResponse, quote *QuoteResponse) error {
 	if order == nil {
@@ -297,7 +661,7 @@ func (r *oneInchRouter) SubmitOrder(signatureHex string, order *CreateOrderRespo
 		return errors.New("invalid quote, cannot be nil")
 	}
 
-	url := fmt.Sprintf("https://proxy-app.1inch.io/v2.0/fusion/relayer/v2.0/%s/order/submit", r.chainId)
+	url := fmt.Sprintf("%s/fusion/relayer/v2.0/%s/order/submit", r.baseUrl, r.chainId)
 
 	payload := SubmitOrderRequestPayload{
 		Extension: order.Extension,
@@ -325,77 +689,174 @@ func (r *oneInchRouter) SubmitOrder(signatureHex string, order *CreateOrderRespo
 		return err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", r.session.AccessToken))
 	req.Header.Add("Content-Type", "application/json; charset=utf-8")
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := r.do("submit", req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return errors.New("request failed, status code: " + resp.Status)
+		return &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	return nil
 }
 
-// GenerateOrRefreshAccessToken generates or refreshes the access token for the 1inch API.
-func (r *oneInchRouter) GenerateOrRefreshAccessToken() error {
-	now := time.Now().Unix()
-	diff := r.Expiration() - now - int64((10 * time.Minute).Seconds()) // with 10 minute buffer
+// GetOrderStatus retrieves the status of a submitted swap order from the 1inch API.
+func (r *oneInchRouter) GetOrderStatus(orderHash string) (*OrderStatusResponse, error) {
+	url := fmt.Sprintf("%s/fusion/orders/v2.0/%s/order/status/%s", r.baseUrl, r.chainId, orderHash)
 
-	if diff > 0 {
-		return nil
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	const url = "https://proxy-app.1inch.io/v2.0/auth/token"
+	resp, err := r.do("order_status", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	resp, err := http.Get(url)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var orderStatusResponse OrderStatusResponse
+	if err := json.Unmarshal(bodyBytes, &orderStatusResponse); err != nil {
+		return nil, err
+	}
+
+	return &orderStatusResponse, nil
+}
+
+// GetOrdersByMaker retrieves the swap orders created by the maker from the 1inch API, reading pages until a partial one.
+func (r *oneInchRouter) GetOrdersByMaker(makerAddress string) ([]OrderStatusResponse, error) {
+	var orders []OrderStatusResponse
+	for page := 1; page <= ordersByMakerMaxPages; page++ {
+		pageOrders, err := r.getOrdersByMakerPage(makerAddress, page)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, pageOrders...)
+
+		if len(pageOrders) < ordersByMakerPageLimit {
+			return orders, nil
+		}
+	}
+
+	log.Warnf("Read the first %d pages of the orders of %s only", ordersByMakerMaxPages, makerAddress)
+	return orders, nil
+}
+
+// getOrdersByMakerPage retrieves one page of the swap orders created by the maker from the 1inch API.
+func (r *oneInchRouter) getOrdersByMakerPage(makerAddress string, page int) ([]OrderStatusResponse, error) {
+	url := fmt.Sprintf("%s/fusion/orders/v2.0/%s/order/maker/%s", r.baseUrl, r.chainId, makerAddress)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+
+	q.Add("page", strconv.Itoa(page))
+	q.Add("limit", strconv.Itoa(ordersByMakerPageLimit))
+
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := r.do("orders_by_maker", req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New("request failed, status code: " + resp.Status)
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := json.Unmarshal(bodyBytes, &r.session); err != nil {
-		return err
+	var ordersResponse []OrderStatusResponse
+	if err := json.Unmarshal(bodyBytes, &ordersResponse); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return ordersResponse, nil
+}
+
+// GenerateOrRefreshAccessToken generates or refreshes the access token for the 1inch API. Concurrent callers wait for a
+// single refresh.
+func (r *oneInchRouter) GenerateOrRefreshAccessToken() error {
+	return r.session.Refresh()
+}
+
+// KeepAccessTokenFresh refreshes the access token in the background before it expires, until the context is cancelled.
+func (r *oneInchRouter) KeepAccessTokenFresh(ctx context.Context) {
+	r.session.Run(ctx)
+}
+
+// issueSession requests a new anonymous session from the 1inch API.
+func (r *oneInchRouter) issueSession() (*oneInchRouterSession, error) {
+	url := fmt.Sprintf("%s/auth/token", r.baseUrl)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.send("auth", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var session oneInchRouterSession
+	if err := json.Unmarshal(bodyBytes, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
 }
 
 // AccessToken returns the current access token for the 1inch API.
 func (r *oneInchRouter) AccessToken() string {
-	if r.session == nil {
-		return ""
-	}
-	return r.session.AccessToken
+	return r.session.AccessToken()
 }
 
 // Expiration returns the expiration time of the current access token in Unix timestamp format.
 func (r *oneInchRouter) Expiration() int64 {
-	if r.session == nil {
-		return 0
-	}
-	return r.session.Exp
+	return r.session.Expiration()
 }
 
-// NewOneInchRouter creates a new instance of OneInchRouter with the specified contract address and blockchain id.
-func NewOneInchRouter(contractAddress string, chainId string) OneInchRouter {
-	return &oneInchRouter{
+// NewOneInchRouter creates a new instance of OneInchRouter with the specified contract address and blockchain id. It
+// uses the API of the 1inch web app with an anonymous access token. An empty base URL means the web app API.
+func NewOneInchRouter(baseUrl string, contractAddress string, chainId string) OneInchRouter {
+	r := &oneInchRouter{
+		baseUrl:               cmp.Or(baseUrl, oneInchProxyBaseUrl),
+		source:                oneInchProxySource,
 		routerContractAddress: contractAddress,
 		chainId:               chainId,
+		client:                &http.Client{Timeout: 30 * time.Second},
 	}
+	r.session = NewSessionManager(r.issueSession)
+	return r
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// oneInchDevBaseUrl is the base URL of the 1inch Developer Portal API.
+const oneInchDevBaseUrl = "https://api.1inch.dev"
+
+// apiKeySession implements the SessionManager interface with a static Developer Portal API key, which never expires.
+type apiKeySession struct {
+	// apiKey is the Developer Portal API key.
+	apiKey string
+}
+
+// AccessToken returns the API key.
+func (s *apiKeySession) AccessToken() string {
+	return s.apiKey
+}
+
+// Expiration returns zero, as API keys never expire.
+func (s *apiKeySession) Expiration() int64 {
+	return 0
+}
+
+// Refresh does nothing, as API keys never expire.
+func (s *apiKeySession) Refresh() error {
+	return nil
+}
+
+// Invalidate fails, as a rejected API key cannot be renewed.
+func (s *apiKeySession) Invalidate(token string) error {
+	return errors.New("the 1inch API rejected the API key")
+}
+
+// Run waits for the context to be cancelled, as API keys never expire.
+func (s *apiKeySession) Run(ctx context.Context) {
+	<-ctx.Done()
+}
+
+// NewOneInchDevRouter creates a new instance of OneInchRouter using the documented Fusion, Balance, Token and Spot Price
+// APIs of the 1inch Developer Portal, authenticated with the API key. An empty base URL means the Developer Portal API.
+func NewOneInchDevRouter(apiKey string, baseUrl string, contractAddress string, chainId string) OneInchRouter {
+	return &oneInchRouter{
+		session:               &apiKeySession{apiKey: apiKey},
+		baseUrl:               cmp.Or(baseUrl, oneInchDevBaseUrl),
+		routerContractAddress: contractAddress,
+		chainId:               chainId,
+		client:                &http.Client{Timeout: 30 * time.Second},
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOneInchRequest is a request received by the fake 1inch API.
+type fakeOneInchRequest struct {
+	method        string
+	path          string
+	query         url.Values
+	authorization string
+	body          string
+}
+
+// fakeOneInchAPI serves canned responses for the 1inch API endpoints under a path prefix, and records the requests.
+type fakeOneInchAPI struct {
+	// prefix is the path prefix of the base URL (e.g., "/v2.0" for the web app API).
+	prefix string
+
+	// rejected is the number of upcoming authenticated requests answered with 401.
+	rejected int
+
+	mu       sync.Mutex
+	requests []fakeOneInchRequest
+	sessions int
+}
+
+func (api *fakeOneInchAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, api.prefix)
+	if path == "/auth/token" {
+		api.sessions++
+		fmt.Fprintf(w, `{"access_token":"token-%d","exp":%d}`, api.sessions, time.Now().Add(time.Hour).Unix())
+		return
+	}
+
+	api.requests = append(api.requests, fakeOneInchRequest{
+		method:        req.Method,
+		path:          path,
+		query:         req.URL.Query(),
+		authorization: req.Header.Get("Authorization"),
+		body:          string(body),
+	})
+	if api.rejected > 0 {
+		api.rejected--
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case path == "/fusion/quoter/v2.0/1/quote/receive":
+		w.Write([]byte(`{"quoteId":"quote-1","fromTokenAmount":"100","toTokenAmount":"200","recommended_preset":"fast","k":5,"presets":{"fast":{"auctionEndAmount":"190"}}}`))
+	case path == "/fusion/quoter/v2.0/1/quote/build":
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"orderHash":"0xorder","extension":"0x","typedData":{"message":{"maker":"0xmaker","makingAmount":"100","takingAmount":"190"}}}`))
+	case path == "/fusion/relayer/v2.0/1/order/submit":
+		w.WriteHeader(http.StatusCreated)
+	case path == "/fusion/orders/v2.0/1/order/status/0xorder":
+		w.Write([]byte(`{"orderHash":"0xorder","status":"filled"}`))
+	case strings.HasPrefix(path, "/fusion/orders/v2.0/1/order/maker/"):
+		orders := make([]OrderStatusResponse, 0, ordersByMakerPageLimit)
+		if req.URL.Query().Get("page") == "1" {
+			for i := range ordersByMakerPageLimit {
+				orders = append(orders, OrderStatusResponse{OrderHash: fmt.Sprintf("0x%d", i), Status: "filled"})
+			}
+		} else {
+			orders = append(orders, OrderStatusResponse{OrderHash: "0xlast", Status: "pending"})
+		}
+		json.NewEncoder(w).Encode(orders)
+	case strings.HasPrefix(path, "/balance/v1.2/1/allowancesAndBalances/"):
+		w.Write([]byte(`{"0x00000000000000000000000000000000000000a1":{"balance":"5","allowance":"7"}}`))
+	case strings.HasPrefix(path, "/price/v1.1/1/"):
+		w.Write([]byte(`{"0x00000000000000000000000000000000000000a1":"1.5"}`))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// received returns the requests received on the path.
+func (api *fakeOneInchAPI) received(path string) []fakeOneInchRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	var requests []fakeOneInchRequest
+	for _, req := range api.requests {
+		if req.path == path {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// routerTest is a router under test against the fake 1inch API.
+type routerTest struct {
+	name   string
+	api    *fakeOneInchAPI
+	router OneInchRouter
+
+	// token is the bearer token the router is expected to send.
+	token string
+
+	// source is the source parameter the router is expected to send, empty if none.
+	source string
+}
+
+// newRouterTests starts a fake 1inch API for the web app router and for the Developer Portal router.
+func newRouterTests(t *testing.T) []routerTest {
+	t.Helper()
+
+	proxyApi := &fakeOneInchAPI{prefix: "/v2.0"}
+	proxySrv := httptest.NewServer(proxyApi)
+	t.Cleanup(proxySrv.Close)
+	proxy := NewOneInchRouter(proxySrv.URL+"/v2.0", testRouterAddress.Hex(), "1")
+	if err := proxy.GenerateOrRefreshAccessToken(); err != nil {
+		t.Fatalf("GenerateOrRefreshAccessToken: %v", err)
+	}
+
+	devApi := &fakeOneInchAPI{}
+	devSrv := httptest.NewServer(devApi)
+	t.Cleanup(devSrv.Close)
+	dev := NewOneInchDevRouter("dev-key", devSrv.URL, testRouterAddress.Hex(), "1")
+	if err := dev.GenerateOrRefreshAccessToken(); err != nil {
+		t.Fatalf("GenerateOrRefreshAccessToken: %v", err)
+	}
+
+	return []routerTest{
+		{name: "proxy", api: proxyApi, router: proxy, token: "token-1", source: oneInchProxySource},
+		{name: "dev", api: devApi, router: dev, token: "dev-key"},
+	}
+}
+
+// assertRequest checks that the router sent exactly one request on the path, authenticated and with the expected
+// source parameter, and returns it.
+func (rt routerTest) assertRequest(t *testing.T, method string, path string, hasSource bool) fakeOneInchRequest {
+	t.Helper()
+
+	requests := rt.api.received(path)
+	if len(requests) != 1 {
+		t.Fatalf("%d requests on %s, want 1", len(requests), path)
+	}
+	req := requests[0]
+	if req.method != method {
+		t.Errorf("%s: method = %s, want %s", path, req.method, method)
+	}
+	if want := "Bearer " + rt.token; req.authorization != want {
+		t.Errorf("%s: Authorization = %q, want %q", path, req.authorization, want)
+	}
+
+	source, sent := req.query["source"]
+	switch {
+	case hasSource && rt.source != "" && (len(source) != 1 || source[0] != rt.source):
+		t.Errorf("%s: source = %v, want %s", path, source, rt.source)
+	case (!hasSource || rt.source == "") && sent:
+		t.Errorf("%s: source = %v, want none", path, source)
+	}
+	return req
+}
+
+func TestOneInchRouterEndpoints(t *testing.T) {
+	const (
+		fromToken = "0x00000000000000000000000000000000000000a1"
+		toToken   = "0x00000000000000000000000000000000000000b2"
+	)
+
+	for _, rt := range newRouterTests(t) {
+		t.Run(rt.name, func(t *testing.T) {
+			quote, err := rt.router.GetQuote(testAddress, fromToken, toToken, "100")
+			if err != nil {
+				t.Fatalf("GetQuote: %v", err)
+			}
+			if quote.QuoteId != "quote-1" || quote.ToTokenAmount != "200" || !strings.Contains(quote.Raw, `"slippage":5`) {
+				t.Errorf("quote = %+v", quote)
+			}
+			req := rt.assertRequest(t, "GET", "/fusion/quoter/v2.0/1/quote/receive", true)
+			for key, want := range map[string]string{"walletAddress": testAddress, "amount": "100", "fromTokenAddress": fromToken, "toTokenAddress": toToken} {
+				if got := strings.Join(req.query[key], ","); got != want {
+					t.Errorf("quote %s = %s, want %s", key, got, want)
+				}
+			}
+
+			order, err := rt.router.CreateOrder(testAddress, fromToken, toToken, "100", quote, &CreateOrderOptions{Permit: "0xpermit", IsPermit2: true})
+			if err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+			if order.OrderHash != "0xorder" {
+				t.Errorf("order hash = %s, want 0xorder", order.OrderHash)
+			}
+			req = rt.assertRequest(t, "POST", "/fusion/quoter/v2.0/1/quote/build", true)
+			if req.query.Get("preset") != "fast" || req.query.Get("permit") != "0xpermit" || req.query.Get("isPermit2") != "true" {
+				t.Errorf("build query = %v", req.query)
+			}
+			if req.body != quote.Raw {
+				t.Errorf("build body = %s, want the raw quote %s", req.body, quote.Raw)
+			}
+
+			if err := rt.router.SubmitOrder("0xsignature", order, quote); err != nil {
+				t.Fatalf("SubmitOrder: %v", err)
+			}
+			req = rt.assertRequest(t, "POST", "/fusion/relayer/v2.0/1/order/submit", false)
+			var payload SubmitOrderRequestPayload
+			if err := json.Unmarshal([]byte(req.body), &payload); err != nil {
+				t.Fatalf("decoding submit payload: %v", err)
+			}
+			if payload.Signature != "0xsignature" || payload.QuoteId != "quote-1" || payload.Order.TakingAmount != "190" {
+				t.Errorf("submit payload = %+v", payload)
+			}
+
+			status, err := rt.router.GetOrderStatus("0xorder")
+			if err != nil {
+				t.Fatalf("GetOrderStatus: %v", err)
+			}
+			if status.Status != "filled" {
+				t.Errorf("status = %s, want filled", status.Status)
+			}
+			rt.assertRequest(t, "GET", "/fusion/orders/v2.0/1/order/status/0xorder", false)
+
+			orders, err := rt.router.GetOrdersByMaker(testAddress)
+			if err != nil {
+				t.Fatalf("GetOrdersByMaker: %v", err)
+			}
+			if len(orders) != ordersByMakerPageLimit+1 || orders[len(orders)-1].OrderHash != "0xlast" {
+				t.Errorf("read %d orders, want %d across two pages", len(orders), ordersByMakerPageLimit+1)
+			}
+
+			balances, err := rt.router.GetWalletTokenBalancesAndRouterAllowances(testAddress)
+			if err != nil {
+				t.Fatalf("GetWalletTokenBalancesAndRouterAllowances: %v", err)
+			}
+			if got := balances[fromToken]; got.Balance != "5" || got.Allowance != "7" {
+				t.Errorf("balance = %+v", got)
+			}
+			rt.assertRequest(t, "GET", fmt.Sprintf("/balance/v1.2/1/allowancesAndBalances/%s/%s", testRouterAddress.Hex(), testAddress), false)
+
+			prices, err := rt.router.GetSpotPrices([]string{fromToken, toToken}, "USD")
+			if err != nil {
+				t.Fatalf("GetSpotPrices: %v", err)
+			}
+			if prices[fromToken] != "1.5" {
+				t.Errorf("spot price = %s, want 1.5", prices[fromToken])
+			}
+			req = rt.assertRequest(t, "GET", fmt.Sprintf("/price/v1.1/1/%s,%s", fromToken, toToken), false)
+			if req.query.Get("currency") != "USD" {
+				t.Errorf("spot price currency = %s, want USD", req.query.Get("currency"))
+			}
+		})
+	}
+}
+
+func TestOneInchDevRouterRejectedAPIKey(t *testing.T) {
+	api := &fakeOneInchAPI{rejected: 1}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	r := NewOneInchDevRouter("bad-key", srv.URL, testRouterAddress.Hex(), "1")
+
+	_, err := r.GetQuote(testAddress, testTokenAddress.Hex(), brokenTokenAddress.Hex(), "100")
+	if err == nil || !strings.Contains(err.Error(), "rejected the API key") {
+		t.Fatalf("GetQuote = %v, want the API key rejection", err)
+	}
+	if requests := api.received("/fusion/quoter/v2.0/1/quote/receive"); len(requests) != 1 {
+		t.Errorf("%d quote requests, want 1 without retry", len(requests))
+	}
+	if api.sessions != 0 {
+		t.Errorf("%d sessions requested, want none", api.sessions)
+	}
+}
+
+func TestOneInchRouterRefreshesRejectedToken(t *testing.T) {
+	api := &fakeOneInchAPI{prefix: "/v2.0"}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	r := NewOneInchRouter(srv.URL+"/v2.0", testRouterAddress.Hex(), "1")
+	if err := r.GenerateOrRefreshAccessToken(); err != nil {
+		t.Fatalf("GenerateOrRefreshAccessToken: %v", err)
+	}
+
+	api.mu.Lock()
+	api.rejected = 1
+	api.mu.Unlock()
+
+	order := &CreateOrderResponse{OrderHash: "0xorder"}
+	if err := r.SubmitOrder("0xsignature", order, &QuoteResponse{QuoteId: "quote-1"}); err != nil {
+		t.Fatalf("SubmitOrder: %v", err)
+	}
+
+	requests := api.received("/fusion/relayer/v2.0/1/order/submit")
+	if len(requests) != 2 {
+		t.Fatalf("%d submit requests, want 2", len(requests))
+	}
+	if requests[0].authorization != "Bearer token-1" || requests[1].authorization != "Bearer token-2" {
+		t.Errorf("Authorization = %q then %q, want the refreshed token on retry", requests[0].authorization, requests[1].authorization)
+	}
+	if requests[1].body == "" || requests[1].body != requests[0].body {
+		t.Errorf("retried body = %q, want the original %q", requests[1].body, requests[0].body)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TokenConfig is the user-provided configuration of a token. Empty symbol, name and decimals are discovered.
+type TokenConfig struct {
+	// Address is the address of the token.
+	Address string `json:"address"`
+
+	// Symbol is the expected symbol of the token.
+	Symbol string `json:"symbol"`
+
+	// Name is the expected name of the token.
+	Name string `json:"name"`
+
+	// Decimals is the expected number of decimals of the token.
+	Decimals string `json:"decimals"`
+
+	// ApprovalCap is the maximum router allowance of the token in base units, used in capped approval mode.
+	ApprovalCap string `json:"approvalCap"`
+}
+
+// PairConfig is the configuration of a traded pair.
+type PairConfig struct {
+	// Target is the token being accumulated and sold.
+	Target TokenConfig `json:"target"`
+
+	// Stable is the token prices are denominated in.
+	Stable TokenConfig `json:"stable"`
+
+	// ChainlinkAggregatorAddress is the Chainlink aggregator pricing the target token, used by the chainlink price reference.
+	ChainlinkAggregatorAddress string `json:"chainlinkAggregatorAddress"`
+}
+
+// ParsePairConfigs parses a JSON array of pair configurations. An empty string means the default pair only.
+func ParsePairConfigs(s string, defaultPair PairConfig) ([]PairConfig, error) {
+	if s == "" {
+		return []PairConfig{defaultPair}, nil
+	}
+
+	var configs []PairConfig
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("at least one pair is required")
+	}
+
+	seen := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		if config.Target.Address == "" || config.Stable.Address == "" {
+			return nil, errors.New("target and stable token addresses are required")
+		}
+		key := strings.ToLower(config.Target.Address + ":" + config.Stable.Address)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate pair %s/%s", config.Target.Address, config.Stable.Address)
+		}
+		seen[key] = true
+	}
+	return configs, nil
+}
+
+// PairTokenAddresses returns the distinct token addresses of the pairs, in order of appearance.
+func PairTokenAddresses(configs []PairConfig) []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, config := range configs {
+		for _, address := range []string{config.Target.Address, config.Stable.Address} {
+			if !seen[strings.ToLower(address)] {
+				seen[strings.ToLower(address)] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+// tradedPair is a configured pair with its verified tokens.
+type tradedPair struct {
+	config PairConfig
+	target *Token
+	stable *Token
+}
+
+// Name returns the name of the pair (e.g., "WBTC/USDC").
+func (tp tradedPair) Name() string {
+	return fmt.Sprintf("%s/%s", tp.target.Symbol, tp.stable.Symbol)
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Permit2ContractAddress is the address of the canonical Uniswap Permit2 contract, identical on all supported chains.
+const Permit2ContractAddress = "0x000000000022D473030F116dDEE9F6B43aC78BA3"
+
+// PermitMode determines how the router is authorized to transfer the maker asset of an order.
+type PermitMode int
+
+const (
+	// NoPermit relies on a standing ERC-20 allowance granted to the router.
+	NoPermit PermitMode = iota
+
+	// EIP2612Permit signs an EIP-2612 permit for the token itself.
+	EIP2612Permit
+
+	// Permit2Permit signs a Uniswap Permit2 PermitSingle message.
+	Permit2Permit
+)
+
+var permitModes = map[PermitMode]string{
+	NoPermit:      "none",
+	EIP2612Permit: "eip2612",
+	Permit2Permit: "permit2",
+}
+
+func (pm PermitMode) String() string {
+	return permitModes[pm]
+}
+
+// ParsePermitMode parses a permit mode from its string representation. An empty string selects NoPermit.
+func ParsePermitMode(s string) (PermitMode, error) {
+	if s == "" {
+		return NoPermit, nil
+	}
+	for mode, name := range permitModes {
+		if strings.EqualFold(name, s) {
+			return mode, nil
+		}
+	}
+	return NoPermit, errors.New("unknown permit mode: " + s)
+}
+
+// permitABIJSON is the subset of the EIP-2612 and Permit2 ABIs used to build permits.
+const permitABIJSON = `[
+	{"type":"function","name":"nonces","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"version","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"token","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"amount","type":"uint160"},{"name":"expiration","type":"uint48"},{"name":"nonce","type":"uint48"}]}
+]`
+
+// permitABI is the parsed permit ABI.
+var permitABI = mustParseABI(permitABIJSON)
+
+// eip2612PermitArguments are the arguments of permit(owner, spender, value, deadline, v, r, s) without the selector.
+var eip2612PermitArguments = mustNewArguments("address", "address", "uint256", "uint256", "uint8", "bytes32", "bytes32")
+
+// permit2PermitArguments are the arguments of permit(owner, permitSingle, signature) without the selector.
+var permit2PermitArguments = abi.Arguments{
+	{Type: mustNewType("address", nil)},
+	{Type: mustNewType("tuple", []abi.ArgumentMarshaling{
+		{Name: "details", Type: "tuple", Components: []abi.ArgumentMarshaling{
+			{Name: "token", Type: "address"},
+			{Name: "amount", Type: "uint160"},
+			{Name: "expiration", Type: "uint48"},
+			{Name: "nonce", Type: "uint48"},
+		}},
+		{Name: "spender", Type: "address"},
+		{Name: "sigDeadline", Type: "uint256"},
+	})},
+	{Type: mustNewType("bytes", nil)},
+}
+
+// permit2Details mirrors the Permit2 PermitDetails struct for ABI encoding.
+type permit2Details struct {
+	Token      common.Address
+	Amount     *big.Int
+	Expiration *big.Int
+	Nonce      *big.Int
+}
+
+// permit2PermitSingle mirrors the Permit2 PermitSingle struct for ABI encoding.
+type permit2PermitSingle struct {
+	Details     permit2Details
+	Spender     common.Address
+	SigDeadline *big.Int
+}
+
+// mustNewType creates a new ABI type and panics if it is invalid.
+func mustNewType(t string, components []abi.ArgumentMarshaling) abi.Type {
+	typ, err := abi.NewType(t, "", components)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+// mustNewArguments creates ABI arguments of the given elementary types and panics if any is invalid.
+func mustNewArguments(types ...string) abi.Arguments {
+	args := make(abi.Arguments, 0, len(types))
+	for _, t := range types {
+		args = append(args, abi.Argument{Type: mustNewType(t, nil)})
+	}
+	return args
+}
+
+// ErrPermitUnsupported is returned when signing an EIP-2612 permit for a token that does not implement EIP-2612.
+var ErrPermitUnsupported = errors.New("token does not support EIP-2612 permits")
+
+// PermitSigner signs permits that authorize the router to transfer an exact amount of a token.
+type PermitSigner interface {
+	// SignPermit signs a permit authorizing the router to transfer exactly the amount of the token and returns it
+	// encoded as token address followed by the permit call arguments, ready to be attached to the order extension.
+	SignPermit(ctx context.Context, tokenAddress string, amount *big.Int) (string, error)
+
+	// SupportsPermit reports whether permits can be signed for the token. Tokens without permit support fall back to a
+	// standing allowance granted to the router.
+	SupportsPermit(ctx context.Context, tokenAddress string) (bool, error)
+
+	// Mode returns the permit mode used by the signer.
+	Mode() PermitMode
+}
+
+// permitSigner implements the PermitSigner interface.
+type permitSigner struct {
+	// client is the Ethereum JSON-RPC client used to read nonces and domain data.
+	client EthereumClient
+
+	// wallet is the wallet used to sign permits.
+	wallet Wallet
+
+	// spenderAddress is the address of the router contract being authorized.
+	spenderAddress string
+
+	// mode is the permit mode used by the signer.
+	mode PermitMode
+
+	// ttl is how long a signed permit remains valid.
+	ttl time.Duration
+
+	// mu guards supported.
+	mu sync.Mutex
+
+	// supported caches whether tokens implement EIP-2612, keyed by lowercase token address.
+	supported map[string]bool
+}
+
+// Mode returns the permit mode used by the signer.
+func (ps *permitSigner) Mode() PermitMode {
+	return ps.mode
+}
+
+// SupportsPermit reports whether permits can be signed for the token. Permit2 works with any ERC-20 token approved to
+// the Permit2 contract, while EIP-2612 permits require the token to implement nonces(owner).
+func (ps *permitSigner) SupportsPermit(ctx context.Context, tokenAddress string) (bool, error) {
+	if ps.mode != EIP2612Permit {
+		return ps.mode == Permit2Permit, nil
+	}
+
+	key := strings.ToLower(tokenAddress)
+	ps.mu.Lock()
+	supported, ok := ps.supported[key]
+	ps.mu.Unlock()
+	if ok {
+		return supported, nil
+	}
+
+	_, err := callContract(ctx, ps.client, permitABI, tokenAddress, "nonces", common.HexToAddress(ps.wallet.Address()))
+	switch {
+	case err == nil:
+		supported = true
+	case isMissingFunction(err):
+		supported = false
+	default:
+		return false, err
+	}
+
+	ps.mu.Lock()
+	ps.supported[key] = supported
+	ps.mu.Unlock()
+	return supported, nil
+}
+
+// isMissingFunction reports whether a contract call failed because the contract does not implement the function,
+// either by reverting or by returning no data, as opposed to a transport error.
+func isMissingFunction(err error) bool {
+	return errors.Is(err, errEmptyResponse) || strings.Contains(err.Error(), "execution reverted")
+}
+
+// SignPermit signs a permit authorizing the router to transfer exactly the amount of the token.
+func (ps *permitSigner) SignPermit(ctx context.Context, tokenAddress string, amount *big.Int) (string, error) {
+	deadline := big.NewInt(time.Now().Add(ps.ttl).Unix())
+
+	var encoded []byte
+	var err error
+
+	switch ps.mode {
+	case EIP2612Permit:
+		encoded, err = ps.signEIP2612Permit(ctx, tokenAddress, amount, deadline)
+	case Permit2Permit:
+		encoded, err = ps.signPermit2Permit(ctx, tokenAddress, amount, deadline)
+	default:
+		err = errors.New("permits are disabled")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return hexutil.Encode(append(common.HexToAddress(tokenAddress).Bytes(), encoded...)), nil
+}
+
+// signEIP2612Permit signs an EIP-2612 permit and encodes it as permit(owner, spender, value, deadline, v, r, s) arguments.
+func (ps *permitSigner) signEIP2612Permit(ctx context.Context, tokenAddress string, amount *big.Int, deadline *big.Int) ([]byte, error) {
+	out, err := callContract(ctx, ps.client, erc20ABI, tokenAddress, "name")
+	if err != nil {
+		return nil, err
+	}
+	name := out[0].(string)
+
+	// Tokens that do not expose version() almost universally use "1".
+	version := "1"
+	if out, err := callContract(ctx, ps.client, permitABI, tokenAddress, "version"); err == nil {
+		version = out[0].(string)
+	}
+
+	out, err = callContract(ctx, ps.client, permitABI, tokenAddress, "nonces", common.HexToAddress(ps.wallet.Address()))
+	if err != nil {
+		if isMissingFunction(err) {
+			return nil, fmt.Errorf("%w: %s", ErrPermitUnsupported, tokenAddress)
+		}
+		return nil, err
+	}
+	nonce := out[0].(*big.Int)
+
+	chainId, err := ps.chainId()
+	if err != nil {
+		return nil, err
+	}
+
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Permit": {
+				{Name: "owner", Type: "address"},
+				{Name: "spender", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Permit",
+		Domain: apitypes.TypedDataDomain{
+			Name:              name,
+			Version:           version,
+			ChainId:           chainId,
+			VerifyingContract: tokenAddress,
+		},
+		Message: apitypes.TypedDataMessage{
+			"owner":    ps.wallet.Address(),
+			"spender":  ps.spenderAddress,
+			"value":    amount.String(),
+			"nonce":    nonce.String(),
+			"deadline": deadline.String(),
+		},
+	}
+
+	signature, err := ps.wallet.SignTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	var r, s [32]byte
+	copy(r[:], signature[:32])
+	copy(s[:], signature[32:64])
+
+	return eip2612PermitArguments.Pack(
+		common.HexToAddress(ps.wallet.Address()),
+		common.HexToAddress(ps.spenderAddress),
+		amount,
+		deadline,
+		signature[64],
+		r,
+		s,
+	)
+}
+
+// signPermit2Permit signs a Permit2 PermitSingle and encodes it as permit(owner, permitSingle, signature) arguments
+// with a compact (EIP-2098) signature.
+func (ps *permitSigner) signPermit2Permit(ctx context.Context, tokenAddress string, amount *big.Int, deadline *big.Int) ([]byte, error) {
+	out, err := callContract(ctx, ps.client, permitABI, Permit2ContractAddress, "allowance",
+		common.HexToAddress(ps.wallet.Address()),
+		common.HexToAddress(tokenAddress),
+		common.HexToAddress(ps.spenderAddress),
+	)
+	if err != nil {
+		return nil, err
+	}
+	nonce := out[2].(*big.Int)
+
+	chainId, err := ps.chainId()
+	if err != nil {
+		return nil, err
+	}
+
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"PermitSingle": {
+				{Name: "details", Type: "PermitDetails"},
+				{Name: "spender", Type: "address"},
+				{Name: "sigDeadline", Type: "uint256"},
+			},
+			"PermitDetails": {
+				{Name: "token", Type: "address"},
+				{Name: "amount", Type: "uint160"},
+				{Name: "expiration", Type: "uint48"},
+				{Name: "nonce", Type: "uint48"},
+			},
+		},
+		PrimaryType: "PermitSingle",
+		Domain: apitypes.TypedDataDomain{
+			Name:              "Permit2",
+			ChainId:           chainId,
+			VerifyingContract: Permit2ContractAddress,
+		},
+		Message: apitypes.TypedDataMessage{
+			"details": map[string]interface{}{
+				"token":      tokenAddress,
+				"amount":     amount.String(),
+				"expiration": deadline.String(),
+				"nonce":      nonce.String(),
+			},
+			"spender":     ps.spenderAddress,
+			"sigDeadline": deadline.String(),
+		},
+	}
+
+	signature, err := ps.wallet.SignTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	// EIP-2098: fold the recovery id into the highest bit of s.
+	compact := make([]byte, 64)
+	copy(compact, signature[:64])
+	if signature[64] == 28 {
+		compact[32] |= 0x80
+	}
+
+	return permit2PermitArguments.Pack(
+		common.HexToAddress(ps.wallet.Address()),
+		permit2PermitSingle{
+			Details: permit2Details{
+				Token:      common.HexToAddress(tokenAddress),
+				Amount:     amount,
+				Expiration: deadline,
+				Nonce:      nonce,
+			},
+			Spender:     common.HexToAddress(ps.spenderAddress),
+			SigDeadline: deadline,
+		},
+		compact,
+	)
+}
+
+// chainId returns the wallet chain id in the form expected by the EIP-712 domain.
+func (ps *permitSigner) chainId() (*math.HexOrDecimal256, error) {
+	chainId, ok := new(big.Int).SetString(ps.wallet.ChainID(), 10)
+	if !ok {
+		return nil, errors.New("invalid chain id: " + ps.wallet.ChainID())
+	}
+	return (*math.HexOrDecimal256)(chainId), nil
+}
+
+// RequiresAllowance reports whether the router needs a standing allowance for the token. EIP-2612 permits authorize the
+// router per order, so only tokens without permit support fall back to an approval.
+func RequiresAllowance(ctx context.Context, ps PermitSigner, tokenAddress string) (bool, error) {
+	if ps == nil || ps.Mode() != EIP2612Permit {
+		return true, nil
+	}
+	supported, err := ps.SupportsPermit(ctx, tokenAddress)
+	if err != nil {
+		return false, err
+	}
+	return !supported, nil
+}
+
+// SignOrderPermit signs a permit for the maker asset of an order and attaches it to the order options. Tokens without
+// permit support are left without a permit, so that the order relies on the router allowance instead. It reports whether
+// a permit was attached.
+func SignOrderPermit(ctx context.Context, ps PermitSigner, opts *CreateOrderOptions, tokenAddress string, amount *big.Int) (bool, error) {
+	if ps == nil {
+		return false, nil
+	}
+	supported, err := ps.SupportsPermit(ctx, tokenAddress)
+	if err != nil || !supported {
+		return false, err
+	}
+
+	permit, err := ps.SignPermit(ctx, tokenAddress, amount)
+	if err != nil {
+		return false, err
+	}
+	opts.Permit = permit
+	opts.IsPermit2 = ps.Mode() == Permit2Permit
+	return true, nil
+}
+
+// NewPermitSigner creates a new PermitSigner that authorizes the spender contract with permits valid for the given duration.
+func NewPermitSigner(client EthereumClient, w Wallet, spenderAddress string, mode PermitMode, ttl time.Duration) PermitSigner {
+	return &permitSigner{
+		client:         client,
+		wallet:         w,
+		spenderAddress: spenderAddress,
+		mode:           mode,
+		ttl:            ttl,
+		supported:      make(map[string]bool),
+	}
+}
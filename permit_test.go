@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	permitTokenAddress = common.HexToAddress("0x00000000000000000000000000000000000000c3")
+	permitAmount       = big.NewInt(1_500_000)
+	permitDeadline     = big.NewInt(1_700_000_000)
+)
+
+// Golden encodings of the permits signed by the test wallet on chain 1 for permitAmount and permitDeadline.
+const (
+	goldenEIP2612Permit = "0x" +
+		"000000000000000000000000500d75f1329cf98352c32cf238c2192ca78faffe" +
+		"000000000000000000000000111111125421ca6dc452d289314280a0f8842a65" +
+		"000000000000000000000000000000000000000000000000000000000016e360" +
+		"000000000000000000000000000000000000000000000000000000006553f100" +
+		"000000000000000000000000000000000000000000000000000000000000001c" +
+		"6b245c38e38dd8e5249e68b0fdab09690f88f62adeb156413ecd2f6b1263a1e3" +
+		"19f8f2fc36bd42d3e6653d6ad097dbda91bfac81fefa0a343413b9fa324c933e"
+	goldenPermit2Permit = "0x" +
+		"000000000000000000000000500d75f1329cf98352c32cf238c2192ca78faffe" +
+		"00000000000000000000000000000000000000000000000000000000000000a1" +
+		"000000000000000000000000000000000000000000000000000000000016e360" +
+		"000000000000000000000000000000000000000000000000000000006553f100" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"000000000000000000000000111111125421ca6dc452d289314280a0f8842a65" +
+		"000000000000000000000000000000000000000000000000000000006553f100" +
+		"0000000000000000000000000000000000000000000000000000000000000100" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"5a0b07f99472a7e8fb26fa6640d3f168207d7f7847dab39b4d2aa12ceb9c1e07" +
+		"da11457c90f73ab6912e52124fdb72ae3e8e76363f662bf9f507ac60fbadd1b1"
+)
+
+// newPermitChain serves a token implementing EIP-2612 with nonce 7, the plain test token and the Permit2 contract with
+// nonce 3.
+func newPermitChain(t *testing.T) *stubChain {
+	t.Helper()
+
+	chain := newStubChain(t)
+	permitToken := chain.addToken(permitTokenAddress, 1_000, 0)
+	permitToken.name = "Permit Token"
+	permitToken.nonce = big.NewInt(7)
+	chain.addToken(testTokenAddress, 1_000, 0).name = "Test Token"
+	chain.permit2Nonce = 3
+	return chain
+}
+
+func newTestPermitSigner(t *testing.T, chain *stubChain, mode PermitMode) *permitSigner {
+	t.Helper()
+
+	return NewPermitSigner(chain, newTestWallet(t), testRouterAddress.Hex(), mode, time.Hour).(*permitSigner)
+}
+
+// word left-pads a value to a 32 byte ABI word.
+func word(b []byte) []byte {
+	return common.LeftPadBytes(b, 32)
+}
+
+// eip712Digest hashes the domain separator and struct hash as specified by EIP-712.
+func eip712Digest(domainSeparator []byte, structHash []byte) []byte {
+	return crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, structHash)
+}
+
+// signerOf returns the address that signed the digest with the 32 byte r and s values and the recovery id.
+func signerOf(t *testing.T, digest []byte, r []byte, s []byte, v byte) common.Address {
+	t.Helper()
+
+	signer, err := recoverSigner(digest, append(append(append([]byte{}, r...), s...), v))
+	if err != nil {
+		t.Fatalf("recoverSigner: %v", err)
+	}
+	return common.HexToAddress(signer)
+}
+
+func TestEIP2612PermitGoldenVector(t *testing.T) {
+	ps := newTestPermitSigner(t, newPermitChain(t), EIP2612Permit)
+
+	encoded, err := ps.signEIP2612Permit(context.Background(), permitTokenAddress.Hex(), permitAmount, permitDeadline)
+	if err != nil {
+		t.Fatalf("signEIP2612Permit: %v", err)
+	}
+	if len(encoded) != 224 {
+		t.Fatalf("encoded %d bytes, want 224", len(encoded))
+	}
+	if got := hexutil.Encode(encoded); got != goldenEIP2612Permit {
+		t.Errorf("encoded permit = %s, want %s", got, goldenEIP2612Permit)
+	}
+
+	owner, spender := common.HexToAddress(testAddress), testRouterAddress
+	for i, want := range [][]byte{word(owner.Bytes()), word(spender.Bytes()), word(permitAmount.Bytes()), word(permitDeadline.Bytes())} {
+		if got := encoded[i*32 : (i+1)*32]; !bytes.Equal(got, want) {
+			t.Errorf("word %d = %x, want %x", i, got, want)
+		}
+	}
+
+	// The signature recovers to the wallet over the EIP-712 digest computed independently of the typed data encoder.
+	domainSeparator := crypto.Keccak256(
+		crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)")),
+		crypto.Keccak256([]byte("Permit Token")),
+		crypto.Keccak256([]byte("1")),
+		word(big.NewInt(1).Bytes()),
+		word(permitTokenAddress.Bytes()),
+	)
+	permitTypeHash := crypto.Keccak256([]byte("Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)"))
+	if got := hexutil.Encode(permitTypeHash); got != "0x6e71edae12b1b97f4d1f60370fef10105fa2faae0126114a169c64845d6126c9" {
+		t.Fatalf("permit type hash = %s", got)
+	}
+	structHash := crypto.Keccak256(
+		permitTypeHash,
+		word(owner.Bytes()),
+		word(spender.Bytes()),
+		word(permitAmount.Bytes()),
+		word(big.NewInt(7).Bytes()),
+		word(permitDeadline.Bytes()),
+	)
+
+	v := encoded[4*32+31]
+	if v != 27 && v != 28 {
+		t.Fatalf("v = %d, want 27 or 28", v)
+	}
+	if signer := signerOf(t, eip712Digest(domainSeparator, structHash), encoded[5*32:6*32], encoded[6*32:], v); signer != owner {
+		t.Errorf("permit signed by %s, want %s", signer.Hex(), owner.Hex())
+	}
+}
+
+func TestPermit2PermitGoldenVector(t *testing.T) {
+	ps := newTestPermitSigner(t, newPermitChain(t), Permit2Permit)
+
+	encoded, err := ps.signPermit2Permit(context.Background(), testTokenAddress.Hex(), permitAmount, permitDeadline)
+	if err != nil {
+		t.Fatalf("signPermit2Permit: %v", err)
+	}
+	if len(encoded) != 352 {
+		t.Fatalf("encoded %d bytes, want 352", len(encoded))
+	}
+	if got := hexutil.Encode(encoded); got != goldenPermit2Permit {
+		t.Errorf("encoded permit = %s, want %s", got, goldenPermit2Permit)
+	}
+
+	owner, spender := common.HexToAddress(testAddress), testRouterAddress
+	words := [][]byte{
+		word(owner.Bytes()),
+		word(testTokenAddress.Bytes()),
+		word(permitAmount.Bytes()),
+		word(permitDeadline.Bytes()),
+		word(big.NewInt(3).Bytes()),
+		word(spender.Bytes()),
+		word(permitDeadline.Bytes()),
+		word(big.NewInt(8 * 32).Bytes()),
+		word(big.NewInt(64).Bytes()),
+	}
+	for i, want := range words {
+		if got := encoded[i*32 : (i+1)*32]; !bytes.Equal(got, want) {
+			t.Errorf("word %d = %x, want %x", i, got, want)
+		}
+	}
+
+	// The compact signature recovers to the wallet over the EIP-712 digest computed independently of the encoder.
+	domainSeparator := crypto.Keccak256(
+		crypto.Keccak256([]byte("EIP712Domain(string name,uint256 chainId,address verifyingContract)")),
+		crypto.Keccak256([]byte("Permit2")),
+		word(big.NewInt(1).Bytes()),
+		word(common.HexToAddress(Permit2ContractAddress).Bytes()),
+	)
+	detailsHash := crypto.Keccak256(
+		crypto.Keccak256([]byte("PermitDetails(address token,uint160 amount,uint48 expiration,uint48 nonce)")),
+		word(testTokenAddress.Bytes()),
+		word(permitAmount.Bytes()),
+		word(permitDeadline.Bytes()),
+		word(big.NewInt(3).Bytes()),
+	)
+	structHash := crypto.Keccak256(
+		crypto.Keccak256([]byte("PermitSingle(PermitDetails details,address spender,uint256 sigDeadline)PermitDetails(address token,uint160 amount,uint48 expiration,uint48 nonce)")),
+		detailsHash,
+		word(spender.Bytes()),
+		word(permitDeadline.Bytes()),
+	)
+
+	compact := encoded[9*32:]
+	s := append([]byte{}, compact[32:]...)
+	recoveryId := s[0] >> 7
+	s[0] &= 0x7f
+	if signer := signerOf(t, eip712Digest(domainSeparator, structHash), compact[:32], s, recoveryId); signer != owner {
+		t.Errorf("permit signed by %s, want %s", signer.Hex(), owner.Hex())
+	}
+}
+
+func TestSignPermitPrefixesTokenAddress(t *testing.T) {
+	ps := newTestPermitSigner(t, newPermitChain(t), EIP2612Permit)
+
+	permit, err := ps.SignPermit(context.Background(), permitTokenAddress.Hex(), permitAmount)
+	if err != nil {
+		t.Fatalf("SignPermit: %v", err)
+	}
+	encoded := hexutil.MustDecode(permit)
+	if len(encoded) != 20+224 || common.BytesToAddress(encoded[:20]) != permitTokenAddress {
+		t.Errorf("permit = %s, want the token address followed by the permit arguments", permit)
+	}
+}
+
+func TestPermitFallsBackToApproval(t *testing.T) {
+	chain := newPermitChain(t)
+	ps := newTestPermitSigner(t, chain, EIP2612Permit)
+	am := newSimulatedApprovalManager(t, chain, ExactApproval, nil, nil)
+
+	tests := []struct {
+		name          string
+		tokenAddress  common.Address
+		wantAllowance int64
+		wantPermit    bool
+	}{
+		{name: "permit token", tokenAddress: permitTokenAddress, wantPermit: true},
+		{name: "token without permits", tokenAddress: testTokenAddress, wantAllowance: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsAllowance, err := RequiresAllowance(context.Background(), ps, tt.tokenAddress.Hex())
+			if err != nil {
+				t.Fatalf("RequiresAllowance: %v", err)
+			}
+			if needsAllowance == tt.wantPermit {
+				t.Errorf("RequiresAllowance = %t, want %t", needsAllowance, !tt.wantPermit)
+			}
+			if needsAllowance {
+				if _, err := am.EnsureAllowance(context.Background(), tt.tokenAddress.Hex(), big.NewInt(500)); err != nil {
+					t.Fatalf("EnsureAllowance: %v", err)
+				}
+			}
+			if got := chain.allowance(tt.tokenAddress); got.Cmp(big.NewInt(tt.wantAllowance)) != 0 {
+				t.Errorf("allowance = %s, want %d", got, tt.wantAllowance)
+			}
+
+			opts := &CreateOrderOptions{}
+			signed, err := SignOrderPermit(context.Background(), ps, opts, tt.tokenAddress.Hex(), big.NewInt(500))
+			if err != nil {
+				t.Fatalf("SignOrderPermit: %v", err)
+			}
+			if signed != tt.wantPermit || (opts.Permit != "") != tt.wantPermit || opts.IsPermit2 {
+				t.Errorf("SignOrderPermit = %t with options %+v, want permit %t", signed, opts, tt.wantPermit)
+			}
+		})
+	}
+
+	if _, err := ps.SignPermit(context.Background(), testTokenAddress.Hex(), big.NewInt(500)); !errors.Is(err, ErrPermitUnsupported) {
+		t.Errorf("SignPermit for a token without permits = %v, want %v", err, ErrPermitUnsupported)
+	}
+
+	// Permit2 authorizes any token approved to the Permit2 contract.
+	permit2 := newTestPermitSigner(t, chain, Permit2Permit)
+	if needsAllowance, err := RequiresAllowance(context.Background(), permit2, testTokenAddress.Hex()); err != nil || !needsAllowance {
+		t.Errorf("RequiresAllowance with Permit2 = %t, %v, want an allowance to the Permit2 contract", needsAllowance, err)
+	}
+	if supported, err := permit2.SupportsPermit(context.Background(), testTokenAddress.Hex()); err != nil || !supported {
+		t.Errorf("SupportsPermit with Permit2 = %t, %v, want true", supported, err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CostBasisMethod determines how the cost of the tokens sold is matched against the tokens bought.
+type CostBasisMethod int
+
+const (
+	// FIFOCostBasis matches sells against the oldest open buy lots first.
+	FIFOCostBasis CostBasisMethod = iota
+
+	// AverageCostBasis values sells at the average cost of the open position.
+	AverageCostBasis
+)
+
+var costBasisMethods = map[CostBasisMethod]string{
+	FIFOCostBasis:    "fifo",
+	AverageCostBasis: "average",
+}
+
+func (m CostBasisMethod) String() string {
+	return costBasisMethods[m]
+}
+
+// ParseCostBasisMethod parses a cost basis method from its string representation. An empty string selects FIFOCostBasis.
+func ParseCostBasisMethod(s string) (CostBasisMethod, error) {
+	if s == "" {
+		return FIFOCostBasis, nil
+	}
+	for method, name := range costBasisMethods {
+		if strings.EqualFold(name, s) {
+			return method, nil
+		}
+	}
+	return FIFOCostBasis, errors.New("unknown cost basis method: " + s)
+}
+
+// PnLReport summarizes the profit and loss of a pair, denominated in the stable token.
+type PnLReport struct {
+	// Pair is the traded pair (e.g., "WBTC/USDC").
+	Pair string `json:"pair"`
+
+	// Method is the cost basis method used.
+	Method string `json:"method"`
+
+	// Position is the target token quantity bought and not yet sold, according to the journal.
+	Position float64 `json:"position"`
+
+	// CostBasis is the amount of stable tokens paid for the open position.
+	CostBasis float64 `json:"costBasis"`
+
+	// RealizedPnL is the profit or loss locked in by sells.
+	RealizedPnL float64 `json:"realizedPnL"`
+
+	// UnrealizedPnL is the profit or loss of the open position at the current price.
+	UnrealizedPnL float64 `json:"unrealizedPnL"`
+
+	// CurrentPrice is the price the open position was valued at.
+	CurrentPrice float64 `json:"currentPrice"`
+
+	// LastBuyPrice is the effective price of the most recent filled buy, or zero if there is none.
+	LastBuyPrice float64 `json:"lastBuyPrice"`
+
+	// LastFilledOrderType is the side of the most recent filled trade, or empty if there is none.
+	LastFilledOrderType string `json:"lastFilledOrderType"`
+}
+
+// costBasisLot is a quantity of target tokens bought at a given price.
+type costBasisLot struct {
+	quantity float64
+	price    float64
+}
+
+// PnLEngine computes profit and loss from the fills recorded in the trade journal.
+type PnLEngine interface {
+	// Report computes the realized PnL of the pair and values its open position at the current price.
+	Report(pair string, currentPrice float64) (*PnLReport, error)
+
+	// RealizedPnLSince computes the PnL of the pair realized by sells filled since the given time.
+	RealizedPnLSince(pair string, since time.Time) (float64, error)
+}
+
+// pnlEngine implements the PnLEngine interface.
+type pnlEngine struct {
+	// journal is the trade journal the fills are read from.
+	journal TradeJournal
+
+	// targetToken is the token whose position is tracked.
+	targetToken *Token
+
+	// stableToken is the token PnL is denominated in.
+	stableToken *Token
+
+	// method is the cost basis method used.
+	method CostBasisMethod
+}
+
+// Report computes the realized PnL of the pair and values its open position at the current price.
+// Sells exceeding the journaled position (e.g. tokens held before the journal existed) carry no cost basis and are ignored.
+func (e *pnlEngine) Report(pair string, currentPrice float64) (*PnLReport, error) {
+	report, _, err := e.replay(pair, currentPrice, time.Now())
+	return report, err
+}
+
+// RealizedPnLSince computes the PnL of the pair realized by sells filled since the given time.
+// The cost basis of those sells is still derived from the full history.
+func (e *pnlEngine) RealizedPnLSince(pair string, since time.Time) (float64, error) {
+	_, realizedSince, err := e.replay(pair, 0, since)
+	return realizedSince, err
+}
+
+// replay replays the fills of the pair from the journal in the order they were filled, returning the report at the
+// current price and the PnL realized by sells filled at or after since.
+func (e *pnlEngine) replay(pair string, currentPrice float64, since time.Time) (*PnLReport, float64, error) {
+	trades, err := e.journal.QueryTrades(pair, time.Unix(0, 0), time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].FillTime().Before(trades[j].FillTime())
+	})
+
+	report := &PnLReport{
+		Pair:         pair,
+		Method:       e.method.String(),
+		CurrentPrice: currentPrice,
+	}
+
+	var lots []costBasisLot
+	var realizedSince float64
+
+	for _, trade := range trades {
+		if trade.Status != TradeFilled && trade.Status != TradePartiallyFilled {
+			continue
+		}
+
+		filledFrom, err := strconv.ParseFloat(trade.FilledFromTokenAmount, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		filledTo, err := strconv.ParseFloat(trade.FilledToTokenAmount, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch trade.OrderType {
+		case BuyOrder.String():
+			quantity := filledTo / math.Pow(10, float64(e.targetToken.Decimals))
+			cost := filledFrom / math.Pow(10, float64(e.stableToken.Decimals))
+			if quantity <= 0 {
+				continue
+			}
+
+			lots = append(lots, costBasisLot{quantity: quantity, price: cost / quantity})
+			if e.method == AverageCostBasis {
+				lots = averageLots(lots)
+			}
+			report.LastBuyPrice = cost / quantity
+		case SellOrder.String():
+			quantity := filledFrom / math.Pow(10, float64(e.targetToken.Decimals))
+			proceeds := filledTo / math.Pow(10, float64(e.stableToken.Decimals))
+			if quantity <= 0 {
+				continue
+			}
+
+			price := proceeds / quantity
+			remaining := quantity
+			for remaining > 0 && len(lots) > 0 {
+				matched := math.Min(remaining, lots[0].quantity)
+				realized := matched * (price - lots[0].price)
+				report.RealizedPnL += realized
+				if !trade.FillTime().Before(since) {
+					realizedSince += realized
+				}
+				lots[0].quantity -= matched
+				remaining -= matched
+				if lots[0].quantity <= 0 {
+					lots = lots[1:]
+				}
+			}
+		default:
+			continue
+		}
+
+		report.LastFilledOrderType = trade.OrderType
+	}
+
+	for _, lot := range lots {
+		report.Position += lot.quantity
+		report.CostBasis += lot.quantity * lot.price
+	}
+
+	if currentPrice > 0 {
+		report.UnrealizedPnL = report.Position*currentPrice - report.CostBasis
+	}
+
+	return report, realizedSince, nil
+}
+
+// averageLots merges the lots into a single lot at their weighted average price.
+func averageLots(lots []costBasisLot) []costBasisLot {
+	var quantity, cost float64
+	for _, lot := range lots {
+		quantity += lot.quantity
+		cost += lot.quantity * lot.price
+	}
+	if quantity <= 0 {
+		return nil
+	}
+	return []costBasisLot{{quantity: quantity, price: cost / quantity}}
+}
+
+// NewPnLEngine creates a new PnLEngine for the pair tokens that reads fills from the journal.
+func NewPnLEngine(journal TradeJournal, targetToken *Token, stableToken *Token, method CostBasisMethod) PnLEngine {
+	return &pnlEngine{
+		journal:     journal,
+		targetToken: targetToken,
+		stableToken: stableToken,
+		method:      method,
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// baseUnits converts an amount in whole tokens to base units.
+func baseUnits(t *testing.T, amount float64, token *Token) string {
+	t.Helper()
+
+	units, err := ParseTokenAmount(strconv.FormatFloat(amount, 'f', -1, 64), token.Decimals)
+	if err != nil {
+		t.Fatalf("ParseTokenAmount: %v", err)
+	}
+	return units.String()
+}
+
+// recordFill journals a WBTC/USDC trade that filled the amounts, in whole tokens, at the given time.
+func recordFill(t *testing.T, j TradeJournal, id string, orderType OrderType, status TradeStatus, wbtc float64, usdc float64, filledAt time.Time) {
+	t.Helper()
+
+	record := &TradeRecord{
+		ID:        id,
+		Pair:      "WBTC/USDC",
+		OrderType: orderType.String(),
+		Status:    status,
+		CreatedAt: filledAt.Add(-time.Minute),
+		FilledAt:  filledAt,
+	}
+	wbtcAmount, usdcAmount := baseUnits(t, wbtc, testWBTC), baseUnits(t, usdc, testUSDC)
+	if orderType == BuyOrder {
+		record.FilledFromTokenAmount, record.FilledToTokenAmount = usdcAmount, wbtcAmount
+	} else {
+		record.FilledFromTokenAmount, record.FilledToTokenAmount = wbtcAmount, usdcAmount
+	}
+	if err := j.RecordTrade(record); err != nil {
+		t.Fatalf("RecordTrade: %v", err)
+	}
+}
+
+// recordPnLHistory journals two buys, a partially filled buy, a sell filled in full and a partially filled sell,
+// plus trades without fills that must be ignored.
+func recordPnLHistory(t *testing.T, j TradeJournal, start time.Time) {
+	t.Helper()
+
+	recordFill(t, j, "buy-1", BuyOrder, TradeFilled, 1, 100, start)
+	recordFill(t, j, "buy-2", BuyOrder, TradeFilled, 1, 200, start.Add(time.Hour))
+	recordFill(t, j, "buy-3", BuyOrder, TradePartiallyFilled, 0.5, 150, start.Add(2*time.Hour))
+	recordFill(t, j, "sell-1", SellOrder, TradeFilled, 1.5, 600, start.Add(3*time.Hour))
+	recordFill(t, j, "sell-2", SellOrder, TradePartiallyFilled, 0.5, 250, start.Add(4*time.Hour))
+
+	for _, record := range []*TradeRecord{
+		{ID: "expired", Pair: "WBTC/USDC", OrderType: BuyOrder.String(), Status: TradeExpired, FilledFromTokenAmount: "0", FilledToTokenAmount: "0"},
+		{ID: "open", Pair: "WBTC/USDC", OrderType: SellOrder.String(), Status: TradeSubmitted},
+	} {
+		if err := j.RecordTrade(record); err != nil {
+			t.Fatalf("RecordTrade: %v", err)
+		}
+	}
+}
+
+func TestPnLEngineReport(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour)
+
+	// Lots: 1 WBTC at 100, 1 at 200 and 0.5 at 300 USDC. The 1.5 WBTC sold at 400 USDC and the 0.5 WBTC sold at 500 USDC
+	// leave 0.5 WBTC open.
+	tests := []struct {
+		method    CostBasisMethod
+		realized  float64
+		costBasis float64
+	}{
+		// FIFO sells 1 at 100 and 0.5 at 200 for 400, then 0.5 at 200 for 150, leaving 0.5 at 300.
+		{method: FIFOCostBasis, realized: 400 + 150, costBasis: 150},
+		// The average cost is 450 / 2.5 = 180: 1.5 sold for 330 and 0.5 for 160, leaving 0.5 at 180.
+		{method: AverageCostBasis, realized: 330 + 160, costBasis: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method.String(), func(t *testing.T) {
+			j := NewMemoryStateStore()
+			recordPnLHistory(t, j, start)
+			e := NewPnLEngine(j, testWBTC, testUSDC, tt.method)
+
+			report, err := e.Report("WBTC/USDC", 400)
+			if err != nil {
+				t.Fatalf("Report: %v", err)
+			}
+			if !approxEqual(report.Position, 0.5) {
+				t.Errorf("position = %f, want 0.5", report.Position)
+			}
+			if !approxEqual(report.CostBasis, tt.costBasis) {
+				t.Errorf("cost basis = %f, want %f", report.CostBasis, tt.costBasis)
+			}
+			if !approxEqual(report.RealizedPnL, tt.realized) {
+				t.Errorf("realized PnL = %f, want %f", report.RealizedPnL, tt.realized)
+			}
+			if want := 0.5*400 - tt.costBasis; !approxEqual(report.UnrealizedPnL, want) {
+				t.Errorf("unrealized PnL = %f, want %f", report.UnrealizedPnL, want)
+			}
+			if !approxEqual(report.LastBuyPrice, 300) || report.LastFilledOrderType != SellOrder.String() {
+				t.Errorf("last buy price = %f, last filled %s, want 300 and SELL", report.LastBuyPrice, report.LastFilledOrderType)
+			}
+		})
+	}
+}
+
+func TestPnLEngineReplaysInFillOrder(t *testing.T) {
+	j := NewMemoryStateStore()
+	start := time.Now().Add(-24 * time.Hour)
+
+	// The sell was created before the second buy but filled after it, so it is matched against both lots.
+	recordFill(t, j, "buy-1", BuyOrder, TradeFilled, 1, 100, start)
+	recordFill(t, j, "sell-1", SellOrder, TradeFilled, 2, 600, start.Add(2*time.Hour))
+	recordFill(t, j, "buy-2", BuyOrder, TradeFilled, 1, 200, start.Add(time.Hour))
+	sell, err := j.GetTrade("sell-1")
+	if err != nil {
+		t.Fatalf("GetTrade: %v", err)
+	}
+	sell.CreatedAt = start.Add(30 * time.Minute)
+	if err := j.RecordTrade(sell); err != nil {
+		t.Fatalf("RecordTrade: %v", err)
+	}
+
+	report, err := NewPnLEngine(j, testWBTC, testUSDC, FIFOCostBasis).Report("WBTC/USDC", 0)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if !approxEqual(report.RealizedPnL, 300) || !approxEqual(report.Position, 0) {
+		t.Errorf("realized PnL = %f, position = %f, want 300 and 0", report.RealizedPnL, report.Position)
+	}
+}
+
+func TestPnLEngineRealizedPnLSince(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		method CostBasisMethod
+		want   float64
+	}{
+		// Only the partially filled sell is filled since, whatever the update time of the earlier sell.
+		{method: FIFOCostBasis, want: 150},
+		{method: AverageCostBasis, want: 160},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method.String(), func(t *testing.T) {
+			j := NewMemoryStateStore()
+			recordPnLHistory(t, j, start)
+
+			// Re-recording the earlier sell updates it now, which must not move its fill into the window.
+			sell, err := j.GetTrade("sell-1")
+			if err != nil {
+				t.Fatalf("GetTrade: %v", err)
+			}
+			if err := j.RecordTrade(sell); err != nil {
+				t.Fatalf("RecordTrade: %v", err)
+			}
+
+			realized, err := NewPnLEngine(j, testWBTC, testUSDC, tt.method).RealizedPnLSince("WBTC/USDC", start.Add(3*time.Hour+time.Minute))
+			if err != nil {
+				t.Fatalf("RealizedPnLSince: %v", err)
+			}
+			if !approxEqual(realized, tt.want) {
+				t.Errorf("realized PnL since = %f, want %f", realized, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrderStatusRecordsFillTime(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		fills      []OrderFill
+		wantStatus TradeStatus
+		wantFilled bool
+	}{
+		{name: "filled", status: "filled", fills: []OrderFill{{FilledMakerAmount: "100", FilledAuctionTakerAmount: "5"}}, wantStatus: TradeFilled, wantFilled: true},
+		{name: "partially filled", status: "expired", fills: []OrderFill{{FilledMakerAmount: "40", FilledAuctionTakerAmount: "2"}}, wantStatus: TradePartiallyFilled, wantFilled: true},
+		{name: "expired", status: "expired", wantStatus: TradeExpired},
+		{name: "pending", status: "pending", wantStatus: TradeSubmitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &TradeRecord{Status: TradeSubmitted, UpdatedAt: time.Now().Add(-time.Hour)}
+			record.ApplyOrderStatus(&OrderStatusResponse{Status: tt.status, Fills: tt.fills})
+
+			if record.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", record.Status, tt.wantStatus)
+			}
+			if record.FilledAt.IsZero() == tt.wantFilled {
+				t.Errorf("filled at = %s, want set %t", record.FilledAt, tt.wantFilled)
+			}
+
+			// The fill time is kept when the status is applied again.
+			filledAt := record.FilledAt
+			record.ApplyOrderStatus(&OrderStatusResponse{Status: tt.status, Fills: tt.fills})
+			if !record.FilledAt.Equal(filledAt) {
+				t.Errorf("filled at moved from %s to %s", filledAt, record.FilledAt)
+			}
+		})
+	}
+}
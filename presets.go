@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// CustomPresetName is the name of the auction preset built from a CustomPreset.
+const CustomPresetName = "custom"
+
+// presetNames are the auction presets a PresetPolicy may select. An empty name selects the recommended preset of the quote.
+var presetNames = []string{"", "fast", "medium", "slow", CustomPresetName}
+
+// Bounds on custom auction durations, keeping them between a few blocks and a day.
+const (
+	minCustomAuctionDuration = 30 * time.Second
+	maxCustomAuctionDuration = 24 * time.Hour
+)
+
+// Bounds on custom auction amounts, in percent of the quoted amount. The end amount is the minimum return, which may not
+// exceed the quote, and the start amount may be at most twice the quote.
+const (
+	maxCustomEndPercent   = 100
+	maxCustomStartPercent = 200
+)
+
+// rateBumpBase is the 1inch rate bump unit: a rate bump of rateBumpBase doubles the auction end amount.
+const rateBumpBase = 10_000_000
+
+// maxInitialRateBump is the largest initial rate bump, which 1inch encodes in 24 bits.
+const maxInitialRateBump = 1<<24 - 1
+
+// TradeUrgency classifies how urgently a triggered trade needs to fill.
+type TradeUrgency int
+
+const (
+	// NormalUrgency is used for trades without a particular urgency, e.g. forced by an admin.
+	NormalUrgency TradeUrgency = iota
+
+	// StopLossUrgency is used when the price moved against the strategy and the trade must fill quickly.
+	StopLossUrgency
+
+	// TakeProfitUrgency is used when the price moved in favour of the strategy and the trade can wait for a better price.
+	TakeProfitUrgency
+
+	// FlattenUrgency is used when an admin requested to flatten the position.
+	FlattenUrgency
+)
+
+var tradeUrgencies = map[TradeUrgency]string{
+	NormalUrgency:     "normal",
+	StopLossUrgency:   "stop-loss",
+	TakeProfitUrgency: "take-profit",
+	FlattenUrgency:    "flatten",
+}
+
+func (u TradeUrgency) String() string {
+	return tradeUrgencies[u]
+}
+
+// ClassifyTrade returns the urgency of a trade triggered at the current price. Selling below the lower trigger or buying
+// above the upper trigger is a stop-loss, while selling above the upper trigger or buying below the lower trigger is a
+// take-profit.
+func ClassifyTrade(pm *PriceMonitor, currentPrice float64) TradeUrgency {
+	switch {
+	case pm.currentOrderType == SellOrder && currentPrice <= pm.triggerPriceDown:
+		return StopLossUrgency
+	case pm.currentOrderType == SellOrder && currentPrice >= pm.triggerPriceUp:
+		return TakeProfitUrgency
+	case pm.currentOrderType == BuyOrder && currentPrice >= pm.triggerPriceUp:
+		return StopLossUrgency
+	case pm.currentOrderType == BuyOrder && currentPrice <= pm.triggerPriceDown:
+		return TakeProfitUrgency
+	default:
+		return NormalUrgency
+	}
+}
+
+// CustomPreset defines a Dutch auction relative to the quoted amount.
+type CustomPreset struct {
+	// AuctionDuration is the duration of the auction.
+	AuctionDuration time.Duration
+
+	// StartPercent is the auction start amount, in percent of the quoted amount.
+	StartPercent float64
+
+	// EndPercent is the auction end amount (i.e. the minimum return), in percent of the quoted amount.
+	EndPercent float64
+}
+
+// Validate checks that the custom preset describes an auction 1inch resolvers can fill.
+func (c *CustomPreset) Validate() error {
+	if c.AuctionDuration < minCustomAuctionDuration || c.AuctionDuration > maxCustomAuctionDuration {
+		return fmt.Errorf("custom auction duration %s is outside [%s, %s]", c.AuctionDuration, minCustomAuctionDuration, maxCustomAuctionDuration)
+	}
+	if c.EndPercent <= 0 || c.EndPercent > maxCustomEndPercent {
+		return fmt.Errorf("custom auction end percent %f is outside (0, %d]", c.EndPercent, maxCustomEndPercent)
+	}
+	if c.StartPercent <= c.EndPercent || c.StartPercent > maxCustomStartPercent {
+		return fmt.Errorf("custom auction start percent %f is outside (%f, %d]", c.StartPercent, c.EndPercent, maxCustomStartPercent)
+	}
+	if rateBump := (c.StartPercent - c.EndPercent) / c.EndPercent * rateBumpBase; rateBump > maxInitialRateBump {
+		return fmt.Errorf("custom auction start percent %f is too far above end percent %f", c.StartPercent, c.EndPercent)
+	}
+	return nil
+}
+
+// build derives the auction preset from the quote, based on its recommended preset for the gas cost and fill options.
+func (c *CustomPreset) build(quote *QuoteResponse) (*QuotePreset, error) {
+	toTokenAmount, ok := new(big.Int).SetString(quote.ToTokenAmount, 10)
+	if !ok || toTokenAmount.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid quoted amount: %s", quote.ToTokenAmount)
+	}
+
+	// Percentages are applied with a precision of a hundredth of a basis point, to keep the amounts exact.
+	percentOf := func(percent float64) *big.Int {
+		amount := new(big.Int).Mul(toTokenAmount, big.NewInt(int64(math.Round(percent*10_000))))
+		return amount.Quo(amount, big.NewInt(1_000_000))
+	}
+	startAmount := percentOf(c.StartPercent)
+	endAmount := percentOf(c.EndPercent)
+	if endAmount.Sign() <= 0 || startAmount.Cmp(endAmount) <= 0 {
+		return nil, fmt.Errorf("invalid custom auction amounts: %s => %s", startAmount, endAmount)
+	}
+
+	var preset QuotePreset
+	if recommended, err := quote.Preset(quote.RecommendedPreset); err == nil {
+		preset = *recommended
+	}
+	rateBump := new(big.Int).Mul(new(big.Int).Sub(startAmount, endAmount), big.NewInt(rateBumpBase))
+	rateBump.Quo(rateBump, endAmount)
+
+	preset.AuctionDuration = int(c.AuctionDuration.Seconds())
+	preset.StartAuctionIn = 0
+	preset.InitialRateBump = int(rateBump.Int64())
+	preset.AuctionStartAmount = startAmount.String()
+	preset.StartAmount = quote.FromTokenAmount
+	preset.AuctionEndAmount = endAmount.String()
+	// The auction decreases linearly from the start amount to the end amount.
+	preset.Points = []QuoteAuctionPoint{}
+	return &preset, nil
+}
+
+// PresetPolicy selects the auction preset of orders based on the urgency of the trade.
+type PresetPolicy struct {
+	// presets maps urgencies to preset names. An empty name selects the recommended preset of the quote.
+	presets map[TradeUrgency]string
+
+	// custom defines the custom preset, if any urgency selects it.
+	custom *CustomPreset
+}
+
+// Select returns the name of the preset of an order of the given urgency. If the policy selects the custom preset, it is
+// added to the presets of the quote. Presets the quote does not offer fall back to the recommended preset.
+func (p *PresetPolicy) Select(urgency TradeUrgency, quote *QuoteResponse) (string, error) {
+	name := p.presets[urgency]
+	switch name {
+	case "":
+		return quote.RecommendedPreset, nil
+	case CustomPresetName:
+		preset, err := p.custom.build(quote)
+		if err != nil {
+			return "", err
+		}
+		if quote.Presets == nil {
+			quote.Presets = make(map[string]QuotePreset)
+		}
+		quote.Presets[CustomPresetName] = *preset
+		return CustomPresetName, nil
+	default:
+		if _, err := quote.Preset(name); err != nil {
+			log.Warnf("Falling back to the %s preset: %v", quote.RecommendedPreset, err)
+			return quote.RecommendedPreset, nil
+		}
+		return name, nil
+	}
+}
+
+// NewPresetPolicy creates a new PresetPolicy. The custom preset is only required if an urgency selects it.
+func NewPresetPolicy(presets map[TradeUrgency]string, custom *CustomPreset) (*PresetPolicy, error) {
+	for urgency, name := range presets {
+		if !slices.Contains(presetNames, name) {
+			return nil, fmt.Errorf("unknown preset for %s trades: %s", urgency, name)
+		}
+		if name == CustomPresetName {
+			if custom == nil {
+				return nil, errors.New("custom preset selected for " + urgency.String() + " trades but not configured")
+			}
+			if err := custom.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &PresetPolicy{
+		presets: presets,
+		custom:  custom,
+	}, nil
+}
+
+// ParseCustomPreset parses a custom preset from its auction duration and start and end percentages. It returns nil if the
+// duration is empty. The percentages default to 100.5 and 99.5 percent of the quoted amount.
+func ParseCustomPreset(auctionDuration string, startPercent string, endPercent string) (*CustomPreset, error) {
+	if auctionDuration == "" {
+		return nil, nil
+	}
+
+	custom := &CustomPreset{StartPercent: 100.5, EndPercent: 99.5}
+
+	var err error
+	if custom.AuctionDuration, err = time.ParseDuration(auctionDuration); err != nil {
+		return nil, err
+	}
+	if startPercent != "" {
+		if custom.StartPercent, err = strconv.ParseFloat(startPercent, 64); err != nil {
+			return nil, err
+		}
+	}
+	if endPercent != "" {
+		if custom.EndPercent, err = strconv.ParseFloat(endPercent, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := custom.Validate(); err != nil {
+		return nil, err
+	}
+	return custom, nil
+}
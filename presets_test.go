@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCustomPresetValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		custom  CustomPreset
+		wantErr bool
+	}{
+		{"valid", CustomPreset{AuctionDuration: 3 * time.Minute, StartPercent: 100.5, EndPercent: 99.5}, false},
+		{"shortest duration", CustomPreset{AuctionDuration: minCustomAuctionDuration, StartPercent: 101, EndPercent: 99}, false},
+		{"longest duration", CustomPreset{AuctionDuration: maxCustomAuctionDuration, StartPercent: 101, EndPercent: 99}, false},
+		{"duration too short", CustomPreset{AuctionDuration: minCustomAuctionDuration - time.Second, StartPercent: 101, EndPercent: 99}, true},
+		{"duration too long", CustomPreset{AuctionDuration: maxCustomAuctionDuration + time.Second, StartPercent: 101, EndPercent: 99}, true},
+		{"end at quote", CustomPreset{AuctionDuration: time.Minute, StartPercent: 105, EndPercent: maxCustomEndPercent}, false},
+		{"end above quote", CustomPreset{AuctionDuration: time.Minute, StartPercent: 105, EndPercent: 100.1}, true},
+		{"zero end", CustomPreset{AuctionDuration: time.Minute, StartPercent: 101, EndPercent: 0}, true},
+		{"negative end", CustomPreset{AuctionDuration: time.Minute, StartPercent: 101, EndPercent: -1}, true},
+		{"start equal to end", CustomPreset{AuctionDuration: time.Minute, StartPercent: 99, EndPercent: 99}, true},
+		{"start below end", CustomPreset{AuctionDuration: time.Minute, StartPercent: 98, EndPercent: 99}, true},
+		{"start at maximum", CustomPreset{AuctionDuration: time.Minute, StartPercent: maxCustomStartPercent, EndPercent: 99}, false},
+		{"start above maximum", CustomPreset{AuctionDuration: time.Minute, StartPercent: maxCustomStartPercent + 1, EndPercent: 99}, true},
+		{"rate bump overflow", CustomPreset{AuctionDuration: time.Minute, StartPercent: 150, EndPercent: 40}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.custom.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClassifyTrade(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType OrderType
+		price     float64
+		want      TradeUrgency
+	}{
+		{"buy within bands", BuyOrder, 100, NormalUrgency},
+		{"buy above upper trigger", BuyOrder, 110, StopLossUrgency},
+		{"buy below lower trigger", BuyOrder, 90, TakeProfitUrgency},
+		{"sell within bands", SellOrder, 100, NormalUrgency},
+		{"sell below lower trigger", SellOrder, 90, StopLossUrgency},
+		{"sell above upper trigger", SellOrder, 110, TakeProfitUrgency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPriceMonitor(tt.orderType, 100, 100, 0.5, 1.0)
+
+			if got := ClassifyTrade(pm, tt.price); got != tt.want {
+				t.Errorf("ClassifyTrade(%f) = %s (up %f, down %f), want %s", tt.price, got, pm.triggerPriceUp, pm.triggerPriceDown, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetPolicySelect(t *testing.T) {
+	custom := &CustomPreset{AuctionDuration: time.Minute, StartPercent: 101, EndPercent: 99}
+	policy, err := NewPresetPolicy(map[TradeUrgency]string{
+		StopLossUrgency:   "fast",
+		TakeProfitUrgency: "slow",
+		FlattenUrgency:    CustomPresetName,
+	}, custom)
+	if err != nil {
+		t.Fatalf("NewPresetPolicy: %v", err)
+	}
+
+	// quote offers the fast and medium presets, recommending medium.
+	quote := func(toTokenAmount string) *QuoteResponse {
+		return &QuoteResponse{
+			FromTokenAmount:   "500",
+			ToTokenAmount:     toTokenAmount,
+			RecommendedPreset: "medium",
+			Presets: map[string]QuotePreset{
+				"fast":   {AuctionDuration: 180, AllowPartialFills: true},
+				"medium": {AuctionDuration: 360, AllowPartialFills: true},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		urgency       TradeUrgency
+		toTokenAmount string
+		want          string
+		wantErr       bool
+	}{
+		{"unconfigured urgency selects recommended", NormalUrgency, "1000000", "medium", false},
+		{"offered preset", StopLossUrgency, "1000000", "fast", false},
+		{"preset not offered falls back to recommended", TakeProfitUrgency, "1000000", "medium", false},
+		{"custom preset", FlattenUrgency, "1000000", CustomPresetName, false},
+		{"custom preset with invalid quoted amount", FlattenUrgency, "0", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := quote(tt.toTokenAmount)
+
+			got, err := policy.Select(tt.urgency, q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Select() = %q, want %q", got, tt.want)
+			}
+			if _, err := q.Preset(got); err != nil && !tt.wantErr {
+				t.Errorf("selected preset %q is not offered: %v", got, err)
+			}
+		})
+	}
+
+	t.Run("custom preset amounts", func(t *testing.T) {
+		q := quote("1000000")
+		if _, err := policy.Select(FlattenUrgency, q); err != nil {
+			t.Fatalf("Select: %v", err)
+		}
+
+		preset := q.Presets[CustomPresetName]
+		if preset.AuctionStartAmount != "1010000" || preset.AuctionEndAmount != "990000" || preset.StartAmount != "500" {
+			t.Errorf("auction %s => %s selling %s, want 1010000 => 990000 selling 500", preset.AuctionStartAmount, preset.AuctionEndAmount, preset.StartAmount)
+		}
+		if preset.AuctionDuration != 60 || preset.StartAuctionIn != 0 {
+			t.Errorf("auction of %ds starting in %ds, want 60s starting now", preset.AuctionDuration, preset.StartAuctionIn)
+		}
+		// (1010000 - 990000) / 990000 * rateBumpBase
+		if preset.InitialRateBump != 202020 {
+			t.Errorf("initial rate bump = %d, want 202020", preset.InitialRateBump)
+		}
+		if !preset.AllowPartialFills {
+			t.Error("fill options of the recommended preset were not kept")
+		}
+	})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chainlinkAggregatorABIJSON is the subset of the Chainlink AggregatorV3Interface ABI used to read prices.
+const chainlinkAggregatorABIJSON = `[
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+	{"type":"function","name":"latestRoundData","stateMutability":"view","inputs":[],"outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}]}
+]`
+
+// chainlinkAggregatorABI is the parsed Chainlink aggregator ABI.
+var chainlinkAggregatorABI = mustParseABI(chainlinkAggregatorABIJSON)
+
+// PriceReference provides an independent price of the target token in the stable token, to sanity check quotes against.
+type PriceReference interface {
+	// ReferencePrice returns the reference price for an order of the given type. The current price is used to size
+	// reference quotes.
+	ReferencePrice(orderType OrderType, currentPrice float64) (float64, error)
+
+	// Name returns a short human readable name of the reference, used in logs.
+	Name() string
+}
+
+// chainlinkPriceReference implements the PriceReference interface with a Chainlink aggregator read through JSON-RPC.
+// The aggregator must price the target token in a currency the stable token is pegged to (e.g., BTC / USD for WBTC/USDC).
+type chainlinkPriceReference struct {
+	// client is the Ethereum JSON-RPC client used to read the aggregator.
+	client EthereumClient
+
+	// aggregatorAddress is the address of the Chainlink aggregator.
+	aggregatorAddress string
+
+	// maxAge is the maximum age of the latest round before the price is considered stale.
+	maxAge time.Duration
+}
+
+// ReferencePrice returns the latest answer of the aggregator, failing if it is stale.
+func (p *chainlinkPriceReference) ReferencePrice(orderType OrderType, currentPrice float64) (float64, error) {
+	out, err := callContract(context.TODO(), p.client, chainlinkAggregatorABI, p.aggregatorAddress, "decimals")
+	if err != nil {
+		return 0, err
+	}
+	decimals := out[0].(uint8)
+
+	out, err = callContract(context.TODO(), p.client, chainlinkAggregatorABI, p.aggregatorAddress, "latestRoundData")
+	if err != nil {
+		return 0, err
+	}
+	answer := out[1].(*big.Int)
+	updatedAt := time.Unix(out[3].(*big.Int).Int64(), 0)
+
+	if answer.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid answer from aggregator %s: %s", p.aggregatorAddress, answer)
+	}
+	if age := time.Since(updatedAt); age > p.maxAge {
+		return 0, fmt.Errorf("stale answer from aggregator %s, updated %s ago", p.aggregatorAddress, age.Round(time.Second))
+	}
+
+	price, _ := new(big.Float).Quo(new(big.Float).SetInt(answer), new(big.Float).SetFloat64(math.Pow(10, float64(decimals)))).Float64()
+	return price, nil
+}
+
+// Name returns a short human readable name of the reference, used in logs.
+func (p *chainlinkPriceReference) Name() string {
+	return "chainlink"
+}
+
+// NewChainlinkPriceReference creates a new PriceReference reading the Chainlink aggregator, rejecting answers older than maxAge.
+func NewChainlinkPriceReference(client EthereumClient, aggregatorAddress string, maxAge time.Duration) PriceReference {
+	return &chainlinkPriceReference{
+		client:            client,
+		aggregatorAddress: aggregatorAddress,
+		maxAge:            maxAge,
+	}
+}
+
+// quotePriceReference implements the PriceReference interface with a 1inch quote for a small notional, which is barely
+// affected by liquidity depth.
+type quotePriceReference struct {
+	// router is the 1inch router used to quote.
+	router OneInchRouter
+
+	// walletAddress is the address the quotes are made for.
+	walletAddress string
+
+	// targetToken is the token being priced.
+	targetToken *Token
+
+	// stableToken is the token the price is denominated in.
+	stableToken *Token
+
+	// notional is the size of the reference quote, in whole stable tokens.
+	notional float64
+}
+
+// ReferencePrice quotes the notional in the direction of the order, and returns the resulting price.
+func (p *quotePriceReference) ReferencePrice(orderType OrderType, currentPrice float64) (float64, error) {
+	var fromToken, toToken *Token
+	var fromAmount float64
+	if orderType == SellOrder {
+		if currentPrice <= 0 {
+			return 0, fmt.Errorf("invalid current price: %f", currentPrice)
+		}
+		fromToken, toToken = p.targetToken, p.stableToken
+		fromAmount = p.notional / currentPrice
+	} else {
+		fromToken, toToken = p.stableToken, p.targetToken
+		fromAmount = p.notional
+	}
+
+	fromTokenAmount, _ := new(big.Float).Mul(big.NewFloat(fromAmount), big.NewFloat(math.Pow(10, float64(fromToken.Decimals)))).Int(nil)
+	quote, err := p.router.GetQuote(p.walletAddress, fromToken.Address, toToken.Address, fromTokenAmount.String())
+	if err != nil {
+		return 0, err
+	}
+
+	toTokenAmount, err := strconv.ParseFloat(quote.ToTokenAmount, 64)
+	if err != nil {
+		return 0, err
+	}
+	toAmount := toTokenAmount / math.Pow(10, float64(toToken.Decimals))
+	if toAmount <= 0 {
+		return 0, fmt.Errorf("empty reference quote for %f %s", fromAmount, fromToken.Symbol)
+	}
+
+	if orderType == SellOrder {
+		return toAmount / fromAmount, nil
+	}
+	return fromAmount / toAmount, nil
+}
+
+// Name returns a short human readable name of the reference, used in logs.
+func (p *quotePriceReference) Name() string {
+	return "quote"
+}
+
+// NewQuotePriceReference creates a new PriceReference quoting the notional (in whole stable tokens) through the router.
+func NewQuotePriceReference(r OneInchRouter, walletAddress string, targetToken *Token, stableToken *Token, notional float64) PriceReference {
+	return &quotePriceReference{
+		router:        r,
+		walletAddress: walletAddress,
+		targetToken:   targetToken,
+		stableToken:   stableToken,
+		notional:      notional,
+	}
+}
+
+// spotPriceReference implements the PriceReference interface with the 1inch Spot Price API, dividing the prices of both
+// tokens in a common currency.
+type spotPriceReference struct {
+	// router is the 1inch router used to read spot prices.
+	router OneInchRouter
+
+	// targetToken is the token being priced.
+	targetToken *Token
+
+	// stableToken is the token the price is denominated in.
+	stableToken *Token
+}
+
+// ReferencePrice returns the ratio of the USD spot prices of the target and stable tokens.
+func (p *spotPriceReference) ReferencePrice(orderType OrderType, currentPrice float64) (float64, error) {
+	prices, err := p.router.GetSpotPrices([]string{p.targetToken.Address, p.stableToken.Address}, "USD")
+	if err != nil {
+		return 0, err
+	}
+
+	targetPrice, err := SpotPrice(prices, p.targetToken)
+	if err != nil {
+		return 0, err
+	}
+	stablePrice, err := SpotPrice(prices, p.stableToken)
+	if err != nil {
+		return 0, err
+	}
+	return targetPrice / stablePrice, nil
+}
+
+// SpotPrice returns the price of the token from the spot prices, which are keyed by address in any case.
+func SpotPrice(prices SpotPricesResponse, token *Token) (float64, error) {
+	for address, value := range prices {
+		if strings.EqualFold(address, token.Address) {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, err
+			}
+			if price <= 0 {
+				return 0, fmt.Errorf("invalid spot price of %s: %s", token.Symbol, value)
+			}
+			return price, nil
+		}
+	}
+	return 0, fmt.Errorf("no spot price for %s", token.Symbol)
+}
+
+// Name returns a short human readable name of the reference, used in logs.
+func (p *spotPriceReference) Name() string {
+	return "spot"
+}
+
+// NewSpotPriceReference creates a new PriceReference reading the spot prices of the tokens through the router.
+func NewSpotPriceReference(r OneInchRouter, targetToken *Token, stableToken *Token) PriceReference {
+	return &spotPriceReference{
+		router:      r,
+		targetToken: targetToken,
+		stableToken: stableToken,
+	}
+}
+
+// PriceDeviationError is returned when the quoted price deviates too much from the reference price.
+type PriceDeviationError struct {
+	// Price is the quoted price.
+	Price float64
+
+	// ReferencePrice is the reference price.
+	ReferencePrice float64
+
+	// DeviationPercent is the absolute deviation of the quoted price from the reference price, in percent.
+	DeviationPercent float64
+
+	// MaxDeviationPercent is the configured maximum deviation, in percent.
+	MaxDeviationPercent float64
+}
+
+func (e *PriceDeviationError) Error() string {
+	return fmt.Sprintf("price %f deviates %.2f%% from reference price %f (max %.2f%%)", e.Price, e.DeviationPercent, e.ReferencePrice, e.MaxDeviationPercent)
+}
+
+// PriceGuard blocks trading on prices that deviate too much from a reference price.
+type PriceGuard struct {
+	// reference provides the reference price.
+	reference PriceReference
+
+	// maxDeviationPercent is the maximum deviation from the reference price, in percent.
+	maxDeviationPercent float64
+}
+
+// Check returns a *PriceDeviationError if the price of an order of the given type deviates from the reference price by more
+// than the maximum deviation. Errors reading the reference are returned as is, so that callers fail closed.
+func (g *PriceGuard) Check(orderType OrderType, price float64) error {
+	referencePrice, err := g.reference.ReferencePrice(orderType, price)
+	if err != nil {
+		return err
+	}
+
+	deviation := math.Abs(price-referencePrice) / referencePrice * 100
+	if deviation > g.maxDeviationPercent {
+		return &PriceDeviationError{
+			Price:               price,
+			ReferencePrice:      referencePrice,
+			DeviationPercent:    deviation,
+			MaxDeviationPercent: g.maxDeviationPercent,
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the reference of the guard.
+func (g *PriceGuard) Name() string {
+	return g.reference.Name()
+}
+
+// NewPriceGuard creates a new PriceGuard checking prices against the reference.
+func NewPriceGuard(reference PriceReference, maxDeviationPercent float64) *PriceGuard {
+	return &PriceGuard{
+		reference:           reference,
+		maxDeviationPercent: maxDeviationPercent,
+	}
+}
+
+// PriceImpactError is returned when the effective price of an order is worse than the reference price by more than the
+// maximum price impact.
+type PriceImpactError struct {
+	// EffectivePrice is the price of the order at its minimum return.
+	EffectivePrice float64
+
+	// ReferencePrice is the reference price.
+	ReferencePrice float64
+
+	// ImpactPercent is how much worse the effective price is than the reference price, in percent.
+	ImpactPercent float64
+
+	// MaxImpactPercent is the configured maximum price impact, in percent.
+	MaxImpactPercent float64
+}
+
+func (e *PriceImpactError) Error() string {
+	return fmt.Sprintf("effective price %f is %.2f%% worse than reference price %f (max %.2f%%)", e.EffectivePrice, e.ImpactPercent, e.ReferencePrice, e.MaxImpactPercent)
+}
+
+// PriceImpactGuard rejects orders whose minimum return is worse than a floor relative to a reference price, typically a
+// small-size quote.
+type PriceImpactGuard struct {
+	// reference provides the reference price.
+	reference PriceReference
+
+	// targetToken is the token being traded.
+	targetToken *Token
+
+	// stableToken is the token prices are denominated in.
+	stableToken *Token
+
+	// maxImpactPercent is the maximum price impact, in percent.
+	maxImpactPercent float64
+}
+
+// Check returns a *PriceImpactError if the effective price of the quote at the minimum return of the preset is worse than
+// the reference price by more than the maximum price impact. Errors reading the reference are returned as is, so that
+// callers fail closed.
+func (g *PriceImpactGuard) Check(orderType OrderType, quote *QuoteResponse, presetName string) error {
+	minReturn, err := quote.MinReturnAmount(presetName)
+	if err != nil {
+		return err
+	}
+
+	fromTokenAmount, err := strconv.ParseFloat(quote.FromTokenAmount, 64)
+	if err != nil {
+		return err
+	}
+	toTokenAmount, _ := new(big.Float).SetInt(minReturn).Float64()
+	if fromTokenAmount <= 0 || toTokenAmount <= 0 {
+		return fmt.Errorf("empty quote %s", quote.QuoteId)
+	}
+
+	var effectivePrice float64
+	if orderType == SellOrder {
+		effectivePrice = (toTokenAmount / math.Pow(10, float64(g.stableToken.Decimals))) / (fromTokenAmount / math.Pow(10, float64(g.targetToken.Decimals)))
+	} else {
+		effectivePrice = (fromTokenAmount / math.Pow(10, float64(g.stableToken.Decimals))) / (toTokenAmount / math.Pow(10, float64(g.targetToken.Decimals)))
+	}
+
+	referencePrice, err := g.reference.ReferencePrice(orderType, effectivePrice)
+	if err != nil {
+		return err
+	}
+
+	// Buying above the reference price and selling below it are both unfavourable.
+	impact := (effectivePrice - referencePrice) / referencePrice * 100
+	if orderType == SellOrder {
+		impact = -impact
+	}
+	if impact > g.maxImpactPercent {
+		return &PriceImpactError{
+			EffectivePrice:   effectivePrice,
+			ReferencePrice:   referencePrice,
+			ImpactPercent:    impact,
+			MaxImpactPercent: g.maxImpactPercent,
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the reference of the guard.
+func (g *PriceImpactGuard) Name() string {
+	return g.reference.Name()
+}
+
+// NewPriceImpactGuard creates a new PriceImpactGuard checking quotes for the pair tokens against the reference.
+func NewPriceImpactGuard(reference PriceReference, targetToken *Token, stableToken *Token, maxImpactPercent float64) *PriceImpactGuard {
+	return &PriceImpactGuard{
+		reference:        reference,
+		targetToken:      targetToken,
+		stableToken:      stableToken,
+		maxImpactPercent: maxImpactPercent,
+	}
+}
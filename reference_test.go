@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// stubPriceReference returns a fixed reference price, or an error.
+type stubPriceReference struct {
+	price float64
+	err   error
+}
+
+func (r *stubPriceReference) ReferencePrice(orderType OrderType, currentPrice float64) (float64, error) {
+	return r.price, r.err
+}
+
+func (r *stubPriceReference) Name() string {
+	return "stub"
+}
+
+// aggregatorClient answers the Chainlink aggregator calls with a fixed latest round.
+type aggregatorClient struct {
+	EthereumClient
+
+	decimals  uint8
+	answer    *big.Int
+	updatedAt time.Time
+	err       error
+}
+
+func (c *aggregatorClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	for name, method := range chainlinkAggregatorABI.Methods {
+		if !bytes.Equal(msg.Data[:4], method.ID) {
+			continue
+		}
+		if name == "decimals" {
+			return method.Outputs.Pack(c.decimals)
+		}
+		return method.Outputs.Pack(big.NewInt(7), c.answer, big.NewInt(c.updatedAt.Unix()), big.NewInt(c.updatedAt.Unix()), big.NewInt(7))
+	}
+	return nil, errStubReverted
+}
+
+func TestPriceGuardCheck(t *testing.T) {
+	errUnavailable := errors.New("reference unavailable")
+
+	tests := []struct {
+		name          string
+		price         float64
+		reference     float64
+		referenceErr  error
+		maxDeviation  float64
+		wantDeviation float64
+		wantErr       error
+	}{
+		{name: "equal", price: 100, reference: 100, maxDeviation: 1},
+		{name: "above within", price: 101, reference: 100, maxDeviation: 1},
+		{name: "below within", price: 99, reference: 100, maxDeviation: 1},
+		{name: "above beyond", price: 102, reference: 100, maxDeviation: 1, wantDeviation: 2},
+		{name: "below beyond", price: 97, reference: 100, maxDeviation: 1, wantDeviation: 3},
+		{name: "zero tolerance", price: 100.5, reference: 100, wantDeviation: 0.5},
+		{name: "reference error fails closed", price: 100, referenceErr: errUnavailable, maxDeviation: 1, wantErr: errUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPriceGuard(&stubPriceReference{price: tt.reference, err: tt.referenceErr}, tt.maxDeviation)
+
+			err := g.Check(BuyOrder, tt.price)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Check = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantDeviation == 0 {
+				if err != nil {
+					t.Errorf("Check = %v, want no deviation", err)
+				}
+				return
+			}
+			var deviationErr *PriceDeviationError
+			if !errors.As(err, &deviationErr) {
+				t.Fatalf("Check = %v, want a deviation of %f%%", err, tt.wantDeviation)
+			}
+			if !approxEqual(deviationErr.DeviationPercent, tt.wantDeviation) || deviationErr.ReferencePrice != tt.reference {
+				t.Errorf("deviation = %+v, want %f%% from %f", deviationErr, tt.wantDeviation, tt.reference)
+			}
+		})
+	}
+}
+
+func TestChainlinkPriceReference(t *testing.T) {
+	errRPC := errors.New("rpc unavailable")
+
+	tests := []struct {
+		name      string
+		decimals  uint8
+		answer    int64
+		age       time.Duration
+		err       error
+		wantPrice float64
+		wantErr   bool
+	}{
+		{name: "fresh", decimals: 8, answer: 6_000_012_345_678, age: time.Minute, wantPrice: 60_000.12345678},
+		{name: "other decimals", decimals: 18, answer: 1_000_000_000_000_000_000, age: time.Minute, wantPrice: 1},
+		{name: "within max age", decimals: 8, answer: 100_000_000, age: time.Hour - time.Second, wantPrice: 1},
+		{name: "stale", decimals: 8, answer: 6_000_000_000_000, age: time.Hour + time.Minute, wantErr: true},
+		{name: "negative answer", decimals: 8, answer: -1, age: time.Minute, wantErr: true},
+		{name: "zero answer", decimals: 8, answer: 0, age: time.Minute, wantErr: true},
+		{name: "call error", err: errRPC, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &aggregatorClient{decimals: tt.decimals, answer: big.NewInt(tt.answer), updatedAt: time.Now().Add(-tt.age), err: tt.err}
+			p := NewChainlinkPriceReference(client, "0x000000000000000000000000000000000000c1a1", time.Hour)
+
+			price, err := p.ReferencePrice(BuyOrder, 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ReferencePrice = %f, want an error", price)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReferencePrice: %v", err)
+			}
+			if !approxEqual(price, tt.wantPrice) {
+				t.Errorf("ReferencePrice = %f, want %f", price, tt.wantPrice)
+			}
+		})
+	}
+}
+
+func TestPriceGuardRejectsStaleChainlinkAnswers(t *testing.T) {
+	client := &aggregatorClient{decimals: 8, answer: big.NewInt(10_000_000_000), updatedAt: time.Now().Add(-2 * time.Hour)}
+	g := NewPriceGuard(NewChainlinkPriceReference(client, "0x000000000000000000000000000000000000c1a1", time.Hour), 1)
+
+	// The quote matches the stale answer exactly, but a stale reference must still block trading.
+	var deviationErr *PriceDeviationError
+	if err := g.Check(SellOrder, 100); err == nil || errors.As(err, &deviationErr) {
+		t.Errorf("Check against a stale answer = %v, want a staleness error", err)
+	}
+}
+
+func TestPriceImpactGuardCheck(t *testing.T) {
+	errUnavailable := errors.New("reference unavailable")
+
+	// sell quotes 1 WBTC and buy quotes 60000 USDC, ending their auction at the given amount under the "fast" preset.
+	sell := func(toTokenAmount string, auctionEndAmount string) *QuoteResponse {
+		return &QuoteResponse{QuoteId: "sell", FromTokenAmount: "100000000", ToTokenAmount: toTokenAmount, Presets: map[string]QuotePreset{"fast": {AuctionEndAmount: auctionEndAmount}}}
+	}
+	buy := func(toTokenAmount string, auctionEndAmount string) *QuoteResponse {
+		return &QuoteResponse{QuoteId: "buy", FromTokenAmount: "60000000000", ToTokenAmount: toTokenAmount, Presets: map[string]QuotePreset{"fast": {AuctionEndAmount: auctionEndAmount}}}
+	}
+
+	tests := []struct {
+		name         string
+		orderType    OrderType
+		quote        *QuoteResponse
+		preset       string
+		referenceErr error
+		maxImpact    float64
+		wantImpact   float64
+		wantErr      bool
+	}{
+		{name: "sell within", orderType: SellOrder, quote: sell("60000000000", "59700000000"), preset: "fast", maxImpact: 1},
+		{name: "sell beyond", orderType: SellOrder, quote: sell("60000000000", "59000000000"), preset: "fast", maxImpact: 1, wantImpact: 100.0 / 60},
+		{name: "sell above reference", orderType: SellOrder, quote: sell("61000000000", "60500000000"), preset: "fast"},
+		{name: "sell without auction end uses the quote", orderType: SellOrder, quote: sell("59000000000", ""), preset: "fast", maxImpact: 1, wantImpact: 100.0 / 60},
+		{name: "unknown preset uses the quote", orderType: SellOrder, quote: sell("59800000000", "1"), preset: "slow", maxImpact: 1},
+		{name: "buy at reference", orderType: BuyOrder, quote: buy("101000000", "100000000"), preset: "fast"},
+		{name: "buy beyond", orderType: BuyOrder, quote: buy("101000000", "98000000"), preset: "fast", maxImpact: 1, wantImpact: (60_000/0.98 - 60_000) / 600},
+		{name: "buy below reference", orderType: BuyOrder, quote: buy("103000000", "102000000"), preset: "fast"},
+		{name: "empty quote", orderType: SellOrder, quote: sell("0", "0"), preset: "fast", maxImpact: 1, wantErr: true},
+		{name: "invalid return", orderType: SellOrder, quote: sell("lots", ""), preset: "fast", maxImpact: 1, wantErr: true},
+		{name: "reference error fails closed", orderType: SellOrder, quote: sell("60000000000", "60000000000"), preset: "fast", referenceErr: errUnavailable, maxImpact: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPriceImpactGuard(&stubPriceReference{price: 60_000, err: tt.referenceErr}, testWBTC, testUSDC, tt.maxImpact)
+
+			err := g.Check(tt.orderType, tt.quote, tt.preset)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Check passed, want an error")
+				}
+				return
+			}
+			if tt.wantImpact == 0 {
+				if err != nil {
+					t.Errorf("Check = %v, want no impact beyond %f%%", err, tt.maxImpact)
+				}
+				return
+			}
+			var impactErr *PriceImpactError
+			if !errors.As(err, &impactErr) {
+				t.Fatalf("Check = %v, want an impact of %f%%", err, tt.wantImpact)
+			}
+			if !approxEqual(impactErr.ImpactPercent, tt.wantImpact) || impactErr.ReferencePrice != 60_000 {
+				t.Errorf("impact = %+v, want %f%% against 60000", impactErr, tt.wantImpact)
+			}
+		})
+	}
+}
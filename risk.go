@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RiskLimits are the limits enforced on trades of a pair, denominated in the stable token. A zero limit is not enforced.
+type RiskLimits struct {
+	// MaxTradeNotional is the maximum value of a single trade.
+	MaxTradeNotional float64
+
+	// MaxTradesPerDay is the maximum number of orders accepted by the relayer per day.
+	MaxTradesPerDay int
+
+	// MaxDailyVolume is the maximum value traded per day.
+	MaxDailyVolume float64
+
+	// MaxDailyLoss is the maximum loss realized per day, as a positive amount.
+	MaxDailyLoss float64
+}
+
+// RiskLimitError is returned when a trade would breach a risk limit.
+type RiskLimitError struct {
+	// Limit is the name of the breached limit.
+	Limit string
+
+	// Value is the value the limit was checked against.
+	Value float64
+
+	// Max is the configured limit.
+	Max float64
+}
+
+func (e *RiskLimitError) Error() string {
+	return fmt.Sprintf("risk limit %s breached: %f (limit %f)", e.Limit, e.Value, e.Max)
+}
+
+// RiskManager checks trades against the risk limits before they are submitted.
+type RiskManager interface {
+	// Check returns a *RiskLimitError if a trade of the pair with the given notional value would breach a limit.
+	Check(pair string, notional float64) error
+}
+
+// riskManager implements the RiskManager interface from the trades and fills in the journal.
+type riskManager struct {
+	// journal is the trade journal the trades of the day are read from.
+	journal TradeJournal
+
+	// pnl computes the realized PnL of the day.
+	pnl PnLEngine
+
+	// stableToken is the token the limits are denominated in.
+	stableToken *Token
+
+	// limits are the enforced limits.
+	limits RiskLimits
+}
+
+// Check returns a *RiskLimitError if a trade of the pair with the given notional value would breach a limit.
+// Days start at midnight in the local time zone (TZ).
+func (m *riskManager) Check(pair string, notional float64) error {
+	if m.limits.MaxTradeNotional > 0 && notional > m.limits.MaxTradeNotional {
+		return &RiskLimitError{Limit: "max_trade_notional", Value: notional, Max: m.limits.MaxTradeNotional}
+	}
+
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	trades, err := m.journal.QueryTrades(pair, dayStart, now)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	volume := 0.0
+	for _, trade := range trades {
+		// Orders that never reached the relayer did not trade.
+		if trade.Status == TradePending || trade.Status == TradeSubmitFailed {
+			continue
+		}
+		count++
+		volume += m.stableNotional(trade)
+	}
+
+	if m.limits.MaxTradesPerDay > 0 && count+1 > m.limits.MaxTradesPerDay {
+		return &RiskLimitError{Limit: "max_trades_per_day", Value: float64(count + 1), Max: float64(m.limits.MaxTradesPerDay)}
+	}
+
+	if m.limits.MaxDailyVolume > 0 && volume+notional > m.limits.MaxDailyVolume {
+		return &RiskLimitError{Limit: "max_daily_volume", Value: volume + notional, Max: m.limits.MaxDailyVolume}
+	}
+
+	if m.limits.MaxDailyLoss > 0 {
+		realized, err := m.pnl.RealizedPnLSince(pair, dayStart)
+		if err != nil {
+			return err
+		}
+		if -realized >= m.limits.MaxDailyLoss {
+			return &RiskLimitError{Limit: "max_daily_loss", Value: -realized, Max: m.limits.MaxDailyLoss}
+		}
+	}
+
+	return nil
+}
+
+// stableNotional returns the value of the trade in the stable token, from its stable token side.
+func (m *riskManager) stableNotional(trade *TradeRecord) float64 {
+	amount := trade.ToTokenAmount
+	if strings.EqualFold(trade.FromTokenAddress, m.stableToken.Address) {
+		amount = trade.FromTokenAmount
+	}
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0
+	}
+	return value / math.Pow(10, float64(m.stableToken.Decimals))
+}
+
+// NewRiskManager creates a new RiskManager enforcing the limits, denominated in the stable token.
+func NewRiskManager(journal TradeJournal, pnl PnLEngine, stableToken *Token, limits RiskLimits) RiskManager {
+	return &riskManager{
+		journal:     journal,
+		pnl:         pnl,
+		stableToken: stableToken,
+		limits:      limits,
+	}
+}
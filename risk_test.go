@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// riskTrade builds a WBTC/USDC trade of the amounts, in whole tokens, created and filled now unless it did not fill.
+func riskTrade(t *testing.T, id string, orderType OrderType, status TradeStatus, wbtc float64, usdc float64) *TradeRecord {
+	t.Helper()
+
+	record := &TradeRecord{ID: id, Pair: "WBTC/USDC", OrderType: orderType.String(), Status: status}
+	wbtcAmount, usdcAmount := baseUnits(t, wbtc, testWBTC), baseUnits(t, usdc, testUSDC)
+	if orderType == BuyOrder {
+		record.FromTokenAddress, record.FromTokenAmount = testUSDC.Address, usdcAmount
+		record.ToTokenAddress, record.ToTokenAmount = testWBTC.Address, wbtcAmount
+	} else {
+		record.FromTokenAddress, record.FromTokenAmount = testWBTC.Address, wbtcAmount
+		record.ToTokenAddress, record.ToTokenAmount = testUSDC.Address, usdcAmount
+	}
+	if status == TradeFilled {
+		record.FilledFromTokenAmount, record.FilledToTokenAmount = record.FromTokenAmount, record.ToTokenAmount
+		record.FilledAt = time.Now()
+	}
+	return record
+}
+
+func TestRiskManagerCheck(t *testing.T) {
+	now := time.Now()
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(-time.Hour)
+
+	// traded is a day of a 1000 USDC buy and a 500 USDC sell accepted by the relayer, plus trades that do not count:
+	// one that never reached the relayer, one whose submission failed and one from yesterday.
+	traded := func(t *testing.T) []*TradeRecord {
+		old := riskTrade(t, "yesterday", BuyOrder, TradeFilled, 1, 5_000)
+		old.CreatedAt = yesterday
+		return []*TradeRecord{
+			riskTrade(t, "buy", BuyOrder, TradeFilled, 0.02, 1_000),
+			riskTrade(t, "sell", SellOrder, TradeSubmitted, 0.01, 500),
+			riskTrade(t, "pending", BuyOrder, TradePending, 1, 50_000),
+			riskTrade(t, "failed", BuyOrder, TradeSubmitFailed, 1, 50_000),
+			old,
+		}
+	}
+	// lost is a day that realized a 60 USDC loss, buying 1 WBTC for 100 USDC and selling it for 40.
+	lost := func(t *testing.T) []*TradeRecord {
+		return []*TradeRecord{
+			riskTrade(t, "buy", BuyOrder, TradeFilled, 1, 100),
+			riskTrade(t, "sell", SellOrder, TradeFilled, 1, 40),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		limits    RiskLimits
+		trades    func(t *testing.T) []*TradeRecord
+		notional  float64
+		wantLimit string
+		wantValue float64
+	}{
+		{name: "no limits", trades: traded, notional: 1_000_000},
+		{name: "trade notional within", limits: RiskLimits{MaxTradeNotional: 1_000}, notional: 1_000},
+		{name: "trade notional above", limits: RiskLimits{MaxTradeNotional: 1_000}, notional: 1_000.01, wantLimit: "max_trade_notional", wantValue: 1_000.01},
+		{name: "trades per day within", limits: RiskLimits{MaxTradesPerDay: 3}, trades: traded, notional: 100},
+		{name: "trades per day reached", limits: RiskLimits{MaxTradesPerDay: 2}, trades: traded, notional: 100, wantLimit: "max_trades_per_day", wantValue: 3},
+		{name: "daily volume within", limits: RiskLimits{MaxDailyVolume: 2_000}, trades: traded, notional: 500},
+		{name: "daily volume above", limits: RiskLimits{MaxDailyVolume: 2_000}, trades: traded, notional: 500.5, wantLimit: "max_daily_volume", wantValue: 2_000.5},
+		{name: "daily loss within", limits: RiskLimits{MaxDailyLoss: 60.5}, trades: lost, notional: 100},
+		{name: "daily loss reached", limits: RiskLimits{MaxDailyLoss: 60}, trades: lost, notional: 100, wantLimit: "max_daily_loss", wantValue: 60},
+		{name: "daily profit", limits: RiskLimits{MaxDailyLoss: 1}, trades: traded, notional: 100},
+		{name: "first limit breached", limits: RiskLimits{MaxTradeNotional: 50, MaxTradesPerDay: 1}, trades: traded, notional: 100, wantLimit: "max_trade_notional", wantValue: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewMemoryStateStore()
+			if tt.trades != nil {
+				for _, trade := range tt.trades(t) {
+					if err := j.RecordTrade(trade); err != nil {
+						t.Fatalf("RecordTrade: %v", err)
+					}
+				}
+			}
+			m := NewRiskManager(j, NewPnLEngine(j, testWBTC, testUSDC, FIFOCostBasis), testUSDC, tt.limits)
+
+			err := m.Check("WBTC/USDC", tt.notional)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Errorf("Check = %v, want no breach", err)
+				}
+				return
+			}
+			var limitErr *RiskLimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Check = %v, want a %s breach", err, tt.wantLimit)
+			}
+			if limitErr.Limit != tt.wantLimit || !approxEqual(limitErr.Value, tt.wantValue) {
+				t.Errorf("breached %s at %f, want %s at %f", limitErr.Limit, limitErr.Value, tt.wantLimit, tt.wantValue)
+			}
+		})
+	}
+}
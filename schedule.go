@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// CooldownKind identifies the event a cooldown follows.
+type CooldownKind int
+
+const (
+	// SubmitCooldown follows a successful order submission.
+	SubmitCooldown CooldownKind = iota
+
+	// FillCooldown follows an order fill.
+	FillCooldown
+
+	// FailureCooldown follows a failed order submission.
+	FailureCooldown
+)
+
+var cooldownKinds = map[CooldownKind]string{
+	SubmitCooldown:  "submit",
+	FillCooldown:    "fill",
+	FailureCooldown: "failure",
+}
+
+func (k CooldownKind) String() string {
+	return cooldownKinds[k]
+}
+
+// QuietHours is a daily period of wall clock time during which no trades are placed. It wraps around midnight if End is before
+// Start.
+type QuietHours struct {
+	// Start is the start of the period, as an offset from midnight.
+	Start time.Duration
+
+	// End is the end of the period, as an offset from midnight.
+	End time.Duration
+}
+
+// Contains reports whether the time falls within the quiet hours, in the location of the time.
+func (q *QuietHours) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if q.Start <= q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
+
+func (q *QuietHours) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return format(q.Start) + "-" + format(q.End)
+}
+
+// ParseQuietHours parses quiet hours in the "HH:MM-HH:MM" format. An empty string means no quiet hours.
+func ParseQuietHours(s string) (*QuietHours, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var startHour, startMinute, endHour, endMinute int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &startHour, &startMinute, &endHour, &endMinute); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM: %v", s, err)
+	}
+	for _, v := range [][2]int{{startHour, startMinute}, {endHour, endMinute}} {
+		if v[0] < 0 || v[0] > 23 || v[1] < 0 || v[1] > 59 {
+			return nil, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", s)
+		}
+	}
+
+	return &QuietHours{
+		Start: time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute,
+		End:   time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute,
+	}, nil
+}
+
+// ScheduleConfig configures the polling cadence and cooldowns of a pair.
+type ScheduleConfig struct {
+	// PollInterval is the time between two polls.
+	PollInterval time.Duration
+
+	// FastPollInterval is the time between two polls while the price is close to a trigger price.
+	FastPollInterval time.Duration
+
+	// ApproachPercent is the distance to a trigger price, in percent, below which the fast poll interval is used.
+	// Zero disables adaptive polling.
+	ApproachPercent float64
+
+	// SubmitCooldown is how long no new order is placed after a successful submission.
+	SubmitCooldown time.Duration
+
+	// FillCooldown is how long no new order is placed after an order is filled.
+	FillCooldown time.Duration
+
+	// FailureCooldown is how long no new order is placed after a failed submission.
+	FailureCooldown time.Duration
+
+	// QuietHours is the daily period, in the quiet hours location, during which no order is placed.
+	QuietHours *QuietHours
+
+	// QuietHoursLocation is the time zone of the quiet hours. Nil means the local time zone.
+	QuietHoursLocation *time.Location
+}
+
+// quietHoursLocation returns the time zone of the quiet hours.
+func (c *ScheduleConfig) quietHoursLocation() *time.Location {
+	if c.QuietHoursLocation == nil {
+		return time.Local
+	}
+	return c.QuietHoursLocation
+}
+
+// cooldown returns the duration of the cooldown of the kind.
+func (c *ScheduleConfig) cooldown(kind CooldownKind) time.Duration {
+	switch kind {
+	case SubmitCooldown:
+		return c.SubmitCooldown
+	case FillCooldown:
+		return c.FillCooldown
+	case FailureCooldown:
+		return c.FailureCooldown
+	default:
+		return 0
+	}
+}
+
+// scheduleConfigJSON is the JSON representation of a ScheduleConfig, with durations as strings. Omitted fields keep their
+// default value.
+type scheduleConfigJSON struct {
+	PollInterval     string   `json:"pollInterval"`
+	FastPollInterval string   `json:"fastPollInterval"`
+	ApproachPercent  *float64 `json:"approachPercent"`
+	SubmitCooldown   string   `json:"submitCooldown"`
+	FillCooldown     string   `json:"fillCooldown"`
+	FailureCooldown  string   `json:"failureCooldown"`
+	QuietHours       *string  `json:"quietHours"`
+	QuietHoursTZ     string   `json:"quietHoursTimezone"`
+}
+
+// ParseScheduleConfigs parses a JSON object of schedule configurations keyed by pair (e.g., "WBTC/USDC"). Omitted fields
+// take their value from the defaults. An empty string means no per-pair configuration.
+func ParseScheduleConfigs(s string, defaults ScheduleConfig) (map[string]ScheduleConfig, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var raw map[string]scheduleConfigJSON
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string]ScheduleConfig, len(raw))
+	for pair, r := range raw {
+		config := defaults
+		for _, d := range []struct {
+			value  string
+			target *time.Duration
+		}{
+			{r.PollInterval, &config.PollInterval},
+			{r.FastPollInterval, &config.FastPollInterval},
+			{r.SubmitCooldown, &config.SubmitCooldown},
+			{r.FillCooldown, &config.FillCooldown},
+			{r.FailureCooldown, &config.FailureCooldown},
+		} {
+			if d.value == "" {
+				continue
+			}
+			duration, err := time.ParseDuration(d.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule for %s: %v", pair, err)
+			}
+			*d.target = duration
+		}
+		if r.ApproachPercent != nil {
+			config.ApproachPercent = *r.ApproachPercent
+		}
+		if r.QuietHours != nil {
+			quietHours, err := ParseQuietHours(*r.QuietHours)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule for %s: %v", pair, err)
+			}
+			config.QuietHours = quietHours
+		}
+		if r.QuietHoursTZ != "" {
+			location, err := time.LoadLocation(r.QuietHoursTZ)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule for %s: %v", pair, err)
+			}
+			config.QuietHoursLocation = location
+		}
+		if config.PollInterval <= 0 || config.FastPollInterval <= 0 {
+			return nil, fmt.Errorf("invalid schedule for %s: poll intervals must be positive", pair)
+		}
+		configs[pair] = config
+	}
+	return configs, nil
+}
+
+// scheduleJob is a pair polled by the scheduler.
+type scheduleJob struct {
+	// tick polls the pair once, and returns the time until the next poll.
+	tick func() time.Duration
+
+	// wake interrupts the wait before the next poll.
+	wake <-chan struct{}
+}
+
+// Scheduler decides when pairs are polled and whether they may place orders, and polls them independently of each other.
+type Scheduler struct {
+	// mu guards cooldowns and jobs.
+	mu sync.Mutex
+
+	// defaults is the schedule of pairs without their own configuration.
+	defaults ScheduleConfig
+
+	// configs holds the schedules of pairs with their own configuration.
+	configs map[string]ScheduleConfig
+
+	// cooldowns maps pairs to the end of their current cooldown.
+	cooldowns map[string]time.Time
+
+	// jobs maps pairs to their polling jobs.
+	jobs map[string]scheduleJob
+}
+
+// Config returns the schedule of the pair.
+func (s *Scheduler) Config(pair string) ScheduleConfig {
+	if config, ok := s.configs[pair]; ok {
+		return config
+	}
+	return s.defaults
+}
+
+// Interval returns the time until the next poll of the pair, shortened while the price is close to a trigger price.
+func (s *Scheduler) Interval(pair string, pm *PriceMonitor, currentPrice float64) time.Duration {
+	config := s.Config(pair)
+	if config.ApproachPercent <= 0 || currentPrice <= 0 {
+		return config.PollInterval
+	}
+
+	distance := math.Min(math.Abs(pm.triggerPriceUp-currentPrice), math.Abs(currentPrice-pm.triggerPriceDown)) / currentPrice * 100
+	if distance <= config.ApproachPercent {
+		log.Debugf("Price is within %.2f%% of a trigger price, polling every %s", distance, config.FastPollInterval)
+		return config.FastPollInterval
+	}
+	return config.PollInterval
+}
+
+// Cooldown starts a cooldown of the kind for the pair. A running cooldown is only ever extended.
+func (s *Scheduler) Cooldown(pair string, kind CooldownKind) {
+	config := s.Config(pair)
+	d := config.cooldown(kind)
+	if d <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(s.cooldowns[pair]) {
+		s.cooldowns[pair] = until
+		log.Infof("Starting %s cooldown for %s until %s", kind, pair, until.Format(time.RFC3339))
+	}
+}
+
+// Blocked reports why the pair may not place orders at the given time, or an empty string if it may.
+func (s *Scheduler) Blocked(pair string, now time.Time) string {
+	s.mu.Lock()
+	until := s.cooldowns[pair]
+	s.mu.Unlock()
+
+	if now.Before(until) {
+		return fmt.Sprintf("cooling down until %s", until.Format(time.RFC3339))
+	}
+	config := s.Config(pair)
+	if quietHours := config.QuietHours; quietHours != nil && quietHours.Contains(now.In(config.quietHoursLocation())) {
+		return fmt.Sprintf("within quiet hours %s", quietHours)
+	}
+	return ""
+}
+
+// Add registers the polling job of the pair. The tick function polls the pair once and returns the time until the next
+// poll, which is cut short when the wake channel receives.
+func (s *Scheduler) Add(pair string, tick func() time.Duration, wake <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[pair] = scheduleJob{tick: tick, wake: wake}
+}
+
+// Run polls every registered pair on its own schedule until the context is cancelled, so that a slow or waiting pair never
+// delays another.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	jobs := make(map[string]scheduleJob, len(s.jobs))
+	for pair, job := range s.jobs {
+		jobs[pair] = job
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for pair, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				d := job.tick()
+				log.Infof("Sleeping for %s before next %s request...", d, pair)
+
+				timer := time.NewTimer(d)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				case <-job.wake:
+					timer.Stop()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// NewScheduler creates a new Scheduler using the defaults for pairs without their own configuration.
+func NewScheduler(defaults ScheduleConfig, configs map[string]ScheduleConfig) *Scheduler {
+	return &Scheduler{
+		defaults:  defaults,
+		configs:   configs,
+		cooldowns: make(map[string]time.Time),
+		jobs:      make(map[string]scheduleJob),
+	}
+}
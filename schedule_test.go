@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursContains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.March, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		hours string
+		at    time.Time
+		want  bool
+	}{
+		{"before daytime window", "09:00-17:00", at(8, 59), false},
+		{"at start of daytime window", "09:00-17:00", at(9, 0), true},
+		{"within daytime window", "09:00-17:00", at(12, 30), true},
+		{"at end of daytime window", "09:00-17:00", at(17, 0), false},
+		{"before overnight window", "22:00-06:00", at(21, 59), false},
+		{"at start of overnight window", "22:00-06:00", at(22, 0), true},
+		{"overnight window before midnight", "22:00-06:00", at(23, 59), true},
+		{"overnight window at midnight", "22:00-06:00", at(0, 0), true},
+		{"overnight window after midnight", "22:00-06:00", at(5, 59), true},
+		{"at end of overnight window", "22:00-06:00", at(6, 0), false},
+		{"midday outside overnight window", "22:00-06:00", at(12, 0), false},
+		{"window ending at midnight", "20:00-00:00", at(23, 30), true},
+		{"after window ending at midnight", "20:00-00:00", at(0, 0), false},
+		{"window starting at midnight", "00:00-02:00", at(0, 0), true},
+		{"empty window", "10:00-10:00", at(10, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuietHours(tt.hours)
+			if err != nil {
+				t.Fatalf("ParseQuietHours(%q): %v", tt.hours, err)
+			}
+			if got := q.Contains(tt.at); got != tt.want {
+				t.Errorf("%s contains %s = %t, want %t", q, tt.at.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"22:00-06:30", "22:00-06:30", false},
+		{"9:05-17:00", "09:05-17:00", false},
+		{"24:00-06:00", "", true},
+		{"22:60-06:00", "", true},
+		{"22:00", "", true},
+		{"night", "", true},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuietHours(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseQuietHours(%q) error = %v, want error %t", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got := ""; q != nil {
+			if got = q.String(); got != tt.want {
+				t.Errorf("ParseQuietHours(%q) = %s, want %s", tt.s, got, tt.want)
+			}
+		} else if tt.want != "" {
+			t.Errorf("ParseQuietHours(%q) = nil, want %s", tt.s, tt.want)
+		}
+	}
+}
+
+func TestSchedulerBlockedInQuietHoursLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	quietHours, err := ParseQuietHours("22:00-06:00")
+	if err != nil {
+		t.Fatalf("ParseQuietHours: %v", err)
+	}
+
+	defaults := ScheduleConfig{PollInterval: time.Minute, FastPollInterval: time.Minute, QuietHours: quietHours, QuietHoursLocation: tokyo}
+	configs, err := ParseScheduleConfigs(`{"WETH/USDC": {"quietHoursTimezone": "UTC"}}`, defaults)
+	if err != nil {
+		t.Fatalf("ParseScheduleConfigs: %v", err)
+	}
+	s := NewScheduler(defaults, configs)
+
+	// 14:00 UTC is 23:00 in Tokyo, within the quiet hours there but not in UTC.
+	now := time.Date(2024, time.March, 1, 14, 0, 0, 0, time.UTC)
+	if s.Blocked("WBTC/USDC", now) == "" {
+		t.Error("pair with Tokyo quiet hours not blocked at 23:00 Tokyo time")
+	}
+	if reason := s.Blocked("WETH/USDC", now); reason != "" {
+		t.Errorf("pair with UTC quiet hours blocked at 14:00 UTC: %s", reason)
+	}
+
+	// 23:00 UTC is 08:00 the next day in Tokyo, after the quiet hours there but within them in UTC.
+	now = time.Date(2024, time.March, 1, 23, 0, 0, 0, time.UTC)
+	if reason := s.Blocked("WBTC/USDC", now); reason != "" {
+		t.Errorf("pair with Tokyo quiet hours blocked at 08:00 Tokyo time: %s", reason)
+	}
+	if s.Blocked("WETH/USDC", now) == "" {
+		t.Error("pair with UTC quiet hours not blocked at 23:00 UTC")
+	}
+}
+
+func TestParseScheduleConfigsInvalidQuietHoursTimezone(t *testing.T) {
+	defaults := ScheduleConfig{PollInterval: time.Minute, FastPollInterval: time.Minute}
+	if _, err := ParseScheduleConfigs(`{"WBTC/USDC": {"quietHoursTimezone": "Mars/Olympus_Mons"}}`, defaults); err == nil {
+		t.Error("unknown quiet hours time zone accepted")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// OrderSerializer serializes order submissions per wallet, so that workers trading pairs with a common token do not commit
+// the same balance to several orders.
+type OrderSerializer struct {
+	// journal is the trade journal open orders are read from.
+	journal TradeJournal
+
+	// pairs are the pairs traded from the wallets.
+	pairs []string
+
+	// mu guards locks.
+	mu sync.Mutex
+
+	// locks holds a lock per lower-cased wallet address.
+	locks map[string]*sync.Mutex
+}
+
+// Lock waits until no other worker submits an order from the wallet, and returns the function releasing the wallet.
+func (s *OrderSerializer) Lock(walletAddress string) func() {
+	s.mu.Lock()
+	lock, ok := s.locks[strings.ToLower(walletAddress)]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[strings.ToLower(walletAddress)] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// Reserved returns the amount of the token committed to the open orders of the pairs other than the given one.
+func (s *OrderSerializer) Reserved(tokenAddress string, excludedPair string) (*big.Int, error) {
+	reserved := new(big.Int)
+	for _, pair := range s.pairs {
+		if pair == excludedPair {
+			continue
+		}
+
+		trades, err := s.journal.OpenTrades(pair)
+		if err != nil {
+			return nil, err
+		}
+		for _, trade := range trades {
+			if trade.Status != TradeSubmitted || !strings.EqualFold(trade.FromTokenAddress, tokenAddress) {
+				continue
+			}
+			amount, ok := new(big.Int).SetString(trade.FromTokenAmount, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid amount %s of trade %s", trade.FromTokenAmount, trade.ID)
+			}
+			reserved.Add(reserved, amount)
+		}
+	}
+	return reserved, nil
+}
+
+// NewOrderSerializer creates a new OrderSerializer for the pairs, reading open orders from the journal.
+func NewOrderSerializer(journal TradeJournal, pairs []string) *OrderSerializer {
+	return &OrderSerializer{
+		journal: journal,
+		pairs:   pairs,
+		locks:   make(map[string]*sync.Mutex),
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ServeHTTP serves the handler on the address until the process exits. Errors are logged, as the HTTP surface is
+// auxiliary to the trading loop.
+func ServeHTTP(address string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Infof("Serving HTTP on %s", address)
+	if err := server.ListenAndServe(); err != nil {
+		log.Errorf("Error occurred while serving HTTP: %v", err)
+	}
+}
+
+// writeJSON writes the value as a JSON response with the status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Error occurred while writing JSON response: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// accessTokenRefreshBuffer is how long before its expiration an access token is refreshed.
+const accessTokenRefreshBuffer = 10 * time.Minute
+
+// accessTokenRetryInterval is the time between two attempts to refresh an access token after a failed refresh.
+const accessTokenRetryInterval = 30 * time.Second
+
+// SessionManager keeps an access token for the 1inch API, and refreshes it before it expires. It is safe for concurrent
+// use.
+type SessionManager interface {
+	// AccessToken returns the current access token, or an empty string if none was issued yet.
+	AccessToken() string
+
+	// Expiration returns the expiration time of the current access token in Unix timestamp format, or zero if it never
+	// expires.
+	Expiration() int64
+
+	// Refresh refreshes the access token if there is none or it expires within the refresh buffer. Concurrent callers
+	// wait for a single refresh.
+	Refresh() error
+
+	// Invalidate refreshes the access token after the API rejected it. It does nothing if the token was already replaced
+	// by another caller.
+	Invalidate(token string) error
+
+	// Run refreshes the access token in the background before it expires, until the context is cancelled.
+	Run(ctx context.Context)
+}
+
+// sessionManager implements the SessionManager interface on top of a function issuing new sessions.
+type sessionManager struct {
+	// mu guards session and renewal. It is not held while a new session is issued.
+	mu sync.RWMutex
+
+	// session is the current session, nil until the first refresh.
+	session *oneInchRouterSession
+
+	// renewal is the renewal in flight, nil if there is none. Concurrent renewals wait for it instead of issuing a session.
+	renewal *sessionRenewal
+
+	// issue requests a new session from the 1inch API.
+	issue func() (*oneInchRouterSession, error)
+}
+
+// sessionRenewal is a renewal of the session in flight.
+type sessionRenewal struct {
+	// done is closed when the renewal completed.
+	done chan struct{}
+
+	// err is the error of the renewal, set before done is closed.
+	err error
+}
+
+// AccessToken returns the current access token, or an empty string if none was issued yet.
+func (m *sessionManager) AccessToken() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.session == nil {
+		return ""
+	}
+	return m.session.AccessToken
+}
+
+// Expiration returns the expiration time of the current access token in Unix timestamp format.
+func (m *sessionManager) Expiration() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.session == nil {
+		return 0
+	}
+	return m.session.Exp
+}
+
+// Refresh refreshes the access token if there is none or it expires within the refresh buffer.
+func (m *sessionManager) Refresh() error {
+	return m.renew("expiring", func(session *oneInchRouterSession) bool {
+		return session == nil || time.Until(time.Unix(session.Exp, 0)) <= accessTokenRefreshBuffer
+	})
+}
+
+// Invalidate refreshes the access token after the API rejected it, unless it was already replaced.
+func (m *sessionManager) Invalidate(token string) error {
+	return m.renew("unauthorized", func(session *oneInchRouterSession) bool {
+		return session == nil || session.AccessToken == token
+	})
+}
+
+// renew issues a new session if the current one is stale. The lock is not held while the session is issued, callers
+// arriving meanwhile wait for the renewal in flight and share its outcome.
+func (m *sessionManager) renew(reason string, isStale func(session *oneInchRouterSession) bool) error {
+	m.mu.RLock()
+	stale := isStale(m.session)
+	m.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+
+	m.mu.Lock()
+	if !isStale(m.session) {
+		m.mu.Unlock()
+		return nil
+	}
+	if renewal := m.renewal; renewal != nil {
+		m.mu.Unlock()
+		<-renewal.done
+		return renewal.err
+	}
+	renewal := &sessionRenewal{done: make(chan struct{})}
+	m.renewal = renewal
+	m.mu.Unlock()
+
+	session, err := m.issue()
+
+	m.mu.Lock()
+	if err == nil {
+		m.session = session
+	}
+	m.renewal = nil
+	m.mu.Unlock()
+
+	renewal.err = err
+	close(renewal.done)
+	if err != nil {
+		return err
+	}
+	RecordTokenRefresh(reason, time.Now())
+
+	log.Debugf("Refreshed access token (%s), expires at %s", reason, time.Unix(session.Exp, 0).Format(time.RFC3339))
+	return nil
+}
+
+// Run refreshes the access token in the background before it expires, retrying failed refreshes until the token is
+// renewed or the context is cancelled.
+func (m *sessionManager) Run(ctx context.Context) {
+	for {
+		wait := accessTokenRetryInterval
+		if err := m.Refresh(); err != nil {
+			log.Errorf("Error occurred while refreshing access token: %v, retrying in %s", err, wait)
+		} else {
+			wait = max(time.Until(time.Unix(m.Expiration(), 0))-accessTokenRefreshBuffer, accessTokenRetryInterval)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// NewSessionManager creates a new SessionManager issuing sessions with the function. No session is issued until the
+// first refresh.
+func NewSessionManager(issue func() (*oneInchRouterSession, error)) SessionManager {
+	return &sessionManager{issue: issue}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingIssuer issues numbered sessions, each one once released.
+type blockingIssuer struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (bi *blockingIssuer) issue() (*oneInchRouterSession, error) {
+	n := bi.calls.Add(1)
+	bi.started <- struct{}{}
+	<-bi.release
+	if bi.err != nil {
+		return nil, bi.err
+	}
+	return &oneInchRouterSession{AccessToken: fmt.Sprintf("token-%d", n), Exp: time.Now().Add(time.Hour).Unix()}, nil
+}
+
+func newBlockingIssuer(err error) *blockingIssuer {
+	return &blockingIssuer{
+		started: make(chan struct{}, 16),
+		release: make(chan struct{}),
+		err:     err,
+	}
+}
+
+// renewConcurrently runs the renewal from several goroutines while the first session is being issued, and returns
+// their errors once the issuer is released.
+func renewConcurrently(t *testing.T, m SessionManager, bi *blockingIssuer, renew func() error) []error {
+	t.Helper()
+
+	const callers = 8
+	errs := make([]error, callers)
+	var ready, wg sync.WaitGroup
+	ready.Add(callers)
+	wg.Add(callers)
+	for i := range callers {
+		go func() {
+			defer wg.Done()
+			ready.Done()
+			errs[i] = renew()
+		}()
+	}
+
+	select {
+	case <-bi.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no session issued")
+	}
+
+	// Readers are not blocked while the session is issued.
+	read := make(chan string)
+	go func() { read <- m.AccessToken() }()
+	select {
+	case <-read:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AccessToken blocked while a session was issued")
+	}
+
+	// Give the other callers time to join the renewal in flight.
+	ready.Wait()
+	time.Sleep(50 * time.Millisecond)
+
+	close(bi.release)
+	wg.Wait()
+	return errs
+}
+
+func TestSessionManagerCoalescesRefreshes(t *testing.T) {
+	bi := newBlockingIssuer(nil)
+	m := NewSessionManager(bi.issue)
+
+	for i, err := range renewConcurrently(t, m, bi, m.Refresh) {
+		if err != nil {
+			t.Errorf("caller %d: Refresh: %v", i, err)
+		}
+	}
+	if calls := bi.calls.Load(); calls != 1 {
+		t.Errorf("issued %d sessions, want 1", calls)
+	}
+	if token := m.AccessToken(); token != "token-1" {
+		t.Errorf("access token = %q, want token-1", token)
+	}
+
+	// A fresh token is not refreshed again.
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if calls := bi.calls.Load(); calls != 1 {
+		t.Errorf("issued %d sessions for a fresh token, want 1", calls)
+	}
+}
+
+func TestSessionManagerCoalescesInvalidations(t *testing.T) {
+	bi := newBlockingIssuer(nil)
+	close(bi.release)
+	m := NewSessionManager(bi.issue)
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	<-bi.started
+
+	bi.release = make(chan struct{})
+	for i, err := range renewConcurrently(t, m, bi, func() error { return m.Invalidate("token-1") }) {
+		if err != nil {
+			t.Errorf("caller %d: Invalidate: %v", i, err)
+		}
+	}
+	if calls := bi.calls.Load(); calls != 2 {
+		t.Errorf("issued %d sessions, want 2", calls)
+	}
+
+	// The rejected token was already replaced.
+	if err := m.Invalidate("token-1"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if calls := bi.calls.Load(); calls != 2 {
+		t.Errorf("issued %d sessions after invalidating a replaced token, want 2", calls)
+	}
+}
+
+func TestSessionManagerSharesRenewalErrors(t *testing.T) {
+	issueErr := errors.New("issue failed")
+	bi := newBlockingIssuer(issueErr)
+	m := NewSessionManager(bi.issue)
+
+	for i, err := range renewConcurrently(t, m, bi, m.Refresh) {
+		if !errors.Is(err, issueErr) {
+			t.Errorf("caller %d: Refresh = %v, want %v", i, err, issueErr)
+		}
+	}
+	if calls := bi.calls.Load(); calls != 1 {
+		t.Errorf("issued %d sessions, want 1", calls)
+	}
+	if token := m.AccessToken(); token != "" {
+		t.Errorf("access token = %q after a failed renewal, want none", token)
+	}
+}
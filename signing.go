@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// HashTypedData computes the EIP-712 digest (keccak256("\x19\x01" || domainSeparator || hashStruct(message))) of the typed data.
+func HashTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	digestHash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	return digestHash, nil
+}
+
+// HashPersonalMessage computes the EIP-191 personal_sign digest of the message.
+func HashPersonalMessage(message []byte) []byte {
+	return accounts.TextHash(message)
+}
+
+// RecoverTypedDataSigner returns the address that produced the signature over the EIP-712 typed data.
+func RecoverTypedDataSigner(typedData apitypes.TypedData, signature []byte) (string, error) {
+	digestHash, err := HashTypedData(typedData)
+	if err != nil {
+		return "", err
+	}
+	return recoverSigner(digestHash, signature)
+}
+
+// RecoverPersonalMessageSigner returns the address that produced the EIP-191 personal_sign signature over the message.
+func RecoverPersonalMessageSigner(message []byte, signature []byte) (string, error) {
+	return recoverSigner(HashPersonalMessage(message), signature)
+}
+
+// VerifyTypedDataSignature reports whether the signature over the EIP-712 typed data was produced by the given address.
+func VerifyTypedDataSignature(address string, typedData apitypes.TypedData, signature []byte) (bool, error) {
+	signer, err := RecoverTypedDataSigner(typedData, signature)
+	if err != nil {
+		return false, err
+	}
+	return common.HexToAddress(signer) == common.HexToAddress(address), nil
+}
+
+// VerifyPersonalMessageSignature reports whether the EIP-191 personal_sign signature over the message was produced by the given address.
+func VerifyPersonalMessageSignature(address string, message []byte, signature []byte) (bool, error) {
+	signer, err := RecoverPersonalMessageSigner(message, signature)
+	if err != nil {
+		return false, err
+	}
+	return common.HexToAddress(signer) == common.HexToAddress(address), nil
+}
+
+// recoverSigner recovers the signer address from a 65 byte [R || S || V] signature over the digest.
+// Both the raw (0/1) and the Ethereum (27/28) forms of V are accepted.
+func recoverSigner(digestHash []byte, signature []byte) (string, error) {
+	if len(signature) != crypto.SignatureLength {
+		return "", errors.New("invalid signature length")
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	publicKey, err := crypto.SigToPub(digestHash, sig)
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.PubkeyToAddress(*publicKey).Hex(), nil
+}
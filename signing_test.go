@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Throwaway key used only by tests, never holding real funds.
+const (
+	testPrivateKeyHex = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcaf784d7bf4f2ff80"
+	testAddress       = "0x500d75F1329cf98352c32Cf238c2192ca78faFFE"
+	otherAddress      = "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+)
+
+func newTestWallet(t *testing.T) Wallet {
+	t.Helper()
+
+	w, err := NewWallet(testPrivateKeyHex, testAddress, "1")
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+	return w
+}
+
+func testTypedData() apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Mail": {
+				{Name: "from", Type: "address"},
+				{Name: "contents", Type: "string"},
+			},
+		},
+		PrimaryType: "Mail",
+		Domain: apitypes.TypedDataDomain{
+			Name:              "Test",
+			Version:           "1",
+			ChainId:           (*math.HexOrDecimal256)(big.NewInt(1)),
+			VerifyingContract: "0x111111125421cA6dc452d289314280a0f8842A65",
+		},
+		Message: apitypes.TypedDataMessage{
+			"from":     testAddress,
+			"contents": "hello",
+		},
+	}
+}
+
+func TestTypedDataRoundTrip(t *testing.T) {
+	w := newTestWallet(t)
+	typedData := testTypedData()
+
+	signature, err := w.SignTypedData(typedData)
+	if err != nil {
+		t.Fatalf("SignTypedData: %v", err)
+	}
+
+	signer, err := RecoverTypedDataSigner(typedData, signature)
+	if err != nil {
+		t.Fatalf("RecoverTypedDataSigner: %v", err)
+	}
+	if signer != testAddress {
+		t.Errorf("recovered %s, want %s", signer, testAddress)
+	}
+
+	ok, err := VerifyTypedDataSignature(testAddress, typedData, signature)
+	if err != nil || !ok {
+		t.Errorf("VerifyTypedDataSignature = %t, %v, want true", ok, err)
+	}
+
+	typedData.Message["contents"] = "tampered"
+	ok, err = VerifyTypedDataSignature(testAddress, typedData, signature)
+	if err != nil || ok {
+		t.Errorf("VerifyTypedDataSignature of tampered message = %t, %v, want false", ok, err)
+	}
+}
+
+func TestPersonalMessageRoundTrip(t *testing.T) {
+	w := newTestWallet(t)
+	message := []byte("kryptonite sign-test")
+
+	signature, err := w.SignPersonalMessage(message)
+	if err != nil {
+		t.Fatalf("SignPersonalMessage: %v", err)
+	}
+
+	signer, err := RecoverPersonalMessageSigner(message, signature)
+	if err != nil {
+		t.Fatalf("RecoverPersonalMessageSigner: %v", err)
+	}
+	if signer != testAddress {
+		t.Errorf("recovered %s, want %s", signer, testAddress)
+	}
+
+	ok, err := VerifyPersonalMessageSignature(testAddress, message, signature)
+	if err != nil || !ok {
+		t.Errorf("VerifyPersonalMessageSignature = %t, %v, want true", ok, err)
+	}
+}
+
+func TestVerifyWrongAddress(t *testing.T) {
+	w := newTestWallet(t)
+	message := []byte("kryptonite sign-test")
+
+	signature, err := w.SignPersonalMessage(message)
+	if err != nil {
+		t.Fatalf("SignPersonalMessage: %v", err)
+	}
+
+	ok, err := VerifyPersonalMessageSignature(otherAddress, message, signature)
+	if err != nil {
+		t.Fatalf("VerifyPersonalMessageSignature: %v", err)
+	}
+	if ok {
+		t.Errorf("signature verified against %s, want rejection", otherAddress)
+	}
+
+	ok, err = VerifyTypedDataSignature(otherAddress, testTypedData(), mustSignTypedData(t, w))
+	if err != nil {
+		t.Fatalf("VerifyTypedDataSignature: %v", err)
+	}
+	if ok {
+		t.Errorf("typed data signature verified against %s, want rejection", otherAddress)
+	}
+}
+
+func TestSignatureVNormalization(t *testing.T) {
+	w := newTestWallet(t)
+	message := []byte("kryptonite sign-test")
+
+	signature, err := w.SignPersonalMessage(message)
+	if err != nil {
+		t.Fatalf("SignPersonalMessage: %v", err)
+	}
+	if v := signature[crypto.RecoveryIDOffset]; v != 27 && v != 28 {
+		t.Fatalf("signed V = %d, want 27 or 28", v)
+	}
+
+	raw := make([]byte, len(signature))
+	copy(raw, signature)
+	raw[crypto.RecoveryIDOffset] -= 27
+	if raw[crypto.RecoveryIDOffset] > 1 {
+		t.Fatalf("raw V = %d, want 0 or 1", raw[crypto.RecoveryIDOffset])
+	}
+
+	for name, sig := range map[string][]byte{"27/28": signature, "0/1": raw} {
+		signer, err := RecoverPersonalMessageSigner(message, sig)
+		if err != nil {
+			t.Errorf("%s: RecoverPersonalMessageSigner: %v", name, err)
+			continue
+		}
+		if signer != testAddress {
+			t.Errorf("%s: recovered %s, want %s", name, signer, testAddress)
+		}
+	}
+
+	if _, err := RecoverPersonalMessageSigner(message, signature[:64]); err == nil {
+		t.Error("recovering a 64 byte signature succeeded, want an error")
+	}
+}
+
+func mustSignTypedData(t *testing.T, w Wallet) []byte {
+	t.Helper()
+
+	signature, err := w.SignTypedData(testTypedData())
+	if err != nil {
+		t.Fatalf("SignTypedData: %v", err)
+	}
+	return signature
+}
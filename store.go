@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BalanceStore persists the last known balance of each token and the history of its changes.
+type BalanceStore interface {
+	// GetLastBalance returns the last known balance of the token, and whether one was stored.
+	GetLastBalance(symbol string) (string, bool, error)
+
+	// SetLastBalance stores the last known balance of the token.
+	SetLastBalance(symbol string, balance string) error
+
+	// PushBalance appends the balance to the balance history of the token.
+	PushBalance(symbol string, balance string) error
+}
+
+// MonitorStateStore persists the state of the price monitor of each pair.
+type MonitorStateStore interface {
+	// GetMonitorState returns the stored price monitor state of the pair, or nil if there is none.
+	GetMonitorState(pair string) (*PriceMonitorState, error)
+
+	// SetMonitorState stores the price monitor state of the pair.
+	SetMonitorState(pair string, state *PriceMonitorState) error
+}
+
+// LockStore provides expiring locks, so that only a single owner acts on a resource at a time.
+// Every successful acquisition returns a fencing token that is strictly greater than the ones returned before,
+// so that a stale owner can be told apart from the current one.
+type LockStore interface {
+	// AcquireLock acquires the lock for the owner if it is free or expired, and reports whether it succeeded
+	// together with the fencing token of the acquisition.
+	AcquireLock(name string, owner string, ttl time.Duration) (int64, bool, error)
+
+	// HoldsLock reports whether the lock is still held by the owner under the given fencing token.
+	HoldsLock(name string, owner string, token int64) (bool, error)
+
+	// RenewLock extends the lock if it is still held by the owner, and reports whether it succeeded.
+	RenewLock(name string, owner string, ttl time.Duration) (bool, error)
+
+	// ReleaseLock releases the lock if it is held by the owner.
+	ReleaseLock(name string, owner string) error
+}
+
+// StateStore persists all of the service state.
+type StateStore interface {
+	BalanceStore
+	MonitorStateStore
+	TradeJournal
+	IntentStore
+	EquityStore
+	TokenCache
+	LockStore
+
+	// Fenced returns a view of the store whose balance, price monitor state, trade and intent writes only succeed
+	// while the lock is held by the owner under the fencing token, checked in the same transaction as each write.
+	// Writes fail with ErrFenced once the lock was lost. The view shares the store, which must be closed instead.
+	Fenced(name string, owner string, token int64) StateStore
+
+	// Ping checks that the store is reachable.
+	Ping() error
+
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// ErrFenced is returned by the writes of a fenced store once its lock is no longer held under its fencing token.
+var ErrFenced = errors.New("lock is no longer held under the fencing token")
+
+// lockFence identifies the lock acquisition that the writes of a fenced store are conditional on.
+type lockFence struct {
+	name  string
+	owner string
+	token int64
+}
+
+// redisStateStore implements the StateStore interface on top of Redis.
+type redisStateStore struct {
+	TradeJournal
+	IntentStore
+	EquityStore
+	TokenCache
+
+	// rdb is the Redis client.
+	rdb *redis.Client
+
+	// fence is the lock acquisition the writes are conditional on, or nil if they are unconditional.
+	fence *lockFence
+}
+
+// fencedMaxAttempts is how often a fenced Redis write is retried when the lock changes while it is checked,
+// such as when the owner renews it concurrently.
+const fencedMaxAttempts = 3
+
+// txPipelined runs the writes in a MULTI/EXEC transaction. If the fence is set, the lock and its fencing token counter
+// are watched and checked first, so that the transaction is discarded if another owner acquired the lock meanwhile.
+func txPipelined(rdb *redis.Client, fence *lockFence, fn func(pipe redis.Pipeliner) error) error {
+	if fence == nil {
+		_, err := rdb.TxPipelined(context.TODO(), fn)
+		return err
+	}
+
+	check := func(tx *redis.Tx) error {
+		owner, err := tx.Get(context.TODO(), lockKey(fence.name)).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		token, err := tx.Get(context.TODO(), fenceKey(fence.name)).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if owner != fence.owner || token != fence.token {
+			return ErrFenced
+		}
+		_, err = tx.TxPipelined(context.TODO(), fn)
+		return err
+	}
+
+	var err error
+	for range fencedMaxAttempts {
+		err = rdb.Watch(context.TODO(), check, lockKey(fence.name), fenceKey(fence.name))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+// lastBalanceKey returns the Redis key holding the last known balance of the token.
+func lastBalanceKey(symbol string) string {
+	return fmt.Sprintf("LAST_BALANCE:%s", symbol)
+}
+
+// balancesKey returns the Redis key of the list holding the balance history of the token.
+func balancesKey(symbol string) string {
+	return fmt.Sprintf("BALANCES:%s", symbol)
+}
+
+// monitorStateKey returns the Redis key holding the price monitor state of the pair.
+func monitorStateKey(pair string) string {
+	return fmt.Sprintf("MONITOR:%s", pair)
+}
+
+// lockKey returns the Redis key of the lock.
+func lockKey(name string) string {
+	return fmt.Sprintf("LOCK:%s", name)
+}
+
+// fenceKey returns the Redis key of the fencing token counter of the lock.
+func fenceKey(name string) string {
+	return fmt.Sprintf("FENCE:%s", name)
+}
+
+// GetLastBalance returns the last known balance of the token, and whether one was stored.
+func (s *redisStateStore) GetLastBalance(symbol string) (string, bool, error) {
+	balance, err := s.rdb.Get(context.TODO(), lastBalanceKey(symbol)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return balance, true, nil
+}
+
+// SetLastBalance stores the last known balance of the token.
+func (s *redisStateStore) SetLastBalance(symbol string, balance string) error {
+	return txPipelined(s.rdb, s.fence, func(pipe redis.Pipeliner) error {
+		return pipe.Set(context.TODO(), lastBalanceKey(symbol), balance, 0).Err()
+	})
+}
+
+// PushBalance appends the balance to the balance history of the token.
+func (s *redisStateStore) PushBalance(symbol string, balance string) error {
+	return txPipelined(s.rdb, s.fence, func(pipe redis.Pipeliner) error {
+		return pipe.LPush(context.TODO(), balancesKey(symbol), balance).Err()
+	})
+}
+
+// GetMonitorState returns the stored price monitor state of the pair, or nil if there is none.
+func (s *redisStateStore) GetMonitorState(pair string) (*PriceMonitorState, error) {
+	data, err := s.rdb.Get(context.TODO(), monitorStateKey(pair)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state PriceMonitorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetMonitorState stores the price monitor state of the pair.
+func (s *redisStateStore) SetMonitorState(pair string, state *PriceMonitorState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return txPipelined(s.rdb, s.fence, func(pipe redis.Pipeliner) error {
+		return pipe.Set(context.TODO(), monitorStateKey(pair), data, 0).Err()
+	})
+}
+
+// acquireLockScript sets the lock if it is free and increments its fencing token counter.
+var acquireLockScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// holdsLockScript checks that the lock is held by the owner and that no other acquisition happened since the token was issued.
+var holdsLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] and redis.call("GET", KEYS[2]) == ARGV[2] then
+	return 1
+end
+return 0
+`)
+
+// renewLockScript extends the lock expiry only if the lock is still held by the owner.
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes the lock only if it is still held by the owner.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock acquires the lock for the owner if it is free or expired, and reports whether it succeeded
+// together with the fencing token of the acquisition.
+func (s *redisStateStore) AcquireLock(name string, owner string, ttl time.Duration) (int64, bool, error) {
+	token, err := acquireLockScript.Run(context.TODO(), s.rdb, []string{lockKey(name), fenceKey(name)}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token > 0, nil
+}
+
+// HoldsLock reports whether the lock is still held by the owner under the given fencing token.
+func (s *redisStateStore) HoldsLock(name string, owner string, token int64) (bool, error) {
+	n, err := holdsLockScript.Run(context.TODO(), s.rdb, []string{lockKey(name), fenceKey(name)}, owner, strconv.FormatInt(token, 10)).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RenewLock extends the lock if it is still held by the owner, and reports whether it succeeded.
+func (s *redisStateStore) RenewLock(name string, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewLockScript.Run(context.TODO(), s.rdb, []string{lockKey(name)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseLock releases the lock if it is held by the owner.
+func (s *redisStateStore) ReleaseLock(name string, owner string) error {
+	return releaseLockScript.Run(context.TODO(), s.rdb, []string{lockKey(name)}, owner).Err()
+}
+
+// Fenced returns a view of the store whose writes only succeed while the lock is held by the owner under the fencing token.
+func (s *redisStateStore) Fenced(name string, owner string, token int64) StateStore {
+	fence := &lockFence{name: name, owner: owner, token: token}
+	return &redisStateStore{
+		TradeJournal: &redisTradeJournal{rdb: s.rdb, fence: fence},
+		IntentStore:  &redisIntentStore{rdb: s.rdb, fence: fence},
+		EquityStore:  s.EquityStore,
+		TokenCache:   s.TokenCache,
+		rdb:          s.rdb,
+		fence:        fence,
+	}
+}
+
+// Ping checks that the store is reachable.
+func (s *redisStateStore) Ping() error {
+	return s.rdb.Ping(context.TODO()).Err()
+}
+
+// Close releases the resources held by the store.
+func (s *redisStateStore) Close() error {
+	return s.rdb.Close()
+}
+
+// NewRedisStateStore creates a new StateStore backed by Redis.
+func NewRedisStateStore(rdb *redis.Client) StateStore {
+	return &redisStateStore{
+		TradeJournal: NewRedisTradeJournal(rdb),
+		IntentStore:  NewRedisIntentStore(rdb),
+		EquityStore:  NewRedisEquityStore(rdb),
+		TokenCache:   NewRedisTokenCache(rdb),
+		rdb:          rdb,
+	}
+}
+
+// NewStateStore creates the StateStore selected by kind: "redis", "bolt" or "memory".
+// The Redis backend connects to addr, the bolt backend opens the database file at path.
+func NewStateStore(kind string, addr string, password string, path string) (StateStore, error) {
+	switch strings.ToLower(kind) {
+	case "", "redis":
+		return NewRedisStateStore(redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: password,
+			DB:       0,
+		})), nil
+	case "bolt":
+		return NewBoltStateStore(path)
+	case "memory":
+		return NewMemoryStateStore(), nil
+	default:
+		return nil, errors.New("unknown state store: " + kind)
+	}
+}
+
+// filterTrades returns the records of the pair created within [from, to], oldest first. An empty pair matches all pairs.
+func filterTrades(records []*TradeRecord, pair string, from time.Time, to time.Time) []*TradeRecord {
+	filtered := make([]*TradeRecord, 0, len(records))
+	for _, record := range records {
+		if pair != "" && record.Pair != pair {
+			continue
+		}
+		if record.CreatedAt.Before(from) || record.CreatedAt.After(to) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].CreatedAt.Before(filtered[j].CreatedAt)
+	})
+
+	return filtered
+}
+
+// touchTrade sets the creation and update timestamps of the record before it is stored.
+func touchTrade(record *TradeRecord) {
+	now := time.Now()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	lastBalancesBucket  = []byte("last_balances")
+	balancesBucket      = []byte("balances")
+	monitorStatesBucket = []byte("monitor_states")
+	tradesBucket        = []byte("trades")
+	tradesByTimeBucket  = []byte("trades_by_time")
+	pairTradesBucket    = []byte("pair_trades")
+	openTradesBucket    = []byte("open_trades")
+	intentsBucket       = []byte("intents")
+	equityBucket        = []byte("equity")
+	tokensBucket        = []byte("tokens")
+	locksBucket         = []byte("locks")
+	fencesBucket        = []byte("fences")
+)
+
+// boltLock is a lock persisted in the bolt database.
+type boltLock struct {
+	Owner     string    `json:"owner"`
+	Token     int64     `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// boltStateStore implements the StateStore interface on top of an embedded bolt database file.
+// The database file can only be opened by a single process at a time.
+type boltStateStore struct {
+	// db is the bolt database.
+	db *bolt.DB
+
+	// fence is the lock acquisition the writes are conditional on, or nil if they are unconditional.
+	fence *lockFence
+}
+
+// update runs the writes in a read-write transaction, after checking the fence in the same transaction if it is set.
+func (s *boltStateStore) update(fn func(tx *bolt.Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if s.fence != nil {
+			holds, err := holdsLock(tx, s.fence.name, s.fence.owner, s.fence.token)
+			if err != nil {
+				return err
+			}
+			if !holds {
+				return ErrFenced
+			}
+		}
+		return fn(tx)
+	})
+}
+
+// timeKey encodes the time as a big-endian key, so that keys sort chronologically.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// tradeIndexKey returns the key indexing the trade by creation time, suffixed with its ID so that keys are unique.
+func tradeIndexKey(record *TradeRecord) []byte {
+	return append(timeKey(record.CreatedAt), record.ID...)
+}
+
+// indexTrade indexes the trade by creation time, overall and within its pair, and tracks it in the open trades of its
+// pair while its status may still change. The previous version of the record, if any, is unindexed first.
+func indexTrade(tx *bolt.Tx, previous *TradeRecord, record *TradeRecord) error {
+	if previous != nil {
+		if err := tx.Bucket(tradesByTimeBucket).Delete(tradeIndexKey(previous)); err != nil {
+			return err
+		}
+		if b := tx.Bucket(pairTradesBucket).Bucket([]byte(previous.Pair)); b != nil {
+			if err := b.Delete(tradeIndexKey(previous)); err != nil {
+				return err
+			}
+		}
+		if b := tx.Bucket(openTradesBucket).Bucket([]byte(previous.Pair)); b != nil {
+			if err := b.Delete([]byte(previous.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Bucket(tradesByTimeBucket).Put(tradeIndexKey(record), []byte(record.ID)); err != nil {
+		return err
+	}
+	b, err := tx.Bucket(pairTradesBucket).CreateBucketIfNotExists([]byte(record.Pair))
+	if err != nil {
+		return err
+	}
+	if err := b.Put(tradeIndexKey(record), []byte(record.ID)); err != nil {
+		return err
+	}
+	if !record.Status.IsOpen() {
+		return nil
+	}
+	b, err = tx.Bucket(openTradesBucket).CreateBucketIfNotExists([]byte(record.Pair))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(record.ID), nil)
+}
+
+// getTrade returns the trade record with the given ID within the transaction, or nil if it does not exist.
+func getTrade(tx *bolt.Tx, id []byte) (*TradeRecord, error) {
+	data := tx.Bucket(tradesBucket).Get(id)
+	if data == nil {
+		return nil, nil
+	}
+	record := &TradeRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// GetLastBalance returns the last known balance of the token, and whether one was stored.
+func (s *boltStateStore) GetLastBalance(symbol string) (string, bool, error) {
+	var balance []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		balance = tx.Bucket(lastBalancesBucket).Get([]byte(symbol))
+		if balance != nil {
+			balance = append([]byte(nil), balance...)
+		}
+		return nil
+	})
+	return string(balance), balance != nil, err
+}
+
+// SetLastBalance stores the last known balance of the token.
+func (s *boltStateStore) SetLastBalance(symbol string, balance string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(lastBalancesBucket).Put([]byte(symbol), []byte(balance))
+	})
+}
+
+// PushBalance appends the balance to the balance history of the token.
+func (s *boltStateStore) PushBalance(symbol string, balance string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(balancesBucket).CreateBucketIfNotExists([]byte(symbol))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return b.Put(key, []byte(balance))
+	})
+}
+
+// GetMonitorState returns the stored price monitor state of the pair, or nil if there is none.
+func (s *boltStateStore) GetMonitorState(pair string) (*PriceMonitorState, error) {
+	var state *PriceMonitorState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(monitorStatesBucket).Get([]byte(pair))
+		if data == nil {
+			return nil
+		}
+		state = &PriceMonitorState{}
+		return json.Unmarshal(data, state)
+	})
+	return state, err
+}
+
+// SetMonitorState stores the price monitor state of the pair.
+func (s *boltStateStore) SetMonitorState(pair string, state *PriceMonitorState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(monitorStatesBucket).Put([]byte(pair), data)
+	})
+}
+
+// RecordTrade inserts or updates the trade record.
+func (s *boltStateStore) RecordTrade(record *TradeRecord) error {
+	touchTrade(record)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		previous, err := getTrade(tx, []byte(record.ID))
+		if err != nil {
+			return err
+		}
+		if err := indexTrade(tx, previous, record); err != nil {
+			return err
+		}
+		return tx.Bucket(tradesBucket).Put([]byte(record.ID), data)
+	})
+}
+
+// GetTrade returns the trade record with the given ID, or nil if it does not exist.
+func (s *boltStateStore) GetTrade(id string) (*TradeRecord, error) {
+	var record *TradeRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getTrade(tx, []byte(id))
+		return err
+	})
+	return record, err
+}
+
+// QueryTrades returns the trade records of the pair created within [from, to], oldest first.
+func (s *boltStateStore) QueryTrades(pair string, from time.Time, to time.Time) ([]*TradeRecord, error) {
+	var records []*TradeRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tradesByTimeBucket)
+		if pair != "" {
+			b = tx.Bucket(pairTradesBucket).Bucket([]byte(pair))
+		}
+		if b == nil {
+			return nil
+		}
+
+		max := timeKey(to)
+		c := b.Cursor()
+		for k, id := c.Seek(timeKey(from)); k != nil && string(k[:8]) <= string(max); k, id = c.Next() {
+			record, err := getTrade(tx, id)
+			if err != nil {
+				return err
+			}
+			if record != nil {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// OpenTrades returns the trade records of the pair whose status may still change.
+func (s *boltStateStore) OpenTrades(pair string) ([]*TradeRecord, error) {
+	var records []*TradeRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(openTradesBucket).Bucket([]byte(pair))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(id, _ []byte) error {
+			record, err := getTrade(tx, id)
+			if err != nil {
+				return err
+			}
+			if record != nil {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+// reindexTrades indexes all of the trade records, for databases created before the trades were indexed.
+func reindexTrades(tx *bolt.Tx) error {
+	return tx.Bucket(tradesBucket).ForEach(func(_, data []byte) error {
+		var record TradeRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		return indexTrade(tx, nil, &record)
+	})
+}
+
+// GetIntent returns the intent with the given ID, or nil if it does not exist.
+func (s *boltStateStore) GetIntent(id string) (*TradeIntent, error) {
+	var intent *TradeIntent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(intentsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		intent = &TradeIntent{}
+		return json.Unmarshal(data, intent)
+	})
+	return intent, err
+}
+
+// SaveIntent inserts or updates the intent.
+func (s *boltStateStore) SaveIntent(intent *TradeIntent) error {
+	touchIntent(intent)
+	data, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(intentsBucket).Put([]byte(intent.ID), data)
+	})
+}
+
+// RecordSnapshot appends the snapshot to the time series of its wallet.
+func (s *boltStateStore) RecordSnapshot(snapshot *EquitySnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(equityBucket).CreateBucketIfNotExists([]byte(strings.ToLower(snapshot.Wallet)))
+		if err != nil {
+			return err
+		}
+		return b.Put(timeKey(snapshot.Timestamp), data)
+	})
+}
+
+// QuerySnapshots returns the snapshots of the wallet taken within [from, to], oldest first.
+func (s *boltStateStore) QuerySnapshots(wallet string, from time.Time, to time.Time) ([]*EquitySnapshot, error) {
+	var snapshots []*EquitySnapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(equityBucket).Bucket([]byte(strings.ToLower(wallet)))
+		if b == nil {
+			return nil
+		}
+
+		max := timeKey(to)
+		c := b.Cursor()
+		for k, data := c.Seek(timeKey(from)); k != nil && string(k) <= string(max); k, data = c.Next() {
+			var snapshot EquitySnapshot
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				return err
+			}
+			snapshots = append(snapshots, &snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// GetToken returns the cached metadata of the token, or nil if it is not cached.
+func (s *boltStateStore) GetToken(chainId string, tokenAddress string) (*Token, error) {
+	var token *Token
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(tokensBucket).Get([]byte(chainId + ":" + strings.ToLower(tokenAddress)))
+		if data == nil {
+			return nil
+		}
+		token = &Token{}
+		return json.Unmarshal(data, token)
+	})
+	return token, err
+}
+
+// SetToken caches the metadata of the token.
+func (s *boltStateStore) SetToken(chainId string, token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).Put([]byte(chainId+":"+strings.ToLower(token.Address)), data)
+	})
+}
+
+// AcquireLock acquires the lock for the owner if it is free or expired, and reports whether it succeeded
+// together with the fencing token of the acquisition.
+func (s *boltStateStore) AcquireLock(name string, owner string, ttl time.Duration) (int64, bool, error) {
+	var token int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(locksBucket)
+		if data := b.Get([]byte(name)); data != nil {
+			var lock boltLock
+			if err := json.Unmarshal(data, &lock); err != nil {
+				return err
+			}
+			if time.Now().Before(lock.ExpiresAt) {
+				return nil
+			}
+		}
+
+		fences := tx.Bucket(fencesBucket)
+		next := int64(1)
+		if data := fences.Get([]byte(name)); data != nil {
+			next = int64(binary.BigEndian.Uint64(data)) + 1
+		}
+		fence := make([]byte, 8)
+		binary.BigEndian.PutUint64(fence, uint64(next))
+		if err := fences.Put([]byte(name), fence); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(boltLock{Owner: owner, Token: next, ExpiresAt: time.Now().Add(ttl)})
+		if err != nil {
+			return err
+		}
+		token = next
+		return b.Put([]byte(name), data)
+	})
+	return token, token > 0, err
+}
+
+// holdsLock reports whether the lock is still held by the owner under the given fencing token within the transaction.
+func holdsLock(tx *bolt.Tx, name string, owner string, token int64) (bool, error) {
+	data := tx.Bucket(locksBucket).Get([]byte(name))
+	if data == nil {
+		return false, nil
+	}
+
+	var lock boltLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return false, err
+	}
+	return lock.Owner == owner && lock.Token == token && time.Now().Before(lock.ExpiresAt), nil
+}
+
+// HoldsLock reports whether the lock is still held by the owner under the given fencing token.
+func (s *boltStateStore) HoldsLock(name string, owner string, token int64) (bool, error) {
+	holds := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		holds, err = holdsLock(tx, name, owner, token)
+		return err
+	})
+	return holds, err
+}
+
+// RenewLock extends the lock if it is still held by the owner, and reports whether it succeeded.
+func (s *boltStateStore) RenewLock(name string, owner string, ttl time.Duration) (bool, error) {
+	renewed := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(locksBucket)
+		data := b.Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+
+		var lock boltLock
+		if err := json.Unmarshal(data, &lock); err != nil {
+			return err
+		}
+		if lock.Owner != owner || time.Now().After(lock.ExpiresAt) {
+			return nil
+		}
+
+		lock.ExpiresAt = time.Now().Add(ttl)
+		data, err := json.Marshal(lock)
+		if err != nil {
+			return err
+		}
+		renewed = true
+		return b.Put([]byte(name), data)
+	})
+	return renewed, err
+}
+
+// ReleaseLock releases the lock if it is held by the owner.
+func (s *boltStateStore) ReleaseLock(name string, owner string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(locksBucket)
+		data := b.Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+
+		var lock boltLock
+		if err := json.Unmarshal(data, &lock); err != nil {
+			return err
+		}
+		if lock.Owner != owner {
+			return nil
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// Fenced returns a view of the store whose writes only succeed while the lock is held by the owner under the fencing token.
+func (s *boltStateStore) Fenced(name string, owner string, token int64) StateStore {
+	return &boltStateStore{
+		db:    s.db,
+		fence: &lockFence{name: name, owner: owner, token: token},
+	}
+}
+
+// Ping checks that the store is reachable.
+func (s *boltStateStore) Ping() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// Close releases the resources held by the store.
+func (s *boltStateStore) Close() error {
+	return s.db.Close()
+}
+
+// NewBoltStateStore opens (or creates) the bolt database file at path and returns a StateStore backed by it.
+func NewBoltStateStore(path string) (StateStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket(tradesByTimeBucket) != nil
+		for _, name := range [][]byte{lastBalancesBucket, balancesBucket, monitorStatesBucket, tradesBucket, tradesByTimeBucket, pairTradesBucket, openTradesBucket, intentsBucket, equityBucket, tokensBucket, locksBucket, fencesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if !indexed {
+			return reindexTrades(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStateStore{
+		db: db,
+	}, nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryLock is a lock held in memory.
+type memoryLock struct {
+	owner     string
+	token     int64
+	expiresAt time.Time
+}
+
+// memoryStateStore implements the StateStore interface in process memory. State is lost on exit,
+// which makes it suitable for tests and dry runs only.
+type memoryStateStore struct {
+	// mu guards all of the fields below.
+	mu sync.Mutex
+
+	lastBalances  map[string]string
+	balances      map[string][]string
+	monitorStates map[string]PriceMonitorState
+	trades        map[string]TradeRecord
+	intents       map[string]TradeIntent
+	snapshots     map[string][]EquitySnapshot
+	tokens        map[string]Token
+	locks         map[string]memoryLock
+	fences        map[string]int64
+}
+
+// GetLastBalance returns the last known balance of the token, and whether one was stored.
+func (s *memoryStateStore) GetLastBalance(symbol string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, ok := s.lastBalances[symbol]
+	return balance, ok, nil
+}
+
+// SetLastBalance stores the last known balance of the token.
+func (s *memoryStateStore) SetLastBalance(symbol string, balance string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastBalances[symbol] = balance
+	return nil
+}
+
+// PushBalance appends the balance to the balance history of the token.
+func (s *memoryStateStore) PushBalance(symbol string, balance string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.balances[symbol] = append([]string{balance}, s.balances[symbol]...)
+	return nil
+}
+
+// GetMonitorState returns the stored price monitor state of the pair, or nil if there is none.
+func (s *memoryStateStore) GetMonitorState(pair string) (*PriceMonitorState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.monitorStates[pair]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// SetMonitorState stores the price monitor state of the pair.
+func (s *memoryStateStore) SetMonitorState(pair string, state *PriceMonitorState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.monitorStates[pair] = *state
+	return nil
+}
+
+// RecordTrade inserts or updates the trade record.
+func (s *memoryStateStore) RecordTrade(record *TradeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	touchTrade(record)
+	s.trades[record.ID] = *record
+	return nil
+}
+
+// GetTrade returns the trade record with the given ID, or nil if it does not exist.
+func (s *memoryStateStore) GetTrade(id string) (*TradeRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.trades[id]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// QueryTrades returns the trade records of the pair created within [from, to], oldest first.
+func (s *memoryStateStore) QueryTrades(pair string, from time.Time, to time.Time) ([]*TradeRecord, error) {
+	return filterTrades(s.allTrades(), pair, from, to), nil
+}
+
+// OpenTrades returns the trade records of the pair whose status may still change.
+func (s *memoryStateStore) OpenTrades(pair string) ([]*TradeRecord, error) {
+	var open []*TradeRecord
+	for _, record := range s.allTrades() {
+		if record.Pair == pair && record.Status.IsOpen() {
+			open = append(open, record)
+		}
+	}
+	return open, nil
+}
+
+// allTrades returns copies of all of the trade records.
+func (s *memoryStateStore) allTrades() []*TradeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*TradeRecord, 0, len(s.trades))
+	for _, record := range s.trades {
+		r := record
+		records = append(records, &r)
+	}
+	return records
+}
+
+// GetIntent returns the intent with the given ID, or nil if it does not exist.
+func (s *memoryStateStore) GetIntent(id string) (*TradeIntent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[id]
+	if !ok {
+		return nil, nil
+	}
+	return &intent, nil
+}
+
+// SaveIntent inserts or updates the intent.
+func (s *memoryStateStore) SaveIntent(intent *TradeIntent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	touchIntent(intent)
+	s.intents[intent.ID] = *intent
+	return nil
+}
+
+// RecordSnapshot appends the snapshot to the time series of its wallet.
+func (s *memoryStateStore) RecordSnapshot(snapshot *EquitySnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wallet := strings.ToLower(snapshot.Wallet)
+	snapshots := append(s.snapshots[wallet], *snapshot)
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+	s.snapshots[wallet] = snapshots
+	return nil
+}
+
+// QuerySnapshots returns the snapshots of the wallet taken within [from, to], oldest first.
+func (s *memoryStateStore) QuerySnapshots(wallet string, from time.Time, to time.Time) ([]*EquitySnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshots []*EquitySnapshot
+	for _, snapshot := range s.snapshots[strings.ToLower(wallet)] {
+		if snapshot.Timestamp.Before(from) || snapshot.Timestamp.After(to) {
+			continue
+		}
+		sn := snapshot
+		snapshots = append(snapshots, &sn)
+	}
+	return snapshots, nil
+}
+
+// GetToken returns the cached metadata of the token, or nil if it is not cached.
+func (s *memoryStateStore) GetToken(chainId string, tokenAddress string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[chainId+":"+strings.ToLower(tokenAddress)]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+// SetToken caches the metadata of the token.
+func (s *memoryStateStore) SetToken(chainId string, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[chainId+":"+strings.ToLower(token.Address)] = *token
+	return nil
+}
+
+// AcquireLock acquires the lock for the owner if it is free or expired, and reports whether it succeeded
+// together with the fencing token of the acquisition.
+func (s *memoryStateStore) AcquireLock(name string, owner string, ttl time.Duration) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.locks[name]
+	if ok && time.Now().Before(lock.expiresAt) {
+		return 0, false, nil
+	}
+
+	s.fences[name]++
+	s.locks[name] = memoryLock{owner: owner, token: s.fences[name], expiresAt: time.Now().Add(ttl)}
+	return s.fences[name], true, nil
+}
+
+// HoldsLock reports whether the lock is still held by the owner under the given fencing token.
+func (s *memoryStateStore) HoldsLock(name string, owner string, token int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.holdsLock(name, owner, token), nil
+}
+
+// holdsLock reports whether the lock is still held by the owner under the given fencing token. The caller holds mu.
+func (s *memoryStateStore) holdsLock(name string, owner string, token int64) bool {
+	lock, ok := s.locks[name]
+	return ok && lock.owner == owner && lock.token == token && time.Now().Before(lock.expiresAt)
+}
+
+// RenewLock extends the lock if it is still held by the owner, and reports whether it succeeded.
+func (s *memoryStateStore) RenewLock(name string, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.locks[name]
+	if !ok || lock.owner != owner || time.Now().After(lock.expiresAt) {
+		return false, nil
+	}
+
+	lock.expiresAt = time.Now().Add(ttl)
+	s.locks[name] = lock
+	return true, nil
+}
+
+// ReleaseLock releases the lock if it is held by the owner.
+func (s *memoryStateStore) ReleaseLock(name string, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lock, ok := s.locks[name]; ok && lock.owner == owner {
+		delete(s.locks, name)
+	}
+	return nil
+}
+
+// Fenced returns a view of the store whose writes only succeed while the lock is held by the owner under the fencing token.
+func (s *memoryStateStore) Fenced(name string, owner string, token int64) StateStore {
+	return &fencedMemoryStateStore{
+		memoryStateStore: s,
+		fence:            lockFence{name: name, owner: owner, token: token},
+	}
+}
+
+// Ping checks that the store is reachable.
+func (s *memoryStateStore) Ping() error {
+	return nil
+}
+
+// Close releases the resources held by the store.
+func (s *memoryStateStore) Close() error {
+	return nil
+}
+
+// fencedMemoryStateStore is a view of a memory store whose writes only succeed while its lock is held under the fencing token.
+type fencedMemoryStateStore struct {
+	*memoryStateStore
+
+	// fence is the lock acquisition the writes are conditional on.
+	fence lockFence
+}
+
+// write applies the write while holding mu, if the lock is still held under the fencing token.
+func (s *fencedMemoryStateStore) write(fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.holdsLock(s.fence.name, s.fence.owner, s.fence.token) {
+		return ErrFenced
+	}
+	fn()
+	return nil
+}
+
+// SetLastBalance stores the last known balance of the token.
+func (s *fencedMemoryStateStore) SetLastBalance(symbol string, balance string) error {
+	return s.write(func() {
+		s.lastBalances[symbol] = balance
+	})
+}
+
+// PushBalance appends the balance to the balance history of the token.
+func (s *fencedMemoryStateStore) PushBalance(symbol string, balance string) error {
+	return s.write(func() {
+		s.balances[symbol] = append([]string{balance}, s.balances[symbol]...)
+	})
+}
+
+// SetMonitorState stores the price monitor state of the pair.
+func (s *fencedMemoryStateStore) SetMonitorState(pair string, state *PriceMonitorState) error {
+	return s.write(func() {
+		s.monitorStates[pair] = *state
+	})
+}
+
+// RecordTrade inserts or updates the trade record.
+func (s *fencedMemoryStateStore) RecordTrade(record *TradeRecord) error {
+	return s.write(func() {
+		touchTrade(record)
+		s.trades[record.ID] = *record
+	})
+}
+
+// SaveIntent inserts or updates the intent.
+func (s *fencedMemoryStateStore) SaveIntent(intent *TradeIntent) error {
+	return s.write(func() {
+		touchIntent(intent)
+		s.intents[intent.ID] = *intent
+	})
+}
+
+// NewMemoryStateStore creates a new, empty StateStore held in memory.
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{
+		lastBalances:  make(map[string]string),
+		balances:      make(map[string][]string),
+		monitorStates: make(map[string]PriceMonitorState),
+		trades:        make(map[string]TradeRecord),
+		intents:       make(map[string]TradeIntent),
+		snapshots:     make(map[string][]EquitySnapshot),
+		tokens:        make(map[string]Token),
+		locks:         make(map[string]memoryLock),
+		fences:        make(map[string]int64),
+	}
+}
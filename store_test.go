@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// stateStoreBackend creates an empty state store and advances its clock past lock expiries.
+type stateStoreBackend struct {
+	name string
+	open func(t *testing.T) (StateStore, func(d time.Duration))
+}
+
+var stateStoreBackends = []stateStoreBackend{
+	{name: "memory", open: func(t *testing.T) (StateStore, func(d time.Duration)) {
+		return NewMemoryStateStore(), time.Sleep
+	}},
+	{name: "bolt", open: func(t *testing.T) (StateStore, func(d time.Duration)) {
+		s, err := NewBoltStateStore(filepath.Join(t.TempDir(), "state.db"))
+		if err != nil {
+			t.Fatalf("NewBoltStateStore: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s, time.Sleep
+	}},
+	{name: "redis", open: func(t *testing.T) (StateStore, func(d time.Duration)) {
+		m := miniredis.RunT(t)
+		s := NewRedisStateStore(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+		t.Cleanup(func() { s.Close() })
+		return s, m.FastForward
+	}},
+}
+
+// tradeIDs returns the IDs of the trade records in order.
+func tradeIDs(records []*TradeRecord) []string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	return ids
+}
+
+// equalIDs reports whether both ID lists hold the same IDs, in order unless ordered is false.
+func equalIDs(got []string, want []string, ordered bool) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	if ordered {
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+	seen := make(map[string]int, len(got))
+	for _, id := range got {
+		seen[id]++
+	}
+	for _, id := range want {
+		if seen[id]--; seen[id] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStateStoreLocks(t *testing.T) {
+	for _, backend := range stateStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			s, expire := backend.open(t)
+			ttl := 200 * time.Millisecond
+
+			first, ok, err := s.AcquireLock("WBTC/USDC", "a", ttl)
+			if err != nil || !ok {
+				t.Fatalf("AcquireLock = %d, %t, %v, want the free lock", first, ok, err)
+			}
+			if _, ok, err := s.AcquireLock("WBTC/USDC", "b", ttl); err != nil || ok {
+				t.Fatalf("AcquireLock of a held lock = %t, %v, want false", ok, err)
+			}
+			if held, err := s.HoldsLock("WBTC/USDC", "a", first); err != nil || !held {
+				t.Errorf("HoldsLock by the owner = %t, %v, want true", held, err)
+			}
+			if held, err := s.HoldsLock("WBTC/USDC", "b", first); err != nil || held {
+				t.Errorf("HoldsLock by another owner = %t, %v, want false", held, err)
+			}
+			if renewed, err := s.RenewLock("WBTC/USDC", "b", ttl); err != nil || renewed {
+				t.Errorf("RenewLock by another owner = %t, %v, want false", renewed, err)
+			}
+			if renewed, err := s.RenewLock("WBTC/USDC", "a", ttl); err != nil || !renewed {
+				t.Errorf("RenewLock by the owner = %t, %v, want true", renewed, err)
+			}
+
+			// Another owner takes over an expired lock under a greater fencing token, which fences off the first owner.
+			expire(ttl + 50*time.Millisecond)
+			second, ok, err := s.AcquireLock("WBTC/USDC", "b", ttl)
+			if err != nil || !ok {
+				t.Fatalf("AcquireLock of an expired lock = %t, %v, want true", ok, err)
+			}
+			if second <= first {
+				t.Errorf("fencing token %d after %d, want it to increase", second, first)
+			}
+			if held, err := s.HoldsLock("WBTC/USDC", "a", first); err != nil || held {
+				t.Errorf("HoldsLock by the expired owner = %t, %v, want false", held, err)
+			}
+			if renewed, err := s.RenewLock("WBTC/USDC", "a", ttl); err != nil || renewed {
+				t.Errorf("RenewLock by the expired owner = %t, %v, want false", renewed, err)
+			}
+
+			// Releasing requires ownership, and a released lock is acquired under a greater fencing token again.
+			if err := s.ReleaseLock("WBTC/USDC", "a"); err != nil {
+				t.Fatalf("ReleaseLock: %v", err)
+			}
+			if held, err := s.HoldsLock("WBTC/USDC", "b", second); err != nil || !held {
+				t.Errorf("HoldsLock after a release by another owner = %t, %v, want true", held, err)
+			}
+			if err := s.ReleaseLock("WBTC/USDC", "b"); err != nil {
+				t.Fatalf("ReleaseLock: %v", err)
+			}
+			third, ok, err := s.AcquireLock("WBTC/USDC", "a", ttl)
+			if err != nil || !ok || third <= second {
+				t.Errorf("AcquireLock after release = %d, %t, %v, want a token greater than %d", third, ok, err, second)
+			}
+
+			// Locks are independent of each other.
+			if _, ok, err := s.AcquireLock("WETH/USDC", "b", ttl); err != nil || !ok {
+				t.Errorf("AcquireLock of another lock = %t, %v, want true", ok, err)
+			}
+		})
+	}
+}
+
+func TestStateStoreTrades(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Millisecond)
+
+	for _, backend := range stateStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			s, _ := backend.open(t)
+
+			for i, record := range []*TradeRecord{
+				{ID: "btc-1", Pair: "WBTC/USDC", Status: TradeFilled},
+				{ID: "eth-1", Pair: "WETH/USDC", Status: TradeSubmitted},
+				{ID: "btc-2", Pair: "WBTC/USDC", Status: TradeSubmitted},
+				{ID: "btc-3", Pair: "WBTC/USDC", Status: TradePending},
+				{ID: "eth-2", Pair: "WETH/USDC", Status: TradeExpired},
+			} {
+				record.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+				if err := s.RecordTrade(record); err != nil {
+					t.Fatalf("RecordTrade: %v", err)
+				}
+			}
+
+			tests := []struct {
+				name string
+				pair string
+				from time.Time
+				to   time.Time
+				want []string
+			}{
+				{name: "all of the pair", pair: "WBTC/USDC", from: start, to: start.Add(24 * time.Hour), want: []string{"btc-1", "btc-2", "btc-3"}},
+				{name: "inclusive bounds", pair: "WBTC/USDC", from: start.Add(2 * time.Hour), to: start.Add(3 * time.Hour), want: []string{"btc-2", "btc-3"}},
+				{name: "within the window", pair: "WBTC/USDC", from: start.Add(time.Minute), to: start.Add(150 * time.Minute), want: []string{"btc-2"}},
+				{name: "empty window", pair: "WBTC/USDC", from: start.Add(5 * time.Hour), to: start.Add(6 * time.Hour)},
+				{name: "all pairs", from: start.Add(time.Hour), to: start.Add(4 * time.Hour), want: []string{"eth-1", "btc-2", "btc-3", "eth-2"}},
+				{name: "unknown pair", pair: "LINK/USDC", from: start, to: start.Add(24 * time.Hour)},
+			}
+			for _, tt := range tests {
+				records, err := s.QueryTrades(tt.pair, tt.from, tt.to)
+				if err != nil {
+					t.Fatalf("%s: QueryTrades: %v", tt.name, err)
+				}
+				if got := tradeIDs(records); !equalIDs(got, tt.want, true) {
+					t.Errorf("%s: QueryTrades = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+
+			open, err := s.OpenTrades("WBTC/USDC")
+			if err != nil {
+				t.Fatalf("OpenTrades: %v", err)
+			}
+			if got := tradeIDs(open); !equalIDs(got, []string{"btc-2", "btc-3"}, false) {
+				t.Errorf("OpenTrades = %v, want btc-2 and btc-3", got)
+			}
+
+			// An update keeps the creation time and moves a settled trade out of the open trades.
+			record, err := s.GetTrade("btc-2")
+			if err != nil || record == nil {
+				t.Fatalf("GetTrade = %v, %v", record, err)
+			}
+			record.Status = TradeFilled
+			if err := s.RecordTrade(record); err != nil {
+				t.Fatalf("RecordTrade: %v", err)
+			}
+			if record, err := s.GetTrade("btc-2"); err != nil || record.Status != TradeFilled || !record.CreatedAt.Equal(start.Add(2*time.Hour)) {
+				t.Errorf("GetTrade after the update = %+v, %v", record, err)
+			}
+			open, err = s.OpenTrades("WBTC/USDC")
+			if err != nil {
+				t.Fatalf("OpenTrades: %v", err)
+			}
+			if got := tradeIDs(open); !equalIDs(got, []string{"btc-3"}, false) {
+				t.Errorf("OpenTrades after the fill = %v, want btc-3", got)
+			}
+			records, err := s.QueryTrades("WBTC/USDC", start, start.Add(24*time.Hour))
+			if err != nil {
+				t.Fatalf("QueryTrades: %v", err)
+			}
+			if got := tradeIDs(records); !equalIDs(got, []string{"btc-1", "btc-2", "btc-3"}, true) {
+				t.Errorf("QueryTrades after the update = %v, want each trade once", got)
+			}
+
+			if record, err := s.GetTrade("missing"); err != nil || record != nil {
+				t.Errorf("GetTrade of a missing trade = %+v, %v, want nil", record, err)
+			}
+		})
+	}
+}
+
+func TestStateStoreIntents(t *testing.T) {
+	for _, backend := range stateStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			s, _ := backend.open(t)
+
+			if intent, err := s.GetIntent("missing"); err != nil || intent != nil {
+				t.Errorf("GetIntent of a missing intent = %+v, %v, want nil", intent, err)
+			}
+
+			intent := &TradeIntent{ID: "intent-1", Pair: "WBTC/USDC", FromTokenAmount: "100", Generation: 3, Status: IntentPending}
+			if err := s.SaveIntent(intent); err != nil {
+				t.Fatalf("SaveIntent: %v", err)
+			}
+			intent.OrderHash, intent.Status, intent.Attempts = "0xabc", IntentSubmitted, 1
+			if err := s.SaveIntent(intent); err != nil {
+				t.Fatalf("SaveIntent: %v", err)
+			}
+
+			got, err := s.GetIntent("intent-1")
+			if err != nil || got == nil {
+				t.Fatalf("GetIntent = %+v, %v", got, err)
+			}
+			if got.OrderHash != "0xabc" || got.Status != IntentSubmitted || got.Attempts != 1 || got.Generation != 3 {
+				t.Errorf("GetIntent = %+v, want the updated intent", got)
+			}
+			if got.CreatedAt.IsZero() || got.UpdatedAt.Before(got.CreatedAt) {
+				t.Errorf("created at %s, updated at %s", got.CreatedAt, got.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestStateStoreSnapshots(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Millisecond)
+
+	for _, backend := range stateStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			s, _ := backend.open(t)
+
+			for i := range 4 {
+				snapshot := &EquitySnapshot{Wallet: testAddress, Timestamp: start.Add(time.Duration(i) * time.Hour), TotalValue: float64(i + 1)}
+				if err := s.RecordSnapshot(snapshot); err != nil {
+					t.Fatalf("RecordSnapshot: %v", err)
+				}
+			}
+			if err := s.RecordSnapshot(&EquitySnapshot{Wallet: otherAddress, Timestamp: start.Add(time.Hour), TotalValue: 100}); err != nil {
+				t.Fatalf("RecordSnapshot: %v", err)
+			}
+
+			tests := []struct {
+				name   string
+				wallet string
+				from   time.Time
+				to     time.Time
+				want   []float64
+			}{
+				{name: "all", wallet: testAddress, from: start, to: start.Add(24 * time.Hour), want: []float64{1, 2, 3, 4}},
+				{name: "inclusive bounds", wallet: testAddress, from: start.Add(time.Hour), to: start.Add(2 * time.Hour), want: []float64{2, 3}},
+				{name: "case insensitive wallet", wallet: strings.ToLower(otherAddress), from: start, to: start.Add(24 * time.Hour), want: []float64{100}},
+				{name: "empty window", wallet: testAddress, from: start.Add(5 * time.Hour), to: start.Add(6 * time.Hour)},
+			}
+			for _, tt := range tests {
+				snapshots, err := s.QuerySnapshots(tt.wallet, tt.from, tt.to)
+				if err != nil {
+					t.Fatalf("%s: QuerySnapshots: %v", tt.name, err)
+				}
+				got := make([]float64, len(snapshots))
+				for i, snapshot := range snapshots {
+					got[i] = snapshot.TotalValue
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("%s: QuerySnapshots = %v, want %v", tt.name, got, tt.want)
+					continue
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("%s: QuerySnapshots = %v, want %v", tt.name, got, tt.want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStateStoreFencedWrites(t *testing.T) {
+	for _, backend := range stateStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			s, expire := backend.open(t)
+			ttl := 200 * time.Millisecond
+
+			first, _, err := s.AcquireLock("WBTC/USDC", "a", ttl)
+			if err != nil {
+				t.Fatalf("AcquireLock: %v", err)
+			}
+			fenced := s.Fenced("WBTC/USDC", "a", first)
+			if err := fenced.RecordTrade(&TradeRecord{ID: "trade-1", Pair: "WBTC/USDC", Status: TradePending}); err != nil {
+				t.Fatalf("RecordTrade under the lock: %v", err)
+			}
+			if err := fenced.SaveIntent(&TradeIntent{ID: "intent-1", Status: IntentPending}); err != nil {
+				t.Fatalf("SaveIntent under the lock: %v", err)
+			}
+
+			// Once another owner took over the expired lock, every fenced write fails and leaves the state untouched.
+			expire(ttl + 50*time.Millisecond)
+			if _, ok, err := s.AcquireLock("WBTC/USDC", "b", ttl); err != nil || !ok {
+				t.Fatalf("AcquireLock of the expired lock = %t, %v", ok, err)
+			}
+			writes := map[string]func() error{
+				"SetLastBalance":  func() error { return fenced.SetLastBalance("WBTC", "1") },
+				"PushBalance":     func() error { return fenced.PushBalance("WBTC", "1") },
+				"SetMonitorState": func() error { return fenced.SetMonitorState("WBTC/USDC", &PriceMonitorState{}) },
+				"RecordTrade": func() error {
+					return fenced.RecordTrade(&TradeRecord{ID: "trade-1", Pair: "WBTC/USDC", Status: TradeSubmitted})
+				},
+				"SaveIntent": func() error { return fenced.SaveIntent(&TradeIntent{ID: "intent-1", Status: IntentSubmitted}) },
+			}
+			for name, write := range writes {
+				if err := write(); !errors.Is(err, ErrFenced) {
+					t.Errorf("%s after the takeover = %v, want ErrFenced", name, err)
+				}
+			}
+
+			if _, ok, err := s.GetLastBalance("WBTC"); err != nil || ok {
+				t.Errorf("GetLastBalance = %t, %v, want no balance", ok, err)
+			}
+			if state, err := s.GetMonitorState("WBTC/USDC"); err != nil || state != nil {
+				t.Errorf("GetMonitorState = %+v, %v, want no state", state, err)
+			}
+			if record, err := s.GetTrade("trade-1"); err != nil || record.Status != TradePending {
+				t.Errorf("GetTrade = %+v, %v, want the pending trade", record, err)
+			}
+			if intent, err := s.GetIntent("intent-1"); err != nil || intent.Status != IntentPending {
+				t.Errorf("GetIntent = %+v, %v, want the pending intent", intent, err)
+			}
+
+			// Reads go through to the store.
+			if record, err := fenced.GetTrade("trade-1"); err != nil || record == nil {
+				t.Errorf("GetTrade through the fenced store = %+v, %v", record, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// Token holds the metadata of an ERC-20 token.
+type Token struct {
+	// Address is the contract address of the token.
+	Address string `json:"address"`
+
+	// Symbol is the ticker symbol of the token (e.g., "WBTC").
+	Symbol string `json:"symbol"`
+
+	// Name is the full name of the token (e.g., "Wrapped BTC").
+	Name string `json:"name"`
+
+	// Decimals is the number of decimals used by the token amounts.
+	Decimals int `json:"decimals"`
+}
+
+// ExpectedToken holds the user-configured metadata of a token. Empty symbol and name and nil decimals are not verified.
+type ExpectedToken struct {
+	// Address is the contract address of the token.
+	Address string
+
+	// Symbol is the expected ticker symbol of the token.
+	Symbol string
+
+	// Name is the expected full name of the token.
+	Name string
+
+	// Decimals is the expected number of decimals, nil when not configured.
+	Decimals *int
+}
+
+// TokenMetadataSource discovers the metadata of a token.
+type TokenMetadataSource interface {
+	// TokenMetadata returns the metadata of the token at the given address.
+	TokenMetadata(tokenAddress string) (*Token, error)
+
+	// Name returns a short human readable name of the source, used in logs.
+	Name() string
+}
+
+// rpcTokenMetadataSource implements the TokenMetadataSource interface by calling symbol(), name() and decimals() on-chain.
+type rpcTokenMetadataSource struct {
+	// client is the Ethereum JSON-RPC client used to call the token contract.
+	client EthereumClient
+}
+
+// TokenMetadata returns the metadata of the token at the given address.
+func (s *rpcTokenMetadataSource) TokenMetadata(tokenAddress string) (*Token, error) {
+	symbol, err := callContract(context.TODO(), s.client, erc20ABI, tokenAddress, "symbol")
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := callContract(context.TODO(), s.client, erc20ABI, tokenAddress, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := callContract(context.TODO(), s.client, erc20ABI, tokenAddress, "decimals")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Address:  tokenAddress,
+		Symbol:   symbol[0].(string),
+		Name:     name[0].(string),
+		Decimals: int(decimals[0].(uint8)),
+	}, nil
+}
+
+// Name returns a short human readable name of the source, used in logs.
+func (s *rpcTokenMetadataSource) Name() string {
+	return "rpc"
+}
+
+// NewRPCTokenMetadataSource creates a new TokenMetadataSource that reads token metadata on-chain.
+func NewRPCTokenMetadataSource(client EthereumClient) TokenMetadataSource {
+	return &rpcTokenMetadataSource{
+		client: client,
+	}
+}
+
+// DefaultTokenListTTL is how long the 1inch token list is reused before it is fetched again.
+const DefaultTokenListTTL = time.Hour
+
+// oneInchTokenMetadataSource implements the TokenMetadataSource interface on top of the 1inch token list.
+type oneInchTokenMetadataSource struct {
+	// router is the 1inch router used to fetch the token list.
+	router OneInchRouter
+
+	// ttl is how long a fetched token list is reused.
+	ttl time.Duration
+
+	// mu guards tokens and fetchedAt.
+	mu sync.Mutex
+
+	// tokens is the last fetched token list.
+	tokens TokenListResponse
+
+	// fetchedAt is when tokens was fetched.
+	fetchedAt time.Time
+}
+
+// tokenList returns the token list, fetching it again once the cached one is older than the TTL.
+func (s *oneInchTokenMetadataSource) tokenList() (TokenListResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens != nil && time.Since(s.fetchedAt) < s.ttl {
+		return s.tokens, nil
+	}
+
+	tokens, err := s.router.GetTokenList()
+	if err != nil {
+		return nil, err
+	}
+	s.tokens = tokens
+	s.fetchedAt = time.Now()
+	return tokens, nil
+}
+
+// TokenMetadata returns the metadata of the token at the given address.
+func (s *oneInchTokenMetadataSource) TokenMetadata(tokenAddress string) (*Token, error) {
+	tokens, err := s.tokenList()
+	if err != nil {
+		return nil, err
+	}
+
+	for address, token := range tokens {
+		if strings.EqualFold(address, tokenAddress) {
+			return &Token{
+				Address:  tokenAddress,
+				Symbol:   token.Symbol,
+				Name:     token.Name,
+				Decimals: token.Decimals,
+			}, nil
+		}
+	}
+
+	return nil, errors.New("token " + tokenAddress + " not found in the 1inch token list")
+}
+
+// Name returns a short human readable name of the source, used in logs.
+func (s *oneInchTokenMetadataSource) Name() string {
+	return "1inch"
+}
+
+// NewOneInchTokenMetadataSource creates a new TokenMetadataSource backed by the 1inch token list, reused for the TTL.
+func NewOneInchTokenMetadataSource(router OneInchRouter, ttl time.Duration) TokenMetadataSource {
+	return &oneInchTokenMetadataSource{
+		router: router,
+		ttl:    ttl,
+	}
+}
+
+// TokenCache persists discovered token metadata.
+type TokenCache interface {
+	// GetToken returns the cached metadata of the token, or nil if it is not cached.
+	GetToken(chainId string, tokenAddress string) (*Token, error)
+
+	// SetToken caches the metadata of the token.
+	SetToken(chainId string, token *Token) error
+}
+
+// redisTokenCache implements the TokenCache interface with one Redis hash per token.
+type redisTokenCache struct {
+	// rdb is the Redis client.
+	rdb *redis.Client
+}
+
+// tokenKey returns the Redis key holding the metadata of the token.
+func tokenKey(chainId string, tokenAddress string) string {
+	return fmt.Sprintf("TOKEN:%s:%s", chainId, strings.ToLower(tokenAddress))
+}
+
+// GetToken returns the cached metadata of the token, or nil if it is not cached.
+func (c *redisTokenCache) GetToken(chainId string, tokenAddress string) (*Token, error) {
+	fields, err := c.rdb.HGetAll(context.TODO(), tokenKey(chainId, tokenAddress)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	decimals, err := strconv.Atoi(fields["decimals"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Address:  fields["address"],
+		Symbol:   fields["symbol"],
+		Name:     fields["name"],
+		Decimals: decimals,
+	}, nil
+}
+
+// SetToken caches the metadata of the token.
+func (c *redisTokenCache) SetToken(chainId string, token *Token) error {
+	return c.rdb.HSet(context.TODO(), tokenKey(chainId, token.Address),
+		"address", token.Address,
+		"symbol", token.Symbol,
+		"name", token.Name,
+		"decimals", token.Decimals,
+	).Err()
+}
+
+// NewRedisTokenCache creates a new TokenCache backed by Redis.
+func NewRedisTokenCache(rdb *redis.Client) TokenCache {
+	return &redisTokenCache{
+		rdb: rdb,
+	}
+}
+
+// TokenRegistry resolves and verifies token metadata.
+type TokenRegistry interface {
+	// Resolve returns the metadata of the token, from the cache if available, otherwise discovered from the sources.
+	Resolve(tokenAddress string) (*Token, error)
+
+	// Verify resolves the token at the expected address and checks that the configured expected fields match the discovered ones.
+	Verify(expected ExpectedToken) (*Token, error)
+}
+
+// tokenRegistry implements the TokenRegistry interface.
+type tokenRegistry struct {
+	// chainId is the blockchain network ID the tokens live on.
+	chainId string
+
+	// cache persists discovered token metadata.
+	cache TokenCache
+
+	// sources are queried in order until one of them returns the token metadata.
+	sources []TokenMetadataSource
+}
+
+// Resolve returns the metadata of the token, from the cache if available, otherwise discovered from the sources.
+func (tr *tokenRegistry) Resolve(tokenAddress string) (*Token, error) {
+	token, err := tr.cache.GetToken(tr.chainId, tokenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != nil {
+		return token, nil
+	}
+
+	var errs []error
+	for _, source := range tr.sources {
+		token, err = source.TokenMetadata(tokenAddress)
+		if err != nil {
+			log.Warnf("Error occurred while discovering token %s from %s source: %v", tokenAddress, source.Name(), err)
+			errs = append(errs, err)
+			continue
+		}
+
+		log.Debugf("Discovered token %s (%s, %d decimals) from %s source", token.Symbol, token.Address, token.Decimals, source.Name())
+		if err := tr.cache.SetToken(tr.chainId, token); err != nil {
+			return nil, err
+		}
+		return token, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no token metadata sources configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Verify resolves the token at the expected address and checks that the configured expected fields match the discovered ones.
+func (tr *tokenRegistry) Verify(expected ExpectedToken) (*Token, error) {
+	token, err := tr.Resolve(expected.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if expected.Symbol != "" && !strings.EqualFold(expected.Symbol, token.Symbol) {
+		return nil, fmt.Errorf("token %s symbol mismatch: configured %s, discovered %s", expected.Address, expected.Symbol, token.Symbol)
+	}
+
+	if expected.Name != "" && expected.Name != token.Name {
+		return nil, fmt.Errorf("token %s name mismatch: configured %s, discovered %s", expected.Address, expected.Name, token.Name)
+	}
+
+	if expected.Decimals != nil && *expected.Decimals != token.Decimals {
+		return nil, fmt.Errorf("token %s decimals mismatch: configured %d, discovered %d", expected.Address, *expected.Decimals, token.Decimals)
+	}
+
+	return token, nil
+}
+
+// NewTokenRegistry creates a new TokenRegistry for the chain that caches token metadata discovered from the sources.
+func NewTokenRegistry(chainId string, cache TokenCache, sources ...TokenMetadataSource) TokenRegistry {
+	return &tokenRegistry{
+		chainId: chainId,
+		cache:   cache,
+		sources: sources,
+	}
+}
+
+// VerifyConfiguredToken verifies the user-provided token metadata against the registry and returns the discovered metadata.
+// Empty symbol, name and decimals values are not verified.
+func VerifyConfiguredToken(tr TokenRegistry, address string, symbol string, name string, decimals string) (*Token, error) {
+	if address == "" {
+		return nil, errors.New("token address is required")
+	}
+
+	expected := ExpectedToken{
+		Address: address,
+		Symbol:  symbol,
+		Name:    name,
+	}
+
+	if decimals != "" {
+		d, err := strconv.Atoi(decimals)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decimals %s for token %s: %v", decimals, address, err)
+		}
+		expected.Decimals = &d
+	}
+
+	return tr.Verify(expected)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenListRouter serves a fixed 1inch token list and counts how often it is fetched.
+type tokenListRouter struct {
+	OneInchRouter
+
+	tokens  TokenListResponse
+	fetches int
+	err     error
+}
+
+func (r *tokenListRouter) GetTokenList() (TokenListResponse, error) {
+	r.fetches++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.tokens, nil
+}
+
+func newTokenListRouter() *tokenListRouter {
+	tokens := make(TokenListResponse)
+	for _, token := range []Token{
+		{Address: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599", Symbol: "WBTC", Name: "Wrapped BTC", Decimals: 8},
+		{Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Symbol: "USDC", Name: "USD Coin", Decimals: 6},
+		{Address: "0x00000000000000000000000000000000000000d4", Symbol: "ZERO", Name: "Zero Decimals", Decimals: 0},
+	} {
+		entry := tokens[strings.ToLower(token.Address)]
+		entry.Address, entry.Symbol, entry.Name, entry.Decimals = token.Address, token.Symbol, token.Name, token.Decimals
+		tokens[strings.ToLower(token.Address)] = entry
+	}
+	return &tokenListRouter{tokens: tokens}
+}
+
+func TestOneInchTokenMetadataSourceCachesTokenList(t *testing.T) {
+	r := newTokenListRouter()
+	source := NewOneInchTokenMetadataSource(r, time.Hour).(*oneInchTokenMetadataSource)
+
+	for _, address := range []string{"0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599", "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"} {
+		if _, err := source.TokenMetadata(address); err != nil {
+			t.Fatalf("TokenMetadata(%s): %v", address, err)
+		}
+	}
+	if _, err := source.TokenMetadata("0x00000000000000000000000000000000000000e5"); err == nil {
+		t.Error("unknown token resolved")
+	}
+	if r.fetches != 1 {
+		t.Errorf("fetched the token list %d times within the TTL, want 1", r.fetches)
+	}
+
+	// An expired list is fetched again.
+	source.fetchedAt = time.Now().Add(-2 * time.Hour)
+	if _, err := source.TokenMetadata("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"); err != nil {
+		t.Fatalf("TokenMetadata: %v", err)
+	}
+	if r.fetches != 2 {
+		t.Errorf("fetched the token list %d times after the TTL, want 2", r.fetches)
+	}
+
+	// A failed fetch is not cached.
+	source.fetchedAt = time.Time{}
+	r.err = errors.New("unavailable")
+	if _, err := source.TokenMetadata("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"); !errors.Is(err, r.err) {
+		t.Errorf("TokenMetadata = %v, want %v", err, r.err)
+	}
+	r.err = nil
+	if _, err := source.TokenMetadata("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"); err != nil || r.fetches != 4 {
+		t.Errorf("TokenMetadata after a failed fetch = %v with %d fetches, want a fresh fetch", err, r.fetches)
+	}
+}
+
+func TestVerifyConfiguredToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		symbol    string
+		tokenName string
+		decimals  string
+		wantErr   bool
+	}{
+		{name: "address only", address: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"},
+		{name: "all fields", address: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599", symbol: "wbtc", tokenName: "Wrapped BTC", decimals: "8"},
+		{name: "symbol mismatch", address: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599", symbol: "WETH", wantErr: true},
+		{name: "name mismatch", address: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599", tokenName: "Bitcoin", wantErr: true},
+		{name: "decimals mismatch", address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", decimals: "18", wantErr: true},
+		{name: "zero decimals verified", address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", decimals: "0", wantErr: true},
+		{name: "zero decimals match", address: "0x00000000000000000000000000000000000000d4", decimals: "0"},
+		{name: "invalid decimals", address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", decimals: "six", wantErr: true},
+		{name: "missing address", wantErr: true},
+		{name: "unknown token", address: "0x00000000000000000000000000000000000000e5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTokenRegistry("1", NewMemoryStateStore(), NewOneInchTokenMetadataSource(newTokenListRouter(), time.Hour))
+
+			token, err := VerifyConfiguredToken(tr, tt.address, tt.symbol, tt.tokenName, tt.decimals)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("verified %+v, want an error", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyConfiguredToken: %v", err)
+			}
+			if !strings.EqualFold(token.Address, tt.address) {
+				t.Errorf("verified %s, want %s", token.Address, tt.address)
+			}
+		})
+	}
+}
+
+func TestTokenRegistryResolveUsesCache(t *testing.T) {
+	r := newTokenListRouter()
+	cache := NewMemoryStateStore()
+	tr := NewTokenRegistry("1", cache, NewOneInchTokenMetadataSource(r, 0))
+
+	for range 2 {
+		token, err := tr.Resolve("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599")
+		if err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		if token.Symbol != "WBTC" || token.Decimals != 8 {
+			t.Errorf("resolved %+v", token)
+		}
+	}
+	if r.fetches != 1 {
+		t.Errorf("fetched the token list %d times, want 1 with the token cached", r.fetches)
+	}
+
+	if _, err := NewTokenRegistry("1", cache).Resolve("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"); err == nil {
+		t.Error("resolved an uncached token without sources")
+	}
+}
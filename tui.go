@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tuiRefreshInterval is how often the dashboard reloads its data from the state store.
+const tuiRefreshInterval = 5 * time.Second
+
+// tuiCancelTimeout bounds how long the dashboard waits for a cancellation to be sent and mined.
+const tuiCancelTimeout = 5 * time.Minute
+
+// sparklineRunes are the bar glyphs of a sparkline, from lowest to highest.
+var sparklineRunes = []rune("▁▂▃▄▅▆▇█")
+
+var (
+	tuiTitleStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	tuiLabelStyle   = lipgloss.NewStyle().Width(12).Foreground(lipgloss.Color("8"))
+	tuiHeaderStyle  = lipgloss.NewStyle().Bold(true).Underline(true)
+	tuiSelectStyle  = lipgloss.NewStyle().Reverse(true)
+	tuiPausedStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+	tuiRunningStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	tuiErrorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	tuiHelpStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+)
+
+// sparkline renders the values as a line of bar glyphs scaled between their minimum and maximum.
+// Only the most recent width values are rendered.
+func sparkline(values []float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	if len(values) == 0 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		i := len(sparklineRunes) / 2
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(sparklineRunes)-1))
+		}
+		sb.WriteRune(sparklineRunes[i])
+	}
+	return sb.String()
+}
+
+// triggerBand renders the position of the price between the lower and upper trigger prices.
+func triggerBand(price float64, down float64, up float64, width int) string {
+	if up <= down || down <= 0 || up > 1e9 {
+		return strings.Repeat("·", width)
+	}
+	pos := int((price - down) / (up - down) * float64(width-1))
+	pos = max(0, min(width-1, pos))
+	return strings.Repeat("─", pos) + "●" + strings.Repeat("─", width-1-pos)
+}
+
+// adminClient calls the admin API of a running bot.
+type adminClient struct {
+	// baseUrl is the base URL of the admin API (e.g., "http://127.0.0.1:8081").
+	baseUrl string
+
+	// token is the bearer token of the admin API.
+	token string
+
+	// client is the HTTP client used for all requests.
+	client *http.Client
+}
+
+// do sends a request to the admin API path and decodes the JSON response into v, if not nil.
+func (c *adminClient) do(method string, path string, v any) error {
+	req, err := http.NewRequest(method, c.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("admin request failed, status code: %s", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// PairStatus returns the status of the pair.
+func (c *adminClient) PairStatus(pair string) (*PairStatus, error) {
+	var status PairStatus
+	if err := c.do("GET", "/admin/pairs/"+pair, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Pause pauses trading for the pair.
+func (c *adminClient) Pause(pair string) error {
+	return c.do("POST", "/admin/pairs/"+pair+"/pause", nil)
+}
+
+// Resume resumes trading for the pair.
+func (c *adminClient) Resume(pair string) error {
+	return c.do("POST", "/admin/pairs/"+pair+"/resume", nil)
+}
+
+// NewAdminClient creates a new client for the admin API at the address (e.g., "127.0.0.1:8081").
+func NewAdminClient(address string, token string) *adminClient {
+	return &adminClient{
+		baseUrl: "http://" + address,
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// dashboardData is the data of a pair rendered by the dashboard.
+type dashboardData struct {
+	pair       string
+	state      *PriceMonitorState
+	snapshots  []*EquitySnapshot
+	pnl        *PnLReport
+	trades     []*TradeRecord
+	openOrders []*TradeRecord
+	status     *PairStatus
+	err        error
+}
+
+// dashboardTickMsg triggers a reload of the dashboard data.
+type dashboardTickMsg time.Time
+
+// dashboardActionMsg reports the outcome of a hotkey action.
+type dashboardActionMsg struct {
+	message string
+	err     error
+}
+
+// dashboardModel is the bubbletea model of the terminal dashboard.
+type dashboardModel struct {
+	st        StateStore
+	engines   map[string]PnLEngine
+	admin     *adminClient
+	canceller OrderCanceller
+	wallet    string
+	pairs     []string
+	pairIndex int
+
+	data          dashboardData
+	cursor        int
+	confirmCancel bool
+	message       string
+}
+
+// load returns a command that reads the data of the current pair from the state store and the admin API.
+func (m dashboardModel) load() tea.Cmd {
+	pair := m.pairs[m.pairIndex]
+	return func() tea.Msg {
+		data := dashboardData{pair: pair}
+		now := time.Now()
+
+		if data.state, data.err = m.st.GetMonitorState(pair); data.err != nil {
+			return data
+		}
+		if data.snapshots, data.err = m.st.QuerySnapshots(m.wallet, now.Add(-24*time.Hour), now); data.err != nil {
+			return data
+		}
+
+		currentPrice := 0.0
+		if data.state != nil {
+			currentPrice = data.state.PreviousPrice
+		}
+		if currentPrice == 0 && len(data.snapshots) > 0 {
+			currentPrice = pairPrice(data.snapshots[len(data.snapshots)-1], pair)
+		}
+		if data.pnl, data.err = m.engines[pair].Report(pair, currentPrice); data.err != nil {
+			return data
+		}
+
+		if data.trades, data.err = m.st.QueryTrades(pair, now.Add(-7*24*time.Hour), now); data.err != nil {
+			return data
+		}
+		if len(data.trades) > 10 {
+			data.trades = data.trades[len(data.trades)-10:]
+		}
+		if data.openOrders, data.err = m.st.OpenTrades(pair); data.err != nil {
+			return data
+		}
+
+		if m.admin != nil {
+			data.status, data.err = m.admin.PairStatus(pair)
+		}
+		return data
+	}
+}
+
+// tick returns a command that triggers the next reload.
+func (m dashboardModel) tick() tea.Cmd {
+	return tea.Tick(tuiRefreshInterval, func(t time.Time) tea.Msg {
+		return dashboardTickMsg(t)
+	})
+}
+
+// Init loads the data of the first pair and starts the refresh ticker.
+func (m dashboardModel) Init() tea.Cmd {
+	return tea.Batch(m.load(), m.tick())
+}
+
+// Update handles key presses, reloads and action outcomes.
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case dashboardTickMsg:
+		return m, tea.Batch(m.load(), m.tick())
+	case dashboardData:
+		if msg.pair == m.pairs[m.pairIndex] {
+			m.data = msg
+			m.cursor = max(0, min(m.cursor, len(m.data.openOrders)-1))
+		}
+	case dashboardActionMsg:
+		m.message = msg.message
+		if msg.err != nil {
+			m.message = tuiErrorStyle.Render(msg.err.Error())
+		}
+		return m, m.load()
+	case tea.KeyMsg:
+		if m.confirmCancel {
+			m.confirmCancel = false
+			if msg.String() == "y" && m.cursor < len(m.data.openOrders) {
+				return m, m.cancel(m.data.openOrders[m.cursor].OrderHash)
+			}
+			m.message = "Cancellation aborted"
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "tab":
+			m.pairIndex = (m.pairIndex + 1) % len(m.pairs)
+			m.data = dashboardData{pair: m.pairs[m.pairIndex]}
+			m.cursor = 0
+			return m, m.load()
+		case "up", "k":
+			m.cursor = max(0, m.cursor-1)
+		case "down", "j":
+			m.cursor = max(0, min(len(m.data.openOrders)-1, m.cursor+1))
+		case "p", "r":
+			return m, m.setPaused(msg.String() == "p")
+		case "c":
+			if m.canceller == nil {
+				m.message = "RPC_URL is required to cancel orders"
+			} else if len(m.data.openOrders) > 0 {
+				m.confirmCancel = true
+				m.message = fmt.Sprintf("Cancel order %s? (y/N)", m.data.openOrders[m.cursor].OrderHash)
+			}
+		}
+	}
+	return m, nil
+}
+
+// setPaused returns a command that pauses or resumes the current pair through the admin API.
+func (m dashboardModel) setPaused(paused bool) tea.Cmd {
+	pair := m.pairs[m.pairIndex]
+	return func() tea.Msg {
+		if m.admin == nil {
+			return dashboardActionMsg{message: "ADMIN_TOKEN is required to pause or resume pairs"}
+		}
+		if paused {
+			return dashboardActionMsg{message: "Paused " + pair, err: m.admin.Pause(pair)}
+		}
+		return dashboardActionMsg{message: "Resumed " + pair, err: m.admin.Resume(pair)}
+	}
+}
+
+// cancel returns a command that cancels the order on-chain.
+func (m dashboardModel) cancel(orderHash string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), tuiCancelTimeout)
+		defer cancel()
+
+		receipt, err := m.canceller.CancelOrder(ctx, orderHash)
+		if err != nil {
+			return dashboardActionMsg{err: err}
+		}
+		return dashboardActionMsg{message: fmt.Sprintf("Cancelled order %s in transaction %s", orderHash, receipt.TxHash.Hex())}
+	}
+}
+
+// View renders the dashboard of the current pair.
+func (m dashboardModel) View() string {
+	var sb strings.Builder
+	d := m.data
+	stableSymbol := d.pair[strings.Index(d.pair, "/")+1:]
+
+	mode := tuiRunningStyle.Render("RUNNING")
+	if d.status == nil {
+		mode = tuiHelpStyle.Render("UNKNOWN")
+	} else if d.status.Paused {
+		mode = tuiPausedStyle.Render("PAUSED")
+	}
+	fmt.Fprintf(&sb, "%s  %s  %s\n\n", tuiTitleStyle.Render(fmt.Sprintf("Kryptonite · %s", d.pair)), tuiHelpStyle.Render(fmt.Sprintf("[%d/%d]", m.pairIndex+1, len(m.pairs))), mode)
+
+	if d.err != nil {
+		fmt.Fprintf(&sb, "%s\n\n", tuiErrorStyle.Render(d.err.Error()))
+	}
+
+	if d.state != nil {
+		prices := make([]float64, 0, len(d.snapshots)+1)
+		for _, snapshot := range d.snapshots {
+			if price := pairPrice(snapshot, d.pair); price > 0 {
+				prices = append(prices, price)
+			}
+		}
+		if d.state.PreviousPrice > 0 {
+			prices = append(prices, d.state.PreviousPrice)
+		}
+		fmt.Fprintf(&sb, "%s%f %s  %s\n", tuiLabelStyle.Render("Price"), d.state.PreviousPrice, stableSymbol, sparkline(prices, 48))
+		fmt.Fprintf(&sb, "%s%f %s %f  waiting to %s\n", tuiLabelStyle.Render("Bands"), d.state.TriggerPriceDown, triggerBand(d.state.PreviousPrice, d.state.TriggerPriceDown, d.state.TriggerPriceUp, 24), d.state.TriggerPriceUp, d.state.CurrentOrderType)
+		fmt.Fprintf(&sb, "%slimit %.2f%%, stop-loss %.2f%%\n", tuiLabelStyle.Render("Strategy"), d.state.LimitPercent, d.state.StopLossPercent)
+	} else {
+		fmt.Fprintf(&sb, "%s%s\n", tuiLabelStyle.Render("Price"), tuiHelpStyle.Render("no monitor state yet"))
+	}
+
+	if len(d.snapshots) > 0 {
+		s := d.snapshots[len(d.snapshots)-1]
+		targetSymbol, _, _ := strings.Cut(d.pair, "/")
+		var balances []string
+		for _, symbol := range []string{targetSymbol, stableSymbol} {
+			if h := s.Holding(symbol); h != nil {
+				balances = append(balances, fmt.Sprintf("%f %s", h.Amount, symbol))
+			}
+		}
+		fmt.Fprintf(&sb, "%s%s, wallet total %f USD\n", tuiLabelStyle.Render("Balances"), strings.Join(balances, ", "), s.TotalValue)
+	}
+
+	if d.pnl != nil {
+		fmt.Fprintf(&sb, "%sposition %f, cost basis %f, realized %f, unrealized %f (%s)\n", tuiLabelStyle.Render("PnL"), d.pnl.Position, d.pnl.CostBasis, d.pnl.RealizedPnL, d.pnl.UnrealizedPnL, d.pnl.Method)
+	}
+
+	fmt.Fprintf(&sb, "\n%s\n", tuiHeaderStyle.Render("Recent trades"))
+	if len(d.trades) == 0 {
+		sb.WriteString(tuiHelpStyle.Render("none") + "\n")
+	}
+	for i := len(d.trades) - 1; i >= 0; i-- {
+		t := d.trades[i]
+		fmt.Fprintf(&sb, "%s  %-4s  %-16s  %f  %s\n", t.CreatedAt.Local().Format(time.DateTime), t.OrderType, t.Status, t.Price, shortHash(t.OrderHash))
+	}
+
+	fmt.Fprintf(&sb, "\n%s\n", tuiHeaderStyle.Render("Open orders"))
+	if len(d.openOrders) == 0 {
+		sb.WriteString(tuiHelpStyle.Render("none") + "\n")
+	}
+	for i, t := range d.openOrders {
+		line := fmt.Sprintf("%s  %-4s  %s %s -> %s  %s", t.CreatedAt.Local().Format(time.DateTime), t.OrderType, t.FromTokenAmount, t.FromTokenSymbol, t.ToTokenSymbol, t.OrderHash)
+		if i == m.cursor {
+			line = tuiSelectStyle.Render(line)
+		}
+		sb.WriteString(line + "\n")
+	}
+
+	if m.message != "" {
+		fmt.Fprintf(&sb, "\n%s\n", m.message)
+	}
+	fmt.Fprintf(&sb, "\n%s\n", tuiHelpStyle.Render("tab next pair · ↑/↓ select order · p pause · r resume · c cancel order · q quit"))
+	return sb.String()
+}
+
+// pairPrice returns the price of the target token of the pair in its stable token from the USD prices of the snapshot, or
+// zero if the snapshot does not hold both tokens.
+func pairPrice(s *EquitySnapshot, pair string) float64 {
+	targetSymbol, stableSymbol, _ := strings.Cut(pair, "/")
+	target, stable := s.Holding(targetSymbol), s.Holding(stableSymbol)
+	if target == nil || stable == nil || stable.Price <= 0 {
+		return 0
+	}
+	return target.Price / stable.Price
+}
+
+// shortHash abbreviates a hex hash for display.
+func shortHash(hash string) string {
+	if len(hash) <= 14 {
+		return hash
+	}
+	return hash[:8] + "…" + hash[len(hash)-4:]
+}
+
+// runTUICommand runs the terminal dashboard for the pairs of the wallet until the user quits. The PnL engines are keyed by pair. The admin
+// client and order canceller may be nil, in which case the corresponding hotkeys are disabled.
+func runTUICommand(st StateStore, engines map[string]PnLEngine, admin *adminClient, canceller OrderCanceller, wallet string, pairs []string) error {
+	m := dashboardModel{
+		st:        st,
+		engines:   engines,
+		admin:     admin,
+		canceller: canceller,
+		wallet:    wallet,
+		pairs:     pairs,
+		data:      dashboardData{pair: pairs[0]},
+	}
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
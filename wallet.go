@@ -4,17 +4,27 @@ import (
 	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"math/big"
 
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
 // Wallet interface defines methods for signing messages and retrieving the wallet address.
 type Wallet interface {
-	// SignEIP712Message signs an EIP-712 typed data message using the wallet's private key.
+	// SignEIP712Message signs a JSON encoded EIP-712 typed data message using the wallet's private key.
 	SignEIP712Message(message []byte) ([]byte, error)
 
+	// SignTypedData signs an EIP-712 typed data message using the wallet's private key.
+	SignTypedData(typedData apitypes.TypedData) ([]byte, error)
+
+	// SignPersonalMessage signs an EIP-191 personal_sign message using the wallet's private key.
+	SignPersonalMessage(message []byte) ([]byte, error)
+
+	// SignTransaction signs a raw transaction for the wallet's chain using the wallet's private key.
+	SignTransaction(tx *types.Transaction) (*types.Transaction, error)
+
 	// Address returns the wallet's address.
 	Address() string
 
@@ -37,44 +47,55 @@ type wallet struct {
 	chainId string
 }
 
-// SignEIP712Message signs an EIP-712 typed data message using the wallet's private key.
+// SignEIP712Message signs a JSON encoded EIP-712 typed data message using the wallet's private key.
 func (w *wallet) SignEIP712Message(message []byte) ([]byte, error) {
 	var typedData apitypes.TypedData
-	err := json.Unmarshal(message, &typedData)
-	if err != nil {
+	if err := json.Unmarshal(message, &typedData); err != nil {
 		return []byte(""), err
 	}
 
-	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
-	if err != nil {
-		return []byte(""), err
-	}
+	return w.SignTypedData(typedData)
+}
 
-	typedDataHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+// SignTypedData signs an EIP-712 typed data message using the wallet's private key.
+func (w *wallet) SignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	digestHash, err := HashTypedData(typedData)
 	if err != nil {
 		return []byte(""), err
 	}
 
-	rawData := []byte(fmt.Sprintf("\x19\x01%s%s", string(domainSeparator), string(typedDataHash)))
-	digestHash := crypto.Keccak256(rawData)
+	return w.signDigest(digestHash)
+}
 
-	signature, err := crypto.Sign(digestHash, w.privateKey)
-	if err != nil {
-		return []byte(""), err
+// SignPersonalMessage signs an EIP-191 personal_sign message using the wallet's private key.
+func (w *wallet) SignPersonalMessage(message []byte) ([]byte, error) {
+	return w.signDigest(HashPersonalMessage(message))
+}
+
+// SignTransaction signs a raw transaction for the wallet's chain using the wallet's private key.
+func (w *wallet) SignTransaction(tx *types.Transaction) (*types.Transaction, error) {
+	chainId, ok := new(big.Int).SetString(w.chainId, 10)
+	if !ok {
+		return nil, errors.New("invalid chain id: " + w.chainId)
 	}
 
-	recoveredPubKey, err := crypto.Ecrecover(digestHash, signature)
+	return types.SignTx(tx, types.LatestSignerForChainID(chainId), w.privateKey)
+}
+
+// signDigest signs the digest, verifies that the signature recovers to the wallet address and
+// returns it in the [R || S || V] form with V set to 27 or 28.
+func (w *wallet) signDigest(digestHash []byte) ([]byte, error) {
+	signature, err := crypto.Sign(digestHash, w.privateKey)
 	if err != nil {
 		return []byte(""), err
 	}
 
-	publicKey, err := crypto.UnmarshalPubkey(recoveredPubKey)
+	recoveredAddr, err := recoverSigner(digestHash, signature)
 	if err != nil {
 		return []byte(""), err
 	}
 
-	recoveredAddr := crypto.PubkeyToAddress(*publicKey)
-	if recoveredAddr.Hex() != w.address {
+	if recoveredAddr != w.address {
 		return []byte(""), errors.New("signature does not match the wallet address")
 	}
 